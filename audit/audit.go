@@ -0,0 +1,328 @@
+// Package audit logs the sessions of the terminals, the SSH terminals
+// and the port forwardings, who connected from where, when, for how long
+// and which command ran, and records the terminal I/O in asciicast v2
+// format so that the sessions can be replayed.
+//
+// The log is "audit.log" of the directory, a json [Event] per line,
+// "start" when a session opens and "end" when it closes.
+// The recordings are "<session id>.cast" of the directory.
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/metrical/middleware/auth"
+	"github.com/OutOfBedlam/webterm"
+)
+
+// LogFile is the name of the audit log in the directory.
+const LogFile = "audit.log"
+
+// DefaultPath is the default path of the page of the sessions.
+const DefaultPath = "/audit"
+
+// Config is the config of the auditing, it is enabled if Dir is set.
+type Config struct {
+	Dir         string        `toml:"dir"`
+	Path        string        `toml:"path"`
+	Record      bool          `toml:"record"`
+	RecordInput bool          `toml:"record_input"`
+	Retention   time.Duration `toml:"retention"`
+}
+
+// Enabled reports whether the auditing is configured.
+func (c Config) Enabled() bool {
+	return c.Dir != ""
+}
+
+// Event is a line of the audit log.
+type Event struct {
+	Time      time.Time     `json:"time"`
+	Event     string        `json:"event"` // "start" or "end"
+	ID        string        `json:"id"`
+	Kind      string        `json:"kind"` // "term", "ssh" or "port"
+	Path      string        `json:"path"`
+	User      string        `json:"user,omitempty"`
+	Method    string        `json:"method,omitempty"` // the authentication method of the user
+	Remote    string        `json:"remote"`
+	Command   string        `json:"command"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	BytesIn   int64         `json:"bytes_in,omitempty"`
+	BytesOut  int64         `json:"bytes_out,omitempty"`
+	Recording string        `json:"recording,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Auditor logs and records the sessions.
+// The methods of a nil Auditor return the handlers without auditing.
+type Auditor struct {
+	cfg Config
+
+	mu  sync.Mutex
+	log *os.File
+}
+
+// New returns the auditor of the config, it creates the directory
+// and removes the recordings older than the retention.
+func New(cfg Config) (*Auditor, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("dir is required")
+	}
+	if cfg.Retention < 0 {
+		return nil, fmt.Errorf("invalid retention %s", cfg.Retention)
+	}
+	if cfg.Path == "" {
+		cfg.Path = DefaultPath
+	}
+	cfg.Path = strings.TrimSuffix(cfg.Path, "/") + "/"
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(cfg.Dir, LogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	a := &Auditor{cfg: cfg, log: f}
+	a.prune()
+	return a, nil
+}
+
+// Path returns the path of the page of the sessions.
+func (a *Auditor) Path() string {
+	return a.cfg.Path
+}
+
+// Close closes the audit log.
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.log.Close()
+}
+
+func (a *Auditor) write(ev Event) {
+	ev.Time = time.Now()
+	b, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("Failed to marshal audit event", "error", err)
+		return
+	}
+	a.mu.Lock()
+	_, err = a.log.Write(append(b, '\n'))
+	a.mu.Unlock()
+	if err != nil {
+		slog.Error("Failed to write audit log", "error", err)
+	}
+	attrs := []any{"id", ev.ID, "kind", ev.Kind, "path", ev.Path, "user", ev.User, "remote", ev.Remote, "command", ev.Command}
+	if ev.Event == "end" {
+		attrs = append(attrs, "duration", ev.Duration)
+		if ev.Error != "" {
+			attrs = append(attrs, "error", ev.Error)
+		}
+	}
+	slog.Info("Audit session "+ev.Event, attrs...)
+}
+
+// prune removes the recordings older than the retention,
+// the audit log is kept.
+func (a *Auditor) prune() {
+	if a.cfg.Retention <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(a.cfg.Dir)
+	if err != nil {
+		slog.Error("Failed to read audit dir", "dir", a.cfg.Dir, "error", err)
+		return
+	}
+	expiry := time.Now().Add(-a.cfg.Retention)
+	for _, ent := range entries {
+		if ent.IsDir() || !strings.HasSuffix(ent.Name(), ".cast") {
+			continue
+		}
+		if fi, err := ent.Info(); err != nil || fi.ModTime().After(expiry) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(a.cfg.Dir, ent.Name())); err != nil {
+			slog.Error("Failed to remove expired recording", "file", ent.Name(), "error", err)
+		}
+	}
+}
+
+var validID = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}-[0-9a-f]{8}$`)
+
+func newID(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return t.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// newEvent returns the start event of the session of the request,
+// the user is of the authentication.
+func newEvent(r *http.Request, kind, command string) Event {
+	now := time.Now()
+	ev := Event{
+		Event:   "start",
+		ID:      newID(now),
+		Kind:    kind,
+		Path:    r.URL.Path,
+		Remote:  r.RemoteAddr,
+		Command: command,
+		Start:   now,
+	}
+	if id, ok := auth.FromContext(r.Context()); ok {
+		ev.User, ev.Method = id.Name, id.Method
+	}
+	return ev
+}
+
+// Terminal returns the handler of the terminal of the runner,
+// that audits the sessions of its "data" websocket.
+// The kind is "term" or "ssh", the opts are of the terminal.
+func (a *Auditor) Terminal(kind, cutPrefix, command string, runner webterm.Runner, opts ...webterm.Option) http.Handler {
+	term := webterm.New(runner, opts...)
+	if a == nil {
+		return term
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, cutPrefix) != "data" {
+			term.ServeHTTP(w, r)
+			return
+		}
+		// the runner of the request knows who opens the session
+		ev := newEvent(r, kind, command)
+		ev.Path = cutPrefix
+		webterm.New(&auditRunner{Runner: runner, a: a, ev: ev}, opts...).ServeHTTP(w, r)
+	})
+}
+
+// Port returns the handler of the port forwarding that logs the connections.
+func (a *Auditor) Port(remote string, next http.HandlerFunc) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := newEvent(r, "port", remote)
+		a.write(ev)
+		next(w, r)
+		ev.Event = "end"
+		ev.Duration = time.Since(ev.Start)
+		a.write(ev)
+	})
+}
+
+type auditRunner struct {
+	webterm.Runner
+	a  *Auditor
+	ev Event
+}
+
+func (ar *auditRunner) Session() (webterm.Session, error) {
+	s, err := ar.Runner.Session()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Session: s, a: ar.a, ev: ar.ev}, nil
+}
+
+// Session is the audited session of a terminal.
+type Session struct {
+	webterm.Session
+	a   *Auditor
+	ev  Event
+	rec *Recorder
+
+	mu        sync.Mutex
+	closeOnce sync.Once
+}
+
+func (s *Session) Open() error {
+	if err := s.Session.Open(); err != nil {
+		s.ev.Error = err.Error()
+		s.end()
+		return err
+	}
+	if s.a.cfg.Record {
+		name := s.ev.ID + ".cast"
+		rec, err := NewRecorder(filepath.Join(s.a.cfg.Dir, name), s.ev.Command, s.ev.Start)
+		if err != nil {
+			slog.Error("Failed to record session", "id", s.ev.ID, "error", err)
+		} else {
+			s.rec = rec
+			s.ev.Recording = name
+		}
+	}
+	s.a.write(s.ev)
+	return nil
+}
+
+func (s *Session) Read(p []byte) (int, error) {
+	n, err := s.Session.Read(p)
+	if n > 0 {
+		s.mu.Lock()
+		s.ev.BytesOut += int64(n)
+		s.mu.Unlock()
+		if s.rec != nil {
+			s.rec.Output(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (s *Session) Write(p []byte) (int, error) {
+	n, err := s.Session.Write(p)
+	if n > 0 {
+		s.mu.Lock()
+		s.ev.BytesIn += int64(n)
+		s.mu.Unlock()
+		if s.rec != nil && s.a.cfg.RecordInput {
+			s.rec.Input(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (s *Session) SetWinSize(cols, rows int) error {
+	if s.rec != nil {
+		s.rec.Resize(cols, rows)
+	}
+	return s.Session.SetWinSize(cols, rows)
+}
+
+// Close closes the session and logs its end once.
+func (s *Session) Close() error {
+	err := s.Session.Close()
+	s.end()
+	return err
+}
+
+func (s *Session) end() {
+	s.closeOnce.Do(func() {
+		if s.rec != nil {
+			if err := s.rec.Close(); err != nil {
+				slog.Error("Failed to close recording", "id", s.ev.ID, "error", err)
+			}
+		}
+		s.mu.Lock()
+		ev := s.ev
+		s.mu.Unlock()
+		ev.Event = "end"
+		ev.Duration = time.Since(ev.Start)
+		s.a.write(ev)
+		s.a.prune()
+	})
+}
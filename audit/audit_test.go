@@ -0,0 +1,244 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRunner struct {
+	output []string
+}
+
+func (fr *fakeRunner) Session() (webterm.Session, error) {
+	return &fakeSession{output: fr.output}, nil
+}
+
+func (fr *fakeRunner) Template() (*template.Template, any) {
+	return nil, nil
+}
+
+type fakeSession struct {
+	output []string
+	input  []byte
+}
+
+func (fs *fakeSession) Open() error  { return nil }
+func (fs *fakeSession) Close() error { return nil }
+func (fs *fakeSession) Read(p []byte) (int, error) {
+	if len(fs.output) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, fs.output[0])
+	fs.output = fs.output[1:]
+	return n, nil
+}
+func (fs *fakeSession) Write(p []byte) (int, error) {
+	fs.input = append(fs.input, p...)
+	return len(p), nil
+}
+func (fs *fakeSession) SetWinSize(cols, rows int) error { return nil }
+func (fs *fakeSession) Control(data []byte) error       { return nil }
+
+func readLines(t *testing.T, filename string) []string {
+	t.Helper()
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	a, err := New(Config{Dir: dir, Record: true})
+	require.NoError(t, err)
+	defer a.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "/term/home/data", nil)
+	r.RemoteAddr = "10.0.0.5:51234"
+	ev := newEvent(r, "term", "/bin/bash -il")
+	require.True(t, validID.MatchString(ev.ID))
+	ar := &auditRunner{Runner: &fakeRunner{output: []string{"$ ", "hello \xe2\x82", "\xac\r\n"}}, a: a, ev: ev}
+	s, err := ar.Session()
+	require.NoError(t, err)
+	require.NoError(t, s.Open())
+	require.NoError(t, s.SetWinSize(120, 40))
+	buf := make([]byte, 64)
+	for {
+		if _, err := s.Read(buf); err != nil {
+			break
+		}
+	}
+	_, err = s.Write([]byte("echo secret\r"))
+	require.NoError(t, err)
+	require.NoError(t, s.SetWinSize(100, 30))
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+
+	// the audit log has the start and the end once
+	lines := readLines(t, filepath.Join(dir, LogFile))
+	require.Len(t, lines, 2)
+	var start, end Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &start))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &end))
+	require.Equal(t, "start", start.Event)
+	require.Equal(t, "end", end.Event)
+	require.Equal(t, ev.ID, end.ID)
+	require.Equal(t, "10.0.0.5:51234", end.Remote)
+	require.Equal(t, "/bin/bash -il", end.Command)
+	require.Equal(t, int64(12), end.BytesIn)
+	require.Equal(t, int64(13), end.BytesOut)
+	require.Equal(t, ev.ID+".cast", end.Recording)
+
+	// the recording has the size of the first resize, the output
+	// with the rune split across the reads and no input
+	cast := readLines(t, filepath.Join(dir, ev.ID+".cast"))
+	require.Len(t, cast, 5)
+	var header map[string]any
+	require.NoError(t, json.Unmarshal([]byte(cast[0]), &header))
+	require.Equal(t, float64(2), header["version"])
+	require.Equal(t, float64(120), header["width"])
+	require.Equal(t, float64(40), header["height"])
+	var events [][]any
+	for _, line := range cast[1:] {
+		var e []any
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		events = append(events, e)
+	}
+	require.Equal(t, []any{"o", "$ "}, events[0][1:])
+	require.Equal(t, []any{"o", "hello "}, events[1][1:])
+	require.Equal(t, []any{"o", "€\r\n"}, events[2][1:])
+	require.Equal(t, []any{"r", "100x30"}, events[3][1:])
+
+	sessions, err := a.Sessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.False(t, sessions[0].Active)
+	require.True(t, sessions[0].Replayable)
+}
+
+func TestRecordInput(t *testing.T) {
+	dir := t.TempDir()
+	a, err := New(Config{Dir: dir, Record: true, RecordInput: true})
+	require.NoError(t, err)
+	defer a.Close()
+
+	ar := &auditRunner{Runner: &fakeRunner{}, a: a, ev: newEvent(httptest.NewRequest(http.MethodGet, "/", nil), "ssh", "user@host:22")}
+	s, err := ar.Session()
+	require.NoError(t, err)
+	require.NoError(t, s.Open())
+	_, err = s.Write([]byte("ls\r"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	cast := readLines(t, filepath.Join(dir, ar.ev.ID+".cast"))
+	require.Len(t, cast, 2)
+	require.Contains(t, cast[1], `"i","ls\r"`)
+}
+
+func TestPort(t *testing.T) {
+	dir := t.TempDir()
+	a, err := New(Config{Dir: dir})
+	require.NoError(t, err)
+	defer a.Close()
+
+	h := a.Port("tcp://127.0.0.1:5654", func(w http.ResponseWriter, r *http.Request) {
+		sessions, err := a.Sessions()
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		require.True(t, sessions[0].Active)
+	})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/term/agent/", nil))
+	sessions, err := a.Sessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.False(t, sessions[0].Active)
+	require.Equal(t, "port", sessions[0].Kind)
+	require.Equal(t, "tcp://127.0.0.1:5654", sessions[0].Command)
+	require.False(t, sessions[0].Replayable)
+
+	var nilAuditor *Auditor
+	called := false
+	nilAuditor.Port("", func(w http.ResponseWriter, r *http.Request) { called = true }).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	require.True(t, called)
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "20200101T000000-00000000.cast")
+	recent := filepath.Join(dir, "20200101T000000-00000001.cast")
+	require.NoError(t, os.WriteFile(old, []byte("{}\n"), 0600))
+	require.NoError(t, os.WriteFile(recent, []byte("{}\n"), 0600))
+	past := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+
+	a, err := New(Config{Dir: dir, Retention: 24 * time.Hour})
+	require.NoError(t, err)
+	defer a.Close()
+	require.NoFileExists(t, old)
+	require.FileExists(t, recent)
+	require.FileExists(t, filepath.Join(dir, LogFile))
+
+	_, err = New(Config{Dir: dir, Retention: -time.Hour})
+	require.Error(t, err)
+	_, err = New(Config{})
+	require.Error(t, err)
+}
+
+func TestServeHTTP(t *testing.T) {
+	dir := t.TempDir()
+	a, err := New(Config{Dir: dir, Record: true, Path: "/audit"})
+	require.NoError(t, err)
+	defer a.Close()
+	require.Equal(t, "/audit/", a.Path())
+
+	r := httptest.NewRequest(http.MethodGet, "/term/home/data", nil)
+	ar := &auditRunner{Runner: &fakeRunner{output: []string{"<b>hi</b>"}}, a: a, ev: newEvent(r, "term", "<script>")}
+	s, err := ar.Session()
+	require.NoError(t, err)
+	require.NoError(t, s.Open())
+	s.Read(make([]byte, 64))
+	require.NoError(t, s.Close())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	w := get("/audit/")
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	require.Contains(t, body, "/audit/play/"+ar.ev.ID)
+	require.Contains(t, body, "&lt;script&gt;")
+	require.NotContains(t, body, "<script>")
+
+	w = get("/audit/play/" + ar.ev.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), ar.ev.ID)
+
+	w = get("/audit/cast/" + ar.ev.ID + ".cast")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, strings.HasPrefix(w.Body.String(), `{"env"`))
+
+	w = get("/audit/xterm/xterm.js")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Equal(t, http.StatusNotFound, get("/audit/play/..%2Faudit.log").Code)
+	require.Equal(t, http.StatusNotFound, get("/audit/cast/audit.log").Code)
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recorder writes the terminal I/O to the file in asciicast v2 format,
+// https://docs.asciinema.org/manual/asciicast/v2/
+// The header is written with the first event, so that it has
+// the terminal size if the session starts with the resize.
+type Recorder struct {
+	mu       sync.Mutex
+	f        *os.File
+	title    string
+	start    time.Time
+	width    int
+	height   int
+	header   bool
+	pending  map[string][]byte // the incomplete UTF-8 sequences of the last data
+	writeErr error
+}
+
+// NewRecorder creates the file of the recording.
+func NewRecorder(filename, title string, start time.Time) (*Recorder, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f, title: title, start: start, width: 80, height: 24, pending: map[string][]byte{}}, nil
+}
+
+// Output records the output of the terminal.
+func (r *Recorder) Output(p []byte) {
+	r.data("o", p)
+}
+
+// Input records the input of the user.
+func (r *Recorder) Input(p []byte) {
+	r.data("i", p)
+}
+
+// Resize records the new size of the terminal.
+func (r *Recorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	if !r.header {
+		r.width, r.height = cols, rows
+		r.writeHeader()
+		return
+	}
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *Recorder) data(code string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	b := append(r.pending[code], p...)
+	// keeps the incomplete rune at the end for the next data
+	cut := len(b)
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending[code] = append([]byte(nil), b[cut:]...)
+	if cut > 0 {
+		r.event(code, string(b[:cut]))
+	}
+}
+
+func (r *Recorder) writeHeader() {
+	r.header = true
+	r.writeJSON(map[string]any{
+		"version":   2,
+		"width":     r.width,
+		"height":    r.height,
+		"timestamp": r.start.Unix(),
+		"title":     r.title,
+		"env":       map[string]string{"TERM": "xterm-256color"},
+	})
+}
+
+func (r *Recorder) event(code, data string) {
+	if r.f == nil {
+		return
+	}
+	if !r.header {
+		r.writeHeader()
+	}
+	r.writeJSON([]any{float64(time.Since(r.start).Microseconds()) / 1e6, code, data})
+}
+
+func (r *Recorder) writeJSON(v any) {
+	if r.writeErr != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err == nil {
+		_, err = r.f.Write(append(b, '\n'))
+	}
+	r.writeErr = err
+}
+
+// Close closes the file, the data afterwards is ignored.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	for code, rest := range r.pending {
+		if len(rest) > 0 {
+			r.event(code, string(rest))
+		}
+	}
+	if !r.header {
+		r.writeHeader()
+	}
+	err := r.f.Close()
+	r.f = nil
+	if r.writeErr != nil {
+		return r.writeErr
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+//go:embed "sessions.html"
+var sessionsHTML string
+
+//go:embed "replay.html"
+var replayHTML string
+
+var funcs = template.FuncMap{
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+}
+
+var sessionsTmpl = template.Must(template.New("sessions").Funcs(funcs).Parse(sessionsHTML))
+var replayTmpl = template.Must(template.New("replay").Parse(replayHTML))
+
+// SessionInfo is a session of the audit log.
+type SessionInfo struct {
+	Event
+	Active     bool // the session has not ended
+	Replayable bool // the recording exists
+}
+
+// Sessions returns the sessions of the audit log, the latest first.
+func (a *Auditor) Sessions() ([]SessionInfo, error) {
+	f, err := os.Open(filepath.Join(a.cfg.Dir, LogFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sessions := map[string]*SessionInfo{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil || ev.ID == "" {
+			continue
+		}
+		sessions[ev.ID] = &SessionInfo{Event: ev, Active: ev.Event == "start"}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	ret := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		if s.Recording != "" {
+			if _, err := os.Stat(filepath.Join(a.cfg.Dir, s.Recording)); err == nil {
+				s.Replayable = true
+			}
+		}
+		ret = append(ret, *s)
+	}
+	slices.SortFunc(ret, func(x, y SessionInfo) int {
+		return y.Start.Compare(x.Start)
+	})
+	return ret, nil
+}
+
+// ServeHTTP serves the list of the sessions at the path,
+// the replay page of a session at "play/<id>"
+// and its recording at "cast/<id>.cast".
+func (a *Auditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, a.cfg.Path)
+	switch {
+	case path == "":
+		sessions, err := a.Sessions()
+		if err != nil {
+			slog.Error("Failed to read audit log", "error", err)
+			http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		sessionsTmpl.Execute(w, map[string]any{"Path": a.cfg.Path, "Sessions": sessions})
+	case strings.HasPrefix(path, "play/"):
+		id := strings.TrimPrefix(path, "play/")
+		if !validID.MatchString(id) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		replayTmpl.Execute(w, map[string]any{"Path": a.cfg.Path, "ID": id})
+	case strings.HasPrefix(path, "cast/"):
+		id, ok := strings.CutSuffix(strings.TrimPrefix(path, "cast/"), ".cast")
+		if !ok || !validID.MatchString(id) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		http.ServeFile(w, r, filepath.Join(a.cfg.Dir, id+".cast"))
+	case strings.HasPrefix(path, "xterm/"):
+		// xterm.js of the terminals for the replay
+		webterm.New(nil, webterm.WithCutPrefix(a.cfg.Path+"xterm/")).ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/derived"
+	"github.com/OutOfBedlam/metrical/middleware/auth"
+	"github.com/OutOfBedlam/metrical/registry"
+	"github.com/OutOfBedlam/metrical/tlsconf"
+)
+
+// checkConfig validates the decoded config, it reports the unknown keys,
+// the invalid timeseries, filters, derived metrics, http.auth, http.ssh, http.audit and TLS
+// with their positions, and the problems of the input, output and processor sections.
+func (mc *Metrical) checkConfig(cfg *registry.Config, meta toml.MetaData) error {
+	var errs []error
+	report := func(key []string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", cfg.Position(key...), fmt.Sprintf(format, args...)))
+	}
+	for _, key := range meta.Undecoded() {
+		switch key[0] {
+		case "input", "output", "processor":
+			// checked by the registry
+			continue
+		}
+		report(key, "unknown key %q", key.String())
+	}
+
+	if mc.Data.SamplingInterval != 0 && mc.Data.SamplingInterval < time.Second {
+		report([]string{"data", "sampling_interval"}, "data.sampling_interval %s should be at least 1s", mc.Data.SamplingInterval)
+	}
+	if mc.Data.InputBuffer < 0 {
+		report([]string{"data", "input_buffer"}, "data.input_buffer should not be negative")
+	}
+	ids := map[string]bool{}
+	for i, ts := range mc.Data.Timeseries {
+		key := []string{"data", "timeseries", strconv.Itoa(i)}
+		if ts.Interval < time.Second {
+			report(append(key, "interval"), "timeseries %q interval %s should be at least 1s", ts.ID, ts.Interval)
+		}
+		if ts.MaxCount <= 1 {
+			report(append(key, "length"), "timeseries %q length %d should be greater than 1", ts.ID, ts.MaxCount)
+		}
+		if _, err := metric.NewSeriesID(ts.ID, ts.Title, ts.Interval, ts.MaxCount); err != nil {
+			report(append(key, "id"), "%v", err)
+		}
+		if ids[ts.ID] {
+			report(append(key, "id"), "duplicate series ID %q", ts.ID)
+		}
+		ids[ts.ID] = true
+	}
+	if _, err := metric.CompileIncludeAndExclude(mc.Data.Filter.Includes, mc.Data.Filter.Excludes, ':'); err != nil {
+		report([]string{"data", "filter"}, "invalid data.filter: %v", err)
+	}
+	for i, d := range mc.Data.Derived {
+		if _, err := derived.New([]derived.Config{d}); err != nil {
+			report([]string{"data", "derived", strconv.Itoa(i)}, "%v", err)
+		}
+	}
+	if mc.Http.Auth.Enabled() {
+		if _, err := auth.New(mc.Http.Auth, nil); err != nil {
+			authErrs := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				authErrs = joined.Unwrap()
+			}
+			for _, e := range authErrs {
+				report([]string{"http", "auth"}, "http.auth: %v", e)
+			}
+		}
+	}
+	if path, ok := strings.CutPrefix(mc.Http.Listen, "unix:"); ok {
+		if path == "" {
+			report([]string{"http", "listen"}, "http.listen: the path of the unix socket is empty")
+		}
+		if _, err := parseSocketMode(mc.Http.SocketMode); err != nil {
+			report([]string{"http", "socket_mode"}, "http.%v", err)
+		}
+	} else if mc.Http.SocketMode != "" {
+		report([]string{"http", "socket_mode"}, "http.socket_mode requires the unix socket listen = \"unix:<path>\"")
+	}
+	if mc.Http.ShutdownTimeout < 0 {
+		report([]string{"http", "shutdown_timeout"}, "http.shutdown_timeout should not be negative")
+	}
+	for i, c := range mc.Http.SSHs {
+		if _, err := newSSH(c); err != nil {
+			sshErrs := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				sshErrs = joined.Unwrap()
+			}
+			for _, e := range sshErrs {
+				report([]string{"http", "ssh", strconv.Itoa(i)}, "http.ssh %s: %v", c.Path, e)
+			}
+		}
+	}
+	if a := mc.Http.Audit; !a.Enabled() && (a.Record || a.RecordInput || a.Path != "") {
+		report([]string{"http", "audit"}, "http.audit requires dir")
+	} else if a.Retention < 0 {
+		report([]string{"http", "audit", "retention"}, "http.audit.retention should not be negative")
+	}
+	if tlsOpts := mc.tlsOptions(); tlsOpts.Enabled() {
+		if tlsOpts.CertFile == "" || tlsOpts.KeyFile == "" {
+			report([]string{"http"}, "http.tls_cert and http.tls_key should be set together")
+		}
+		if _, err := tlsconf.ParseVersion(tlsOpts.MinVersion); err != nil {
+			report([]string{"http", "tls_min_version"}, "http.tls_min_version: %v", err)
+		}
+	} else if mc.Http.ClientCA != "" || mc.Http.TLSSelfSigned {
+		report([]string{"http"}, "http.client_ca and http.tls_self_signed require http.tls_cert and http.tls_key")
+	}
+	if _, err := metric.CompileIncludeAndExclude(mc.OPCUAServer.Filter.Includes, mc.OPCUAServer.Filter.Excludes, ':'); err != nil {
+		report([]string{"opcua_server", "filter"}, "invalid opcua_server.filter: %v", err)
+	}
+	if mc.OPCUAServer.UpdateInterval < 0 {
+		report([]string{"opcua_server", "update_interval"}, "opcua_server.update_interval should not be negative")
+	}
+
+	if err := registry.CheckConfig(cfg); err != nil {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = append(errs, joined.Unwrap()...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
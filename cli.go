@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/input/opcua"
+	"github.com/OutOfBedlam/metrical/middleware/auth"
+	"github.com/OutOfBedlam/metrical/registry"
+	"github.com/OutOfBedlam/metrical/store/sqlite"
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"run", "run [flags]", "runs the collector and the servers (default)", runCommand},
+	{"plugins", "plugins", "lists the registered inputs, outputs and processors", pluginsCommand},
+	{"config", "config sample <plugin>", "prints the sample config of the plugin", configCommand},
+	{"query", "query [flags] <metric>...", "prints the stored products of the metrics", queryCommand},
+	{"export", "export [flags] [metric]...", "dumps the stored series as ndjson", exportCommand},
+	{"opcua", "opcua browse [flags]", "browses the address space of an OPC UA server", opcuaCommand},
+	{"passwd", "passwd", "prints the bcrypt hash of the password read from stdin for http.auth", passwdCommand},
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+	idx := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if idx < 0 {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err := commands[idx].run(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: metrical <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.usage, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "metrical <command> -h" for the flags of the command.`)
+}
+
+// configFlags is the flags to locate the config files.
+type configFlags struct {
+	filename string
+	dir      string
+}
+
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	fs.StringVar(&cf.filename, "config", "", "metrical config file path")
+	fs.StringVar(&cf.dir, "config-dir", "", "directory of config files (*.toml) merged after the config file")
+	return cf
+}
+
+// load reads the config files over the default config.
+func (cf *configFlags) load() (*Metrical, *registry.Config, toml.MetaData, error) {
+	mc := &Metrical{}
+	if _, err := toml.Decode(configContent, mc); err != nil {
+		return nil, nil, toml.MetaData{}, err
+	}
+	name, content := "metrical.toml", configContent
+	if cf.filename != "" {
+		b, err := os.ReadFile(cf.filename)
+		if err != nil {
+			return nil, nil, toml.MetaData{}, err
+		}
+		name, content = cf.filename, string(b)
+	}
+	cfg, err := registry.ReadConfig(name, content, cf.dir)
+	if err != nil {
+		return nil, nil, toml.MetaData{}, fmt.Errorf("config %s: %w", name, err)
+	}
+	meta, err := toml.Decode(cfg.Content, mc)
+	if err != nil {
+		return nil, nil, toml.MetaData{}, fmt.Errorf("config %s: %w", name, err)
+	}
+	return mc, cfg, meta, nil
+}
+
+// openStorage opens the storage of data.store, nothing if it is empty.
+func (mc *Metrical) openStorage() error {
+	if mc.Data.Store == "" {
+		return nil
+	}
+	if path, ok := strings.CutPrefix(mc.Data.Store, "sqlite:"); ok {
+		storage, err := sqlite.NewStorage(path, mc.Data.InputBuffer)
+		if err != nil {
+			return err
+		}
+		mc.Storage = storage
+	} else { // default to file storage
+		mc.Storage = metric.NewFileStorage(mc.Data.Store, mc.Data.InputBuffer)
+	}
+	if opener, ok := mc.Storage.(interface{ Open() error }); ok {
+		if err := opener.Open(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openStoredData opens the storage of data.store read-only for the series,
+// so that it does not disturb a server running with the same store.
+// The file storage reads the .ts files that the server writes,
+// and the sqlite database is opened in the read-only mode.
+// It returns the function to close the storage.
+func (mc *Metrical) openStoredData() (func(), error) {
+	if path, ok := strings.CutPrefix(mc.Data.Store, "sqlite:"); ok {
+		storage, err := sqlite.NewStorage("file:"+path+"?mode=ro", mc.Data.InputBuffer)
+		if err != nil {
+			return nil, err
+		}
+		if err := storage.(*sqlite.Storage).Open(); err != nil {
+			return nil, err
+		}
+		mc.Storage = storage
+		return mc.closeStorage, nil
+	}
+	mc.Storage = metric.NewFileStorageReadOnly(mc.Data.Store)
+	return mc.closeStorage, nil
+}
+
+func (mc *Metrical) closeStorage() {
+	if closer, ok := mc.Storage.(interface{ Close() error }); ok {
+		closer.Close()
+	}
+}
+
+func pluginsCommand(args []string) error {
+	fs := flag.NewFlagSet("plugins", flag.ExitOnError)
+	fs.Parse(args)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "KIND\tNAME\tDESCRIPTION")
+	for _, name := range registry.Names() {
+		kind, short, _ := strings.Cut(name, ".")
+		item, _ := registry.Lookup(name)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", kind, short, item.Description)
+	}
+	return nil
+}
+
+func configCommand(args []string) error {
+	if len(args) != 2 || args[0] != "sample" {
+		return errors.New("usage: metrical config sample <plugin>")
+	}
+	item, ok := registry.Lookup(args[1])
+	if !ok {
+		return fmt.Errorf("unknown plugin %q, see \"metrical plugins\"", args[1])
+	}
+	fmt.Println(item.SampleConfig)
+	return nil
+}
+
+func opcuaCommand(args []string) error {
+	if len(args) == 0 || args[0] != "browse" {
+		return errors.New("usage: metrical opcua browse [flags]")
+	}
+	return opcua.BrowseCommand(args[1:], os.Stdout)
+}
+
+// passwdCommand reads a password from the first line of stdin
+// and prints its bcrypt hash, the password_hash of [[http.auth.user]].
+func passwdCommand(args []string) error {
+	fs := flag.NewFlagSet("passwd", flag.ExitOnError)
+	fs.Parse(args)
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("no password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Println(hash)
+	return nil
+}
+
+// storedSeries returns the series of data.timeseries,
+// or the series of the id if it is not empty.
+func (mc *Metrical) storedSeries(id string) ([]metric.SeriesID, error) {
+	var ret []metric.SeriesID
+	for _, ts := range mc.Data.Timeseries {
+		if id != "" && !strings.EqualFold(id, ts.ID) {
+			continue
+		}
+		seriesID, err := metric.NewSeriesID(ts.ID, ts.Title, ts.Interval, ts.MaxCount)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, seriesID)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("timeseries %q is not configured", id)
+	}
+	return ret, nil
+}
+
+// storedNames returns the names of the metrics stored for the series
+// that match the patterns, all names if there is no pattern.
+func (mc *Metrical) storedNames(id metric.SeriesID, patterns []string) ([]string, error) {
+	s, ok := mc.Storage.(interface {
+		MetricNames(metric.SeriesID) ([]string, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("unsupported store %q", mc.Data.Store)
+	}
+	names, err := s.MetricNames(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return names, nil
+	}
+	filter, err := metric.CompileIncludeAndExclude(patterns, nil, ':')
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(names, func(name string) bool { return !filter.Match(name) }), nil
+}
+
+// storedProducts calls fn with the stored products of the metrics matching the patterns.
+func (mc *Metrical) storedProducts(seriesID string, patterns []string, fn func(metric.SeriesID, string, []metric.Product) error) error {
+	if mc.Data.Store == "" {
+		return errors.New("data.store is not configured")
+	}
+	series, err := mc.storedSeries(seriesID)
+	if err != nil {
+		return err
+	}
+	closeStorage, err := mc.openStoredData()
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	for _, id := range series {
+		names, err := mc.storedNames(id, patterns)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			products, err := mc.Storage.Load(id, name)
+			if err != nil {
+				return fmt.Errorf("load %s of %s: %w", name, id.ID(), err)
+			}
+			if err := fn(id, name, products); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func queryCommand(args []string) error {
+	var seriesID string
+	var since time.Duration
+	var limit int
+	var format string
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	fs.StringVar(&seriesID, "series", "", "timeseries id, e.g. TS_1M, default all of data.timeseries")
+	fs.DurationVar(&since, "since", 0, "only the products of the duration, e.g. 1h")
+	fs.IntVar(&limit, "limit", 0, "the last number of products of each metric, 0 for all")
+	fs.StringVar(&format, "format", "table", "output format, table or ndjson")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: metrical query [flags] <metric>..., e.g. \"cpu:*\"")
+	}
+	if format != "table" && format != "ndjson" {
+		return fmt.Errorf("unknown format %q, table or ndjson", format)
+	}
+	mc, _, _, err := cf.load()
+	if err != nil {
+		return err
+	}
+	var tw *tabwriter.Writer
+	if format == "table" {
+		tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+	}
+	header := false
+	return mc.storedProducts(seriesID, fs.Args(), func(id metric.SeriesID, name string, products []metric.Product) error {
+		if since > 0 {
+			from := time.Now().Add(-since)
+			products = slices.DeleteFunc(products, func(pd metric.Product) bool { return pd.Time.Before(from) })
+		}
+		if limit > 0 && len(products) > limit {
+			products = products[len(products)-limit:]
+		}
+		for _, pd := range products {
+			if tw == nil {
+				pd.SeriesID = id.ID()
+				fmt.Println(pd.String())
+				continue
+			}
+			if !header {
+				fmt.Fprintln(tw, "SERIES\tNAME\tTIME\tTYPE\tVALUE")
+				header = true
+			}
+			value, _ := json.Marshal(pd.Value)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", id.ID(), name, pd.Time.Local().Format(time.RFC3339), pd.Type, value)
+		}
+		return nil
+	})
+}
+
+func exportCommand(args []string) error {
+	var seriesID string
+	var output string
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	fs.StringVar(&seriesID, "series", "", "timeseries id, e.g. TS_1M, default all of data.timeseries")
+	fs.StringVar(&output, "o", "-", "output file, \"-\" for stdout")
+	fs.Parse(args)
+	mc, _, _, err := cf.load()
+	if err != nil {
+		return err
+	}
+	w := io.Writer(os.Stdout)
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	return mc.storedProducts(seriesID, fs.Args(), func(id metric.SeriesID, name string, products []metric.Product) error {
+		for _, pd := range products {
+			pd.SeriesID = id.ID()
+			pd.SeriesTitle = id.Title()
+			pd.Period = id.Period()
+			if _, err := fmt.Fprintln(bw, pd.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
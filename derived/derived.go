@@ -0,0 +1,134 @@
+// Package derived computes the metrics of the expressions
+// over the latest values of the gathered metrics.
+package derived
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+// Config is a derived metric of the [[data.derived]] section.
+type Config struct {
+	// name of the derived metric, e.g. "mem:used_gb"
+	Name string `toml:"name"`
+	// expression, e.g. "mem:used / 1e9"
+	// or "sum(diskio:*:read_bytes) + sum(diskio:*:write_bytes)"
+	Expr string `toml:"expr"`
+	// metric type of the result, default "gauge"
+	Type string `toml:"type"`
+	// unit of the result, default "short"
+	Unit string `toml:"unit"`
+}
+
+type item struct {
+	name string
+	expr node
+	typ  metric.Type
+}
+
+// Derived records the latest values of the measurements as a processor,
+// and adds the results of the expressions as an input.
+// It should be added to the collector after all the other inputs,
+// so that the expressions are evaluated with the values of the same round.
+type Derived struct {
+	items []item
+
+	mu sync.Mutex
+	// latest is the values recorded since the last Gather,
+	// a metric that is not gathered anymore is not available.
+	latest map[string]float64
+	// results is the values of the derived metrics of the last Gather,
+	// they are referred by name but not matched by the patterns.
+	results map[string]float64
+}
+
+var _ registry.Processor = (*Derived)(nil)
+var _ metric.Input = (*Derived)(nil)
+
+// New compiles the expressions of the derived metrics.
+func New(configs []Config) (*Derived, error) {
+	ret := &Derived{latest: map[string]float64{}, results: map[string]float64{}}
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, errors.New("derived metric requires name")
+		}
+		if cfg.Expr == "" {
+			return nil, fmt.Errorf("derived metric %s requires expr", cfg.Name)
+		}
+		expr, err := parse(cfg.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", cfg.Name, err)
+		}
+		if cfg.Type == "" {
+			cfg.Type = "gauge"
+		}
+		if cfg.Unit == "" {
+			cfg.Unit = "short"
+		}
+		unit, err := registry.ParseUnit(cfg.Unit)
+		if err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", cfg.Name, err)
+		}
+		typ, err := registry.ParseType(cfg.Type, unit)
+		if err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", cfg.Name, err)
+		}
+		ret.items = append(ret.items, item{name: cfg.Name, expr: expr, typ: typ})
+	}
+	return ret, nil
+}
+
+// Apply records the values of the measurements,
+// the measurements are returned as they are.
+func (d *Derived) Apply(measures []metric.Measure) []metric.Measure {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, m := range measures {
+		d.latest[m.Name] = m.Value
+	}
+	return measures
+}
+
+// Gather evaluates the expressions in order, a derived metric can refer
+// the derived metrics defined before it. The metric is skipped
+// if any of the referred values is not available.
+// The recorded values are cleared, the next Gather evaluates
+// the values recorded until then.
+func (d *Derived) Gather(g *metric.Gather) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.results)
+	for _, it := range d.items {
+		v, ok := it.expr.eval(d)
+		if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		d.results[it.name] = v
+		g.Add(it.name, v, it.typ)
+	}
+	clear(d.latest)
+	return nil
+}
+
+func (d *Derived) value(name string) (float64, bool) {
+	if v, ok := d.results[name]; ok {
+		return v, ok
+	}
+	v, ok := d.latest[name]
+	return v, ok
+}
+
+func (d *Derived) values(filter metric.Filter) []float64 {
+	var ret []float64
+	for name, v := range d.latest {
+		if filter.Match(name) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
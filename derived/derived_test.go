@@ -0,0 +1,120 @@
+package derived
+
+import (
+	"testing"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	d := &Derived{latest: map[string]float64{
+		"mem:used":               2e9,
+		"diskio:sda:read_bytes":  10,
+		"diskio:sda:write_bytes": 20,
+		"diskio:sdb:read_bytes":  30,
+		"diskio:sdb:write_bytes": 40,
+		"cpu:cpu-total":          50,
+	}}
+	tests := []struct {
+		expr   string
+		expect float64
+		ok     bool
+	}{
+		{"mem:used / 1e9", 2, true},
+		{"mem:used/1e9*2", 4, true},
+		{"-(1 + 2) * 3", -9, true},
+		{"sum(diskio:*:read_bytes)+sum(diskio:*:write_bytes)", 100, true},
+		{"avg(diskio:*:read_bytes)", 20, true},
+		{"max(diskio:*:*_bytes)", 40, true},
+		{"min(diskio:*:*_bytes, 5)", 5, true},
+		{`"cpu:cpu-total" / 100`, 0.5, true},
+		{"sum(net:*:bytes_recv)", 0, true},
+		{"avg(net:*:bytes_recv)", 0, false},
+		{"mem:free / 1e9", 0, false},
+		{"mem:used / 0", 0, false},
+	}
+	for _, tt := range tests {
+		n, err := parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		v, ok := n.eval(d)
+		require.Equal(t, tt.ok, ok, tt.expr)
+		if ok {
+			require.InDelta(t, tt.expect, v, 1e-9, tt.expr)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"diskio:*:read_bytes * 2",
+		"mem:used +",
+		"(mem:used",
+		"stddev(mem:used)",
+		"sum()",
+		`"mem:used`,
+		"mem:used $ 2",
+	} {
+		_, err := parse(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestDerived(t *testing.T) {
+	d, err := New([]Config{
+		{Name: "mem:used_gb", Expr: "mem:used / 1e9"},
+		{Name: "mem:used_mb", Expr: "mem:used_gb * 1000", Type: "meter"},
+		{Name: "diskio:total_bytes", Expr: "sum(diskio:*:read_bytes) + sum(diskio:*:write_bytes)", Type: "odometer", Unit: "bytes"},
+	})
+	require.NoError(t, err)
+
+	// only the sum of nothing is gathered before the values are recorded
+	g := &metric.Gather{}
+	require.NoError(t, d.Gather(g))
+	require.Equal(t, []string{"diskio:total_bytes"}, gatheredNames(g))
+
+	measures := []metric.Measure{
+		{Name: "mem:used", Value: 3e9, Type: metric.GaugeType(metric.UnitBytes)},
+		{Name: "diskio:sda:read_bytes", Value: 10, Type: metric.OdometerType(metric.UnitBytes)},
+		{Name: "diskio:sda:write_bytes", Value: 20, Type: metric.OdometerType(metric.UnitBytes)},
+	}
+	require.Equal(t, measures, d.Apply(measures))
+
+	g = &metric.Gather{}
+	require.NoError(t, d.Gather(g))
+	require.Equal(t, []string{"mem:used_gb", "mem:used_mb", "diskio:total_bytes"}, gatheredNames(g))
+	require.Equal(t, 3.0, d.results["mem:used_gb"])
+	require.Equal(t, 3000.0, d.results["mem:used_mb"])
+	require.Equal(t, 30.0, d.results["diskio:total_bytes"])
+
+	// the values are of the last round, the results are not matched by the patterns
+	d.Apply([]metric.Measure{{Name: "diskio:sda:read_bytes", Value: 5, Type: metric.OdometerType(metric.UnitBytes)}})
+	total, err := New([]Config{{Name: "diskio:sum", Expr: "sum(diskio:*)"}})
+	require.NoError(t, err)
+	total.Apply([]metric.Measure{{Name: "diskio:sda:read_bytes", Value: 5, Type: metric.OdometerType(metric.UnitBytes)}})
+	g = &metric.Gather{}
+	require.NoError(t, total.Gather(g))
+	require.Equal(t, 5.0, g.Measures()[0].Value)
+	g = &metric.Gather{}
+	require.NoError(t, total.Gather(g))
+	require.Equal(t, 0.0, g.Measures()[0].Value)
+
+	g = &metric.Gather{}
+	require.NoError(t, d.Gather(g))
+	require.Equal(t, []string{"diskio:total_bytes"}, gatheredNames(g))
+	require.Equal(t, 5.0, g.Measures()[0].Value)
+
+	_, err = New([]Config{{Name: "x", Expr: "1", Unit: "liters"}})
+	require.Error(t, err)
+	_, err = New([]Config{{Name: "x", Expr: "1", Type: "summary"}})
+	require.Error(t, err)
+	_, err = New([]Config{{Name: "x"}})
+	require.Error(t, err)
+}
+
+func gatheredNames(g *metric.Gather) []string {
+	var ret []string
+	for _, m := range g.Measures() {
+		ret = append(ret, m.Name)
+	}
+	return ret
+}
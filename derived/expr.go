@@ -0,0 +1,385 @@
+package derived
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/OutOfBedlam/metric"
+)
+
+// env provides the current values of the metrics to the expression.
+type env interface {
+	// value returns the current value of the metric.
+	value(name string) (float64, bool)
+	// values returns the current values of the metrics matching the filter.
+	values(filter metric.Filter) []float64
+}
+
+// node is a node of the parsed expression,
+// eval returns false if any of the referred values is not available.
+type node interface {
+	eval(e env) (float64, bool)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(env) (float64, bool) { return float64(n), true }
+
+type nameNode string
+
+func (n nameNode) eval(e env) (float64, bool) { return e.value(string(n)) }
+
+// patternNode is the metric name with wildcards,
+// that is allowed only as an argument of the aggregate functions.
+type patternNode struct {
+	pattern string
+	filter  metric.Filter
+}
+
+func (n patternNode) eval(env) (float64, bool) { return 0, false }
+
+type negNode struct{ x node }
+
+func (n negNode) eval(e env) (float64, bool) {
+	v, ok := n.x.eval(e)
+	return -v, ok
+}
+
+type binaryNode struct {
+	op   byte
+	l, r node
+}
+
+func (n binaryNode) eval(e env) (float64, bool) {
+	l, ok := n.l.eval(e)
+	if !ok {
+		return 0, false
+	}
+	r, ok := n.r.eval(e)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+type funcNode struct {
+	fn   string
+	args []node
+}
+
+func (n funcNode) eval(e env) (float64, bool) {
+	var values []float64
+	for _, arg := range n.args {
+		if p, ok := arg.(patternNode); ok {
+			values = append(values, e.values(p.filter)...)
+			continue
+		}
+		v, ok := arg.eval(e)
+		if !ok {
+			return 0, false
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		// the sum of nothing is zero, the others are undefined
+		return 0, n.fn == "sum"
+	}
+	switch n.fn {
+	case "sum", "avg":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if n.fn == "avg" {
+			return sum / float64(len(values)), true
+		}
+		return sum, true
+	case "max":
+		ret := math.Inf(-1)
+		for _, v := range values {
+			ret = math.Max(ret, v)
+		}
+		return ret, true
+	default: // min
+		ret := math.Inf(1)
+		for _, v := range values {
+			ret = math.Min(ret, v)
+		}
+		return ret, true
+	}
+}
+
+// parse parses the expression of the arithmetic operators "+ - * /",
+// parentheses, numbers, metric names and the aggregate functions
+// "sum", "avg", "max" and "min" that accept the metric names with wildcards.
+// The metric names that contain the operators can be quoted with '"'.
+func parse(expr string) (node, error) {
+	p := &parser{src: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos].text, expr)
+	}
+	return n, nil
+}
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokName
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_:.*?[]", r)
+}
+
+func (p *parser) tokenize() error {
+	src := []rune(p.src)
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/(),", r) && !(r == '*' && i+1 < len(src) && isNameRune(src[i+1]) && p.lastIsOp()):
+			p.tokens = append(p.tokens, token{tokOp, string(r)})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				end++
+			}
+			if end >= len(src) {
+				return fmt.Errorf("unterminated quote in %q", p.src)
+			}
+			p.tokens = append(p.tokens, token{tokName, string(src[i+1 : end])})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && unicode.IsDigit(src[i+1])):
+			end := i
+			for end < len(src) && (unicode.IsDigit(src[end]) || src[end] == '.') {
+				end++
+			}
+			if end < len(src) && (src[end] == 'e' || src[end] == 'E') {
+				exp := end + 1
+				if exp < len(src) && (src[exp] == '+' || src[exp] == '-') {
+					exp++
+				}
+				if exp < len(src) && unicode.IsDigit(src[exp]) {
+					for exp < len(src) && unicode.IsDigit(src[exp]) {
+						exp++
+					}
+					end = exp
+				}
+			}
+			if end < len(src) && (unicode.IsLetter(src[end]) || src[end] == '_' || src[end] == ':') {
+				// a name that starts with digits
+				for end < len(src) && isNameRune(src[end]) {
+					end++
+				}
+				p.tokens = append(p.tokens, token{tokName, string(src[i:end])})
+			} else {
+				p.tokens = append(p.tokens, token{tokNumber, string(src[i:end])})
+			}
+			i = end
+		case isNameRune(r):
+			end := i
+			for end < len(src) && isNameRune(src[end]) {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokName, string(src[i:end])})
+			i = end
+		default:
+			return fmt.Errorf("unexpected %q in %q", r, p.src)
+		}
+	}
+	return nil
+}
+
+// lastIsOp reports whether the previous token is an operator or nothing,
+// where '*' starts a metric name pattern instead of the multiplication.
+func (p *parser) lastIsOp() bool {
+	return len(p.tokens) == 0 || (p.tokens[len(p.tokens)-1].kind == tokOp && p.tokens[len(p.tokens)-1].text != ")")
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) isOp(ops string) (string, bool) {
+	t, ok := p.peek()
+	if ok && t.kind == tokOp && strings.Contains(ops, t.text) {
+		p.pos++
+		return t.text, true
+	}
+	return "", false
+}
+
+func (p *parser) parseExpr() (node, error) {
+	l, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isOp("+-")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryNode{op: op[0], l: l, r: r}
+	}
+}
+
+func (p *parser) parseTerm() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isOp("*/")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryNode{op: op[0], l: l, r: r}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.isOp("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x}, nil
+	}
+	if _, ok := p.isOp("+"); ok {
+		return p.parseUnary()
+	}
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := n.(patternNode); ok {
+		return nil, fmt.Errorf("wildcard %q is allowed only in sum, avg, max or min of %q", n.(patternNode).pattern, p.src)
+	}
+	return n, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of %q", p.src)
+	}
+	p.pos++
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in %q", t.text, p.src)
+		}
+		return numberNode(f), nil
+	case tokName:
+		if _, ok := p.isOp("("); ok {
+			return p.parseFunc(t.text)
+		}
+		if metric.IsFilterPattern(t.text) {
+			filter, err := metric.CompileIncludeAndExclude([]string{t.text}, nil, ':')
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q in %q: %w", t.text, p.src, err)
+			}
+			return patternNode{pattern: t.text, filter: filter}, nil
+		}
+		return nameNode(t.text), nil
+	default:
+		if t.text == "(" {
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.isOp(")"); !ok {
+				return nil, fmt.Errorf("missing ')' in %q", p.src)
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("unexpected %q in %q", t.text, p.src)
+	}
+}
+
+func (p *parser) parseFunc(fn string) (node, error) {
+	fn = strings.ToLower(fn)
+	switch fn {
+	case "sum", "avg", "max", "min":
+	default:
+		return nil, fmt.Errorf("unknown function %q in %q", fn, p.src)
+	}
+	ret := funcNode{fn: fn}
+	if _, ok := p.isOp(")"); ok {
+		return nil, fmt.Errorf("%s() requires arguments in %q", fn, p.src)
+	}
+	for {
+		// a pattern argument is taken as is, otherwise an expression
+		var arg node
+		if t, ok := p.peek(); ok && t.kind == tokName && metric.IsFilterPattern(t.text) {
+			n, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			arg = n
+		} else {
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			arg = n
+		}
+		ret.args = append(ret.args, arg)
+		if _, ok := p.isOp(","); ok {
+			continue
+		}
+		if _, ok := p.isOp(")"); ok {
+			return ret, nil
+		}
+		return nil, fmt.Errorf("missing ')' in %q", p.src)
+	}
+}
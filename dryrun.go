@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+// testInputs gathers the inputs once and prints the measurements
+// as a table or ndjson, without the collector, the storage and the HTTP server.
+func testInputs(content string, inputs string, format string, w io.Writer) error {
+	var names []string
+	for _, name := range strings.Split(inputs, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if format != "table" && format != "ndjson" {
+		return fmt.Errorf("unknown format %q, table or ndjson", format)
+	}
+	results, err := registry.GatherInputs(content, names)
+	if err != nil {
+		return err
+	}
+	var failed int
+	if format == "ndjson" {
+		enc := json.NewEncoder(w)
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+				enc.Encode(map[string]any{"INPUT": r.Input, "ERROR": r.Err.Error()})
+				continue
+			}
+			for _, m := range r.Measures {
+				enc.Encode(map[string]any{"INPUT": r.Input, "NAME": m.Name, "TYPE": m.Type.Name(), "UNIT": m.Type.Unit(), "VALUE": m.Value})
+			}
+		}
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "INPUT\tNAME\tTYPE\tUNIT\tVALUE")
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+				fmt.Fprintf(tw, "%s\tERROR: %v\t\t\t\n", r.Input, r.Err)
+				continue
+			}
+			for _, m := range r.Measures {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Input, m.Name, m.Type.Name(), m.Type.Unit(), strconv.FormatFloat(m.Value, 'f', -1, 64))
+			}
+		}
+		tw.Flush()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d inputs failed", failed, len(results))
+	}
+	return nil
+}
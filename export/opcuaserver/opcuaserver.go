@@ -0,0 +1,416 @@
+package opcuaserver
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/input/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/server/attrs"
+	"github.com/gopcua/opcua/ua"
+)
+
+// Config is the configuration of the embedded OPC UA server.
+type Config struct {
+	// "host:port" to listen, e.g. "0.0.0.0:4840"
+	Listen string `toml:"listen"`
+	// namespace of the metric nodes, default "metrical"
+	Namespace string `toml:"namespace"`
+	// how often the node values are updated, default 1s
+	UpdateInterval time.Duration `toml:"update_interval"`
+	// certificate and private key files (PEM or DER) enable
+	// "Basic256Sha256" security policy with "Sign" and "SignAndEncrypt" modes
+	Certificate string `toml:"certificate"`
+	PrivateKey  string `toml:"private_key"`
+	// disables "None" security mode, it requires the certificate
+	SecureOnly bool         `toml:"secure_only"`
+	Filter     FilterConfig `toml:"filter"`
+}
+
+type FilterConfig struct {
+	Includes []string `toml:"includes"`
+	Excludes []string `toml:"excludes"`
+}
+
+// Server publishes the latest value of each metric of the collector,
+// and the aggregated values of each series as variable nodes.
+//
+// Node IDs are strings in the namespace:
+//
+//	<metric>                    - latest value
+//	<metric>/<SERIES_ID>/<field> - aggregated value of the series, e.g. "cpu:percent/TS_1M/avg"
+type Server struct {
+	cfg       Config
+	collector *metric.Collector
+	filter    metric.Filter
+	srv       *server.Server
+	ready     atomic.Bool
+	ns        *server.NodeNameSpace
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+
+	mu     sync.RWMutex
+	values map[string]*ua.DataValue
+	nodes  map[string]*server.Node
+}
+
+func New(c *metric.Collector, cfg Config) (*Server, error) {
+	if cfg.Listen == "" {
+		return nil, errors.New("opcua_server listen is required")
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = "metrical"
+	}
+	if cfg.UpdateInterval <= 0 {
+		cfg.UpdateInterval = time.Second
+	}
+	s := &Server{
+		cfg:       cfg,
+		collector: c,
+		values:    map[string]*ua.DataValue{},
+		nodes:     map[string]*server.Node{},
+	}
+	if len(cfg.Filter.Includes) > 0 || len(cfg.Filter.Excludes) > 0 {
+		filter, err := metric.CompileIncludeAndExclude(cfg.Filter.Includes, cfg.Filter.Excludes, ':')
+		if err != nil {
+			return nil, fmt.Errorf("error compiling opcua_server filter: %w", err)
+		}
+		s.filter = filter
+	}
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	s.srv = server.New(opts...)
+	s.ns = server.NewNodeNameSpace(s.srv, cfg.Namespace)
+	root, err := s.srv.Namespace(0)
+	if err != nil {
+		return nil, err
+	}
+	root.Objects().AddRef(s.ns.Objects(), id.HasComponent, true)
+	s.ready.Store(true)
+	return s, nil
+}
+
+func (s *Server) options() ([]server.Option, error) {
+	host, portStr, err := net.SplitHostPort(s.cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opcua_server listen %q: %w", s.cfg.Listen, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opcua_server listen %q: %w", s.cfg.Listen, err)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	opts := []server.Option{
+		server.EndPoint(host, port),
+		server.ServerName("metrical"),
+		server.ProductName("metrical"),
+		server.ManufacturerName("metrical"),
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+		server.SetLogger(logger{ready: &s.ready}),
+	}
+	// advertise the host name besides the unspecified address
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if hostname, err := os.Hostname(); err == nil {
+			opts = append(opts, server.EndPoint(hostname, port))
+		}
+	}
+	if !s.cfg.SecureOnly {
+		opts = append(opts, server.EnableSecurity("None", ua.MessageSecurityModeNone))
+	}
+	if s.cfg.Certificate != "" || s.cfg.PrivateKey != "" {
+		cert, key, err := loadKeyPair(s.cfg.Certificate, s.cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			server.Certificate(cert),
+			server.PrivateKey(key),
+			server.EnableSecurity("Basic256Sha256", ua.MessageSecurityModeSign),
+			server.EnableSecurity("Basic256Sha256", ua.MessageSecurityModeSignAndEncrypt),
+		)
+	} else if s.cfg.SecureOnly {
+		return nil, errors.New("opcua_server secure_only requires certificate and private_key")
+	}
+	return opts, nil
+}
+
+// Endpoints returns the endpoint URLs of the server.
+func (s *Server) Endpoints() []string {
+	return s.srv.URLs()
+}
+
+func (s *Server) Start() error {
+	if err := s.srv.Start(context.Background()); err != nil {
+		return err
+	}
+	s.update()
+	s.closeCh = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.cfg.UpdateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.closeCh:
+				return
+			case <-ticker.C:
+				s.update()
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop() {
+	if s.closeCh == nil {
+		return
+	}
+	close(s.closeCh)
+	s.wg.Wait()
+	s.closeCh = nil
+	if err := s.srv.Close(); err != nil {
+		slog.Debug("error closing OPC UA server", "error", err)
+	}
+}
+
+// update refreshes the values of the nodes,
+// the nodes of the new metrics are added.
+func (s *Server) update() {
+	names := s.collector.MetricNames()
+	slices.Sort(names)
+	var changed []*ua.NodeID
+	for _, name := range names {
+		if s.filter != nil && !s.filter.Match(name) {
+			continue
+		}
+		for i, ts := range s.collector.Timeseries(name) {
+			tm, value := ts.Last()
+			if value == nil {
+				continue
+			}
+			info, ok := ts.Meta().(metric.SeriesInfo)
+			if !ok {
+				continue
+			}
+			if i == 0 {
+				if v, ok := latest(value); ok {
+					changed = append(changed, s.set(name, []string{name}, "value", v, tm))
+				}
+			}
+			seriesID := info.SeriesID.ID()
+			for _, f := range fields(value) {
+				key := name + "/" + seriesID + "/" + f.name
+				changed = append(changed, s.set(key, []string{name, seriesID}, f.name, f.value, tm))
+			}
+		}
+	}
+	for _, nodeID := range changed {
+		s.ns.ChangeNotification(nodeID)
+	}
+}
+
+// set updates the value of the variable node of the key,
+// the node is created under the folders if it does not exist.
+func (s *Server) set(key string, folders []string, browseName string, value float64, tm time.Time) *ua.NodeID {
+	s.mu.Lock()
+	s.values[key] = &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueSourceTimestamp | ua.DataValueServerTimestamp,
+		Value:           ua.MustVariant(value),
+		SourceTimestamp: tm,
+		ServerTimestamp: time.Now(),
+	}
+	n, exists := s.nodes[key]
+	s.mu.Unlock()
+	if exists {
+		return n.ID()
+	}
+
+	parent := s.ns.Objects()
+	folderKey := ""
+	for _, f := range folders {
+		folderKey += f + "/"
+		parent = s.folder(parent, folderKey, f)
+	}
+	n = server.NewNode(
+		ua.NewStringNodeID(s.ns.ID(), key),
+		map[ua.AttributeID]*ua.DataValue{
+			ua.AttributeIDNodeClass:       server.DataValueFromValue(attrs.NodeClass(ua.NodeClassVariable)),
+			ua.AttributeIDBrowseName:      server.DataValueFromValue(attrs.BrowseName(browseName)),
+			ua.AttributeIDDisplayName:     server.DataValueFromValue(attrs.DisplayName(browseName, "")),
+			ua.AttributeIDDataType:        server.DataValueFromValue(ua.NewNumericExpandedNodeID(0, id.Double)),
+			ua.AttributeIDAccessLevel:     server.DataValueFromValue(byte(ua.AccessLevelTypeCurrentRead)),
+			ua.AttributeIDUserAccessLevel: server.DataValueFromValue(byte(ua.AccessLevelTypeCurrentRead)),
+		},
+		nil,
+		func() *ua.DataValue {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			return s.values[key]
+		},
+	)
+	s.ns.AddNode(n)
+	parent.AddRef(n, id.HasComponent, true)
+	s.mu.Lock()
+	s.nodes[key] = n
+	s.mu.Unlock()
+	return n.ID()
+}
+
+// folder returns the folder node of the key under the parent,
+// it creates the folder if it does not exist.
+func (s *Server) folder(parent *server.Node, key string, browseName string) *server.Node {
+	s.mu.RLock()
+	n, exists := s.nodes[key]
+	s.mu.RUnlock()
+	if exists {
+		return n
+	}
+	n = server.NewNode(
+		ua.NewStringNodeID(s.ns.ID(), key),
+		map[ua.AttributeID]*ua.DataValue{
+			ua.AttributeIDNodeClass:   server.DataValueFromValue(attrs.NodeClass(ua.NodeClassObject)),
+			ua.AttributeIDBrowseName:  server.DataValueFromValue(attrs.BrowseName(browseName)),
+			ua.AttributeIDDisplayName: server.DataValueFromValue(attrs.DisplayName(browseName, "")),
+			ua.AttributeIDDataType:    server.DataValueFromValue(ua.NewNumericExpandedNodeID(0, id.FolderType)),
+		},
+		nil,
+		nil,
+	)
+	s.ns.AddNode(n)
+	parent.AddRef(n, id.Organizes, true)
+	s.mu.Lock()
+	s.nodes[key] = n
+	s.mu.Unlock()
+	return n
+}
+
+type field struct {
+	name  string
+	value float64
+}
+
+// latest returns the representative value of the metric value.
+func latest(v metric.Value) (float64, bool) {
+	switch p := v.(type) {
+	case *metric.CounterValue:
+		return p.Value, true
+	case *metric.GaugeValue:
+		return p.Value, true
+	case *metric.MeterValue:
+		return p.Last, p.Samples > 0
+	case *metric.OdometerValue:
+		return p.Last, p.Samples > 0
+	case *metric.HistogramValue:
+		// the median, or the percentile nearest to it if p50 is not configured
+		best := -1
+		for i, pct := range p.P {
+			if i < len(p.Values) && (best < 0 || math.Abs(pct-0.5) < math.Abs(p.P[best]-0.5)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		return p.Values[best], true
+	case *metric.TimerValue:
+		if p.Samples == 0 {
+			return 0, false
+		}
+		return (p.Sum / time.Duration(p.Samples)).Seconds(), true
+	default:
+		return 0, false
+	}
+}
+
+// fields returns the aggregated values of the metric value,
+// durations are in seconds.
+func fields(v metric.Value) []field {
+	switch p := v.(type) {
+	case *metric.CounterValue:
+		return []field{{"value", p.Value}, {"samples", float64(p.Samples)}}
+	case *metric.GaugeValue:
+		avg := 0.0
+		if p.Samples > 0 {
+			avg = p.Sum / float64(p.Samples)
+		}
+		return []field{{"value", p.Value}, {"avg", avg}, {"samples", float64(p.Samples)}}
+	case *metric.MeterValue:
+		avg := 0.0
+		if p.Samples > 0 {
+			avg = p.Sum / float64(p.Samples)
+		}
+		return []field{{"first", p.First}, {"last", p.Last}, {"min", p.Min}, {"max", p.Max},
+			{"avg", avg}, {"samples", float64(p.Samples)}}
+	case *metric.OdometerValue:
+		return []field{{"first", p.First}, {"last", p.Last}, {"diff", p.Diff()}, {"samples", float64(p.Samples)}}
+	case *metric.HistogramValue:
+		ret := []field{{"samples", float64(p.Samples)}}
+		for i, pct := range p.P {
+			if i < len(p.Values) {
+				ret = append(ret, field{"p" + strconv.FormatFloat(pct*100, 'f', -1, 64), p.Values[i]})
+			}
+		}
+		return ret
+	case *metric.TimerValue:
+		avg := 0.0
+		if p.Samples > 0 {
+			avg = (p.Sum / time.Duration(p.Samples)).Seconds()
+		}
+		return []field{{"avg", avg}, {"min", p.Min.Seconds()}, {"max", p.Max.Seconds()},
+			{"sum", p.Sum.Seconds()}, {"samples", float64(p.Samples)}}
+	default:
+		return nil
+	}
+}
+
+func loadKeyPair(certFile, keyFile string) ([]byte, *rsa.PrivateKey, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, nil, errors.New("opcua_server requires both certificate and private_key")
+	}
+	cert, err := opcua.LoadCertificate(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := opcua.LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// logger formats the messages of the server in printf style,
+// the messages of the server are too chatty for the info level.
+// The errors before the server is ready are the duplicated reference types
+// of the standard nodeset, that are reported while importing it.
+type logger struct {
+	ready *atomic.Bool
+}
+
+func (l logger) Debug(msg string, args ...any) { slog.Debug(fmt.Sprintf(msg, args...)) }
+func (l logger) Info(msg string, args ...any)  { slog.Debug(fmt.Sprintf(msg, args...)) }
+func (l logger) Warn(msg string, args ...any)  { slog.Warn(fmt.Sprintf(msg, args...)) }
+func (l logger) Error(msg string, args ...any) {
+	if !l.ready.Load() {
+		slog.Debug(fmt.Sprintf(msg, args...))
+		return
+	}
+	slog.Error(fmt.Sprintf(msg, args...))
+}
@@ -0,0 +1,113 @@
+package opcuaserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+	require.NoError(t, c.AddInputFunc(func(g *metric.Gather) error {
+		g.Add("test:gauge", 10, metric.GaugeType(metric.UnitShort))
+		g.Add("test:meter", 3, metric.MeterType(metric.UnitShort))
+		g.Add("test:excluded", 1, metric.GaugeType(metric.UnitShort))
+		return nil
+	}))
+
+	s, err := New(c, Config{
+		Listen:         fmt.Sprintf("127.0.0.1:%d", port),
+		UpdateInterval: 50 * time.Millisecond,
+		Filter:         FilterConfig{Excludes: []string{"test:excluded"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	ctx := context.Background()
+	client, err := opcua.NewClient(s.Endpoints()[0], opcua.SecurityMode(ua.MessageSecurityModeNone))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(ctx))
+	defer client.Close(ctx)
+
+	ns := s.ns.ID()
+	read := func(key string) (float64, ua.StatusCode) {
+		rsp, err := client.Read(ctx, &ua.ReadRequest{NodesToRead: []*ua.ReadValueID{
+			{NodeID: ua.NewStringNodeID(ns, key), AttributeID: ua.AttributeIDValue},
+		}})
+		require.NoError(t, err)
+		if rsp.Results[0].Status != ua.StatusOK {
+			return 0, rsp.Results[0].Status
+		}
+		return rsp.Results[0].Value.Float(), ua.StatusOK
+	}
+
+	v, status := read("test:gauge")
+	require.Equal(t, ua.StatusOK, status)
+	require.Equal(t, 10.0, v)
+	v, status = read("test:meter/TS_1H/max")
+	require.Equal(t, ua.StatusOK, status)
+	require.Equal(t, 3.0, v)
+	v, status = read("test:meter/TS_1H/samples")
+	require.Equal(t, ua.StatusOK, status)
+	require.Equal(t, 1.0, v)
+	_, status = read("test:excluded")
+	require.NotEqual(t, ua.StatusOK, status)
+
+	// metric folders are organized under the namespace objects
+	refs, err := client.Node(ua.NewNumericNodeID(ns, id.ObjectsFolder)).References(ctx, id.HierarchicalReferences,
+		ua.BrowseDirectionForward, ua.NodeClassAll, true)
+	require.NoError(t, err)
+	names := []string{}
+	for _, ref := range refs {
+		names = append(names, ref.BrowseName.Name)
+	}
+	require.ElementsMatch(t, []string{"test:gauge", "test:meter"}, names)
+
+	// the nodes are read-only
+	rsp, err := client.Write(ctx, &ua.WriteRequest{NodesToWrite: []*ua.WriteValue{{
+		NodeID:      ua.NewStringNodeID(ns, "test:gauge"),
+		AttributeID: ua.AttributeIDValue,
+		Value:       &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(1.0)},
+	}}})
+	require.NoError(t, err)
+	require.NotEqual(t, ua.StatusOK, rsp.Results[0])
+}
+
+func TestFields(t *testing.T) {
+	v, ok := latest(&metric.MeterValue{Samples: 2, Sum: 4, First: 1, Last: 3, Min: 1, Max: 3})
+	require.True(t, ok)
+	require.Equal(t, 3.0, v)
+	_, ok = latest(&metric.MeterValue{})
+	require.False(t, ok)
+	v, ok = latest(&metric.HistogramValue{Samples: 10, P: []float64{0.9, 0.5, 0.99}, Values: []float64{8, 5, 9}})
+	require.True(t, ok)
+	require.Equal(t, 5.0, v)
+	v, ok = latest(&metric.HistogramValue{Samples: 10, P: []float64{0.9, 0.99, 0.999}, Values: []float64{8, 9, 10}})
+	require.True(t, ok)
+	require.Equal(t, 8.0, v)
+	_, ok = latest(&metric.HistogramValue{})
+	require.False(t, ok)
+
+	require.Equal(t, []field{{"first", 1}, {"last", 3}, {"diff", 2}, {"samples", 2}},
+		fields(&metric.OdometerValue{First: 1, Last: 3, Samples: 2}))
+	require.Equal(t, []field{{"samples", 10}, {"p50", 5}, {"p99", 9}},
+		fields(&metric.HistogramValue{Samples: 10, P: []float64{0.5, 0.99}, Values: []float64{5, 9}}))
+	require.Equal(t, []field{{"avg", 2}, {"min", 1}, {"max", 3}, {"sum", 4}, {"samples", 2}},
+		fields(&metric.TimerValue{Samples: 2, Sum: 4 * time.Second, Min: time.Second, Max: 3 * time.Second}))
+}
@@ -0,0 +1,283 @@
+// Package ingest receives the products that the other metricals forward
+// with [[output.metrical]], so that a central metrical collects
+// the metrics of many hosts.
+//
+// The products are posted as ndjson, one [Record] per line,
+// and the "host" tag of each record names the host that gathered it.
+// The products are merged to the collector as the measurements
+// named "host:<host>:<metric>", e.g. "host:web1:cpu:cpu_all".
+// The collector aggregates them in its current period, so the products
+// older than the max age, e.g. the backlog of an edge that could not
+// reach the central metrical, are dropped.
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+// HostPrefix is the prefix of the names of the ingested metrics.
+const HostPrefix = "host:"
+
+// MetricName returns the name of the metric of the host.
+func MetricName(host, name string) string {
+	return HostPrefix + host + ":" + name
+}
+
+// SplitName returns the host and the name of the metric of the host,
+// ok is false if the metric is not ingested.
+func SplitName(name string) (host, metricName string, ok bool) {
+	rest, ok := strings.CutPrefix(name, HostPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+var validHost = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidHost reports whether the host can be a part of the metric names.
+func ValidHost(host string) bool {
+	return validHost.MatchString(host)
+}
+
+// Record is a line of the ingest request, the product with its tags.
+type Record struct {
+	metric.Product
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// UnmarshalJSON decodes the value of the product by its type.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name        string            `json:"name"`
+		Time        time.Time         `json:"ts"`
+		Value       json.RawMessage   `json:"value"`
+		IsNull      bool              `json:"isNull"`
+		SeriesID    string            `json:"series_id"`
+		SeriesTitle string            `json:"series_title"`
+		Period      time.Duration     `json:"period"`
+		Type        string            `json:"type"`
+		Unit        metric.Unit       `json:"unit"`
+		Tags        map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = Record{
+		Product: metric.Product{
+			Name:        raw.Name,
+			Time:        raw.Time,
+			IsNull:      raw.IsNull,
+			SeriesID:    raw.SeriesID,
+			SeriesTitle: raw.SeriesTitle,
+			Period:      raw.Period,
+			Type:        raw.Type,
+			Unit:        raw.Unit,
+		},
+		Tags: raw.Tags,
+	}
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+	value, err := decodeValue(raw.Type, raw.Value)
+	if err != nil {
+		return err
+	}
+	r.Value = value
+	return nil
+}
+
+func decodeValue(typ string, data json.RawMessage) (metric.Value, error) {
+	var value metric.Value
+	switch typ {
+	case "counter":
+		value = &metric.CounterValue{}
+	case "gauge":
+		value = &metric.GaugeValue{}
+	case "meter":
+		value = &metric.MeterValue{}
+	case "odometer":
+		value = &metric.OdometerValue{}
+	case "histogram":
+		value = &metric.HistogramValue{}
+	case "timer":
+		value = &metric.TimerValue{}
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	// the derived values are of the edge, they are derived again by the collector
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["derived"]; ok {
+		delete(fields, "derived")
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Stale reports whether the period of the product ended
+// more than maxAge before now.
+func (r Record) Stale(now time.Time, maxAge time.Duration) bool {
+	if r.Time.IsZero() || maxAge <= 0 {
+		return false
+	}
+	return now.Sub(r.Time.Add(r.Period)) > maxAge
+}
+
+// Host is a host whose metrics are ingested.
+type Host struct {
+	Name     string    `json:"name"`
+	Metrics  int       `json:"metrics"`
+	LastSeen time.Time `json:"last_seen,omitzero"`
+}
+
+// Handler serves the ingest requests,
+// it merges the products to the collector and records their tags.
+type Handler struct {
+	// MaxAge is the age of the products that are dropped,
+	// the age is of the end of the period of the product.
+	// Zero keeps all products.
+	MaxAge time.Duration
+
+	collector *metric.Collector
+	tags      *registry.Tags
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+// MaxLineSize is the maximum size of a line of the ingest request.
+const MaxLineSize = 1024 * 1024
+
+// DefaultMaxAge is the MaxAge of the handler, it is longer than
+// the flush interval and the timeout of [[output.metrical]] together.
+const DefaultMaxAge = time.Minute
+
+// NewHandler returns the handler that ingests to the collector,
+// tags can be nil.
+func NewHandler(c *metric.Collector, tags *registry.Tags) *Handler {
+	return &Handler{MaxAge: DefaultMaxAge, collector: c, tags: tags, lastSeen: map[string]time.Time{}}
+}
+
+// errStale is the error of the stale record, that is dropped without reporting.
+var errStale = errors.New("stale")
+
+// ServeHTTP ingests the records of the request body.
+// The valid records are ingested even if the others are invalid,
+// the response is 400 Bad Request with the errors of the invalid records.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var errs []error
+	var stale int
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if err := h.ingest(line); errors.Is(err, errStale) {
+			stale++
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNo, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if stale > 0 {
+		slog.Warn("Ingest dropped stale products", "remote", r.RemoteAddr, "dropped", stale, "max_age", h.MaxAge)
+	}
+	if len(errs) > 0 {
+		slog.Warn("Ingest", "remote", r.RemoteAddr, "errors", len(errs), "error", errs[0])
+		http.Error(w, errors.Join(errs...).Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ingest(line []byte) error {
+	var rec Record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return err
+	}
+	host := rec.Tags["host"]
+	if host == "" {
+		return errors.New("no host tag")
+	}
+	if !ValidHost(host) {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	if rec.Name == "" {
+		return errors.New("no name")
+	}
+	now := time.Now()
+	h.mu.Lock()
+	h.lastSeen[host] = now
+	h.mu.Unlock()
+	if rec.IsNull || rec.Value == nil {
+		return nil
+	}
+	if rec.Stale(now, h.MaxAge) {
+		return errStale
+	}
+	typ, err := registry.ParseType(rec.Type, rec.Unit)
+	if err != nil {
+		return err
+	}
+	name := MetricName(host, rec.Name)
+	if h.tags != nil {
+		h.tags.Record(rec.Tags, metric.Measure{Name: name, Type: typ})
+	}
+	return h.collector.Merge(name, typ, rec.Value)
+}
+
+// Hosts returns the hosts whose metrics are in the collector sorted by the name.
+func (h *Handler) Hosts() []Host {
+	counts := map[string]int{}
+	for _, name := range h.collector.MetricNames() {
+		if host, _, ok := SplitName(name); ok {
+			counts[host]++
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := make([]Host, 0, len(counts))
+	for name, n := range counts {
+		ret = append(ret, Host{Name: name, Metrics: n, LastSeen: h.lastSeen[name]})
+	}
+	slices.SortFunc(ret, func(a, b Host) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
+
+// ServeHosts responds the hosts as json.
+func (h *Handler) ServeHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Hosts())
+}
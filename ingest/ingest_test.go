@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC)
+	tests := []struct {
+		value metric.Value
+		typ   string
+	}{
+		{value: &metric.CounterValue{Samples: 3, Value: 12}, typ: "counter"},
+		{value: &metric.GaugeValue{Samples: 2, Sum: 3, Value: 2}, typ: "gauge"},
+		{value: &metric.MeterValue{Samples: 4, Sum: 10, First: 1, Last: 4, Min: 1, Max: 5}, typ: "meter"},
+		{value: &metric.OdometerValue{Samples: 2, First: 100, Last: 150}, typ: "odometer"},
+		{value: &metric.HistogramValue{Samples: 9, P: []float64{0.5, 0.99}, Values: []float64{10, 20}}, typ: "histogram"},
+		{value: &metric.TimerValue{Samples: 2, Sum: 3 * time.Second, Min: time.Second, Max: 2 * time.Second}, typ: "timer"},
+	}
+	for _, tt := range tests {
+		pd := metric.Product{Name: "app:x", Time: ts, Value: tt.value, Type: tt.typ, Unit: metric.UnitShort, Period: 10 * time.Second}
+		b, err := json.Marshal(Record{Product: pd, Tags: map[string]string{"host": "web1"}})
+		require.NoError(t, err)
+
+		var rec Record
+		require.NoError(t, json.Unmarshal(b, &rec), string(b))
+		require.Equal(t, pd, rec.Product)
+		require.Equal(t, "web1", rec.Tags["host"])
+		require.False(t, rec.Stale(ts.Add(time.Minute), time.Minute))
+		require.True(t, rec.Stale(ts.Add(time.Minute+11*time.Second), time.Minute))
+		require.False(t, rec.Stale(ts.Add(time.Hour), 0))
+	}
+
+	var rec Record
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"a","type":"gauge","value":{"samples":1,"sum":1,"value":1,"derived":{"ma":{"x":1}}}}`), &rec))
+	require.Equal(t, &metric.GaugeValue{Samples: 1, Sum: 1, Value: 1}, rec.Value)
+	require.Error(t, json.Unmarshal([]byte(`{"name":"a","type":"unknown","value":{}}`), &rec))
+}
+
+func TestSplitName(t *testing.T) {
+	host, name, ok := SplitName(MetricName("web1", "cpu:cpu_all"))
+	require.True(t, ok)
+	require.Equal(t, "web1", host)
+	require.Equal(t, "cpu:cpu_all", name)
+	_, _, ok = SplitName("cpu:cpu_all")
+	require.False(t, ok)
+
+	require.True(t, ValidHost("web-1.example"))
+	require.False(t, ValidHost(""))
+	require.False(t, ValidHost("web:1"))
+	require.False(t, ValidHost("web*"))
+}
+
+func TestHandler(t *testing.T) {
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+	tags := registry.NewTags(map[string]string{"site": "central"})
+	h := NewHandler(c, tags)
+
+	ts := time.Now().Add(-10 * time.Second).UTC().Format(time.RFC3339)
+	body := strings.Join([]string{
+		`{"name":"cpu:percent","ts":"` + ts + `","period":10000000000,"type":"gauge","unit":"Percent","value":{"samples":1,"sum":12,"value":12},"tags":{"host":"web1"}}`,
+		``,
+		`{"name":"http:requests","ts":"` + ts + `","period":10000000000,"type":"counter","value":{"samples":1,"value":3},"tags":{"host":"web2","site":"edge"}}`,
+		`{"name":"http:latency","ts":"` + ts + `","period":10000000000,"type":"meter","value":{"samples":4,"sum":10,"first":1,"last":4,"min":1,"max":5},"tags":{"host":"web2"}}`,
+		`{"name":"http:latency","ts":"` + ts + `","period":10000000000,"type":"meter","value":{"samples":2,"sum":1,"first":0.5,"last":0.5,"min":0.5,"max":0.5},"tags":{"host":"web2"}}`,
+		`{"name":"http:errors","ts":"2025-01-02T03:04:00Z","period":10000000000,"type":"counter","value":{"samples":1,"value":3},"tags":{"host":"web2"}}`,
+	}, "\n")
+	rsp := httptest.NewRecorder()
+	h.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/api/v1/ingest", strings.NewReader(body)))
+	require.Equal(t, http.StatusNoContent, rsp.Code)
+
+	require.ElementsMatch(t, []string{"host:web1:cpu:percent", "host:web2:http:requests", "host:web2:http:latency"}, c.MetricNames())
+	// the products of the edge are merged, not sampled again
+	_, v := c.Timeseries("host:web2:http:latency")[0].Last()
+	require.Equal(t, &metric.MeterValue{Samples: 6, Sum: 11, First: 1, Last: 0.5, Min: 0.5, Max: 5}, v)
+	require.Equal(t, map[string]string{"site": "central", "host": "web1"}, tags.Lookup("host:web1:cpu:percent"))
+	require.Equal(t, map[string]string{"site": "edge", "host": "web2"}, tags.Lookup("host:web2:http:requests"))
+
+	hosts := h.Hosts()
+	require.Len(t, hosts, 2)
+	require.Equal(t, "web1", hosts[0].Name)
+	require.Equal(t, 1, hosts[0].Metrics)
+	require.False(t, hosts[0].LastSeen.IsZero())
+	require.Equal(t, "web2", hosts[1].Name)
+
+	// the invalid lines are reported, the valid lines are ingested
+	body = strings.Join([]string{
+		`{"name":"cpu:percent","type":"gauge","value":{"value":1}}`,
+		`not json`,
+		`{"name":"mem:percent","type":"gauge","value":{"value":1},"tags":{"host":"web1"}}`,
+	}, "\n")
+	rsp = httptest.NewRecorder()
+	h.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/api/v1/ingest", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, rsp.Code)
+	require.Contains(t, rsp.Body.String(), "line 1: no host tag")
+	require.Contains(t, rsp.Body.String(), "line 2:")
+	require.Contains(t, c.MetricNames(), "host:web1:mem:percent")
+
+	rsp = httptest.NewRecorder()
+	h.ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/api/v1/ingest", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rsp.Code)
+
+	rsp = httptest.NewRecorder()
+	h.ServeHosts(rsp, httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil))
+	var result []Host
+	require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &result))
+	require.Equal(t, "web1", result[0].Name)
+	require.Equal(t, 2, result[0].Metrics)
+	require.Equal(t, 2, result[1].Metrics)
+}
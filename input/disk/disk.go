@@ -25,6 +25,10 @@ func (d *Disk) SampleConfig() string {
 	return diskSampleConfig
 }
 
+func (d *Disk) Description() string {
+	return "Disk usage of mount points"
+}
+
 var _ metric.Input = (*Disk)(nil)
 
 type Disk struct {
@@ -21,6 +21,10 @@ func (d *DiskIO) SampleConfig() string {
 	return diskioSampleConfig
 }
 
+func (d *DiskIO) Description() string {
+	return "Disk I/O counters of block devices"
+}
+
 var _ metric.Input = (*DiskIO)(nil)
 
 type DiskIO struct {
@@ -0,0 +1,266 @@
+package execd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+	"github.com/OutOfBedlam/metrical/supervisor"
+)
+
+func init() {
+	registry.Register("execd", (*Execd)(nil))
+}
+
+//go:embed "execd.toml"
+var execdSampleConfig string
+
+func (e *Execd) SampleConfig() string {
+	return execdSampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Measurements streamed by a long-running child process"
+}
+
+var _ metric.Input = (*Execd)(nil)
+var _ registry.Pusher = (*Execd)(nil)
+
+type Execd struct {
+	Command         []string      `toml:"command"`
+	Environment     []string      `toml:"environment"`
+	DataFormat      string        `toml:"data_format"`
+	Signal          string        `toml:"signal"`
+	Type            string        `toml:"type"`
+	Unit            string        `toml:"unit"`
+	RestartDelay    time.Duration `toml:"restart_delay"`
+	MaxRestartDelay time.Duration `toml:"max_restart_delay"`
+
+	push    func(...metric.Measure)
+	typ     metric.Type
+	parse   func(line []byte) ([]metric.Measure, error)
+	process *supervisor.Process
+}
+
+func (e *Execd) SetPush(push func(...metric.Measure)) {
+	e.push = push
+}
+
+func (e *Execd) Init() error {
+	if e.Type == "" {
+		e.Type = "gauge"
+	}
+	if e.Unit == "" {
+		e.Unit = "short"
+	}
+	unit, err := registry.ParseUnit(e.Unit)
+	if err != nil {
+		return err
+	}
+	if e.typ, err = registry.ParseType(e.Type, unit); err != nil {
+		return err
+	}
+	switch e.DataFormat {
+	case "", "ndjson":
+		e.parse = e.parseJSON
+	case "line":
+		e.parse = e.parseLine
+	default:
+		return fmt.Errorf("unknown data_format %q, ndjson or line", e.DataFormat)
+	}
+	switch e.Signal {
+	case "", "none", "stdin":
+	default:
+		return fmt.Errorf("unknown signal %q, none or stdin", e.Signal)
+	}
+	e.process = &supervisor.Process{
+		Command:         e.Command,
+		Environment:     e.Environment,
+		RestartDelay:    e.RestartDelay,
+		MaxRestartDelay: e.MaxRestartDelay,
+		OnStdout:        e.onStdout,
+	}
+	return e.process.Start()
+}
+
+func (e *Execd) DeInit() error {
+	if e.process != nil {
+		e.process.Stop()
+	}
+	return nil
+}
+
+// Gather asks the child for the measurements if the signal is "stdin",
+// the measurements are pushed when the child writes them.
+func (e *Execd) Gather(g *metric.Gather) error {
+	if e.Signal != "stdin" {
+		return nil
+	}
+	return e.process.Write([]byte("\n"))
+}
+
+func (e *Execd) onStdout(line []byte) {
+	measures, err := e.parse(line)
+	if err != nil {
+		slog.Warn("execd invalid line", "command", e.Command[0], "error", err)
+		return
+	}
+	if e.push != nil && len(measures) > 0 {
+		e.push(measures...)
+	}
+}
+
+// jsonMeasure is a line of the ndjson format,
+// the type and the unit default to the type and the unit of the config.
+type jsonMeasure struct {
+	Name  string   `json:"name"`
+	Value *float64 `json:"value"`
+	Type  string   `json:"type"`
+	Unit  string   `json:"unit"`
+}
+
+func (e *Execd) parseJSON(line []byte) ([]metric.Measure, error) {
+	var m jsonMeasure
+	if err := json.Unmarshal(line, &m); err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	if m.Value == nil {
+		return nil, fmt.Errorf("missing value of %s", m.Name)
+	}
+	typ := e.typ
+	if m.Type != "" || m.Unit != "" {
+		unit := typ.Unit()
+		if m.Unit != "" {
+			u, err := registry.ParseUnit(m.Unit)
+			if err != nil {
+				return nil, err
+			}
+			unit = u
+		}
+		name := m.Type
+		if name == "" {
+			name = e.Type
+		}
+		t, err := registry.ParseType(name, unit)
+		if err != nil {
+			return nil, err
+		}
+		typ = t
+	}
+	return []metric.Measure{{Name: m.Name, Value: *m.Value, Type: typ}}, nil
+}
+
+// parseLine parses a line of the line protocol,
+// "measurement[,tag=value...] field=value[,field=value...] [timestamp]".
+// The name of a measurement is the measurement, the values of the tags
+// and the field joined by ':', e.g. "disk,device=sda used=10i" is "disk:sda:used".
+// The string fields are ignored, the booleans are 1 or 0, the timestamp is ignored.
+func (e *Execd) parseLine(line []byte) ([]metric.Measure, error) {
+	parts := splitUnescaped(strings.TrimSpace(string(line)), ' ')
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid line protocol %q", line)
+	}
+	keys := splitUnescaped(parts[0], ',')
+	prefix := []string{unescape(keys[0])}
+	for _, tag := range keys[1:] {
+		_, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		prefix = append(prefix, unescape(value))
+	}
+	var ret []metric.Measure
+	for _, field := range splitUnescaped(parts[1], ',') {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		v, ok, err := parseFieldValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", key, err)
+		}
+		if !ok {
+			continue
+		}
+		name := strings.Join(append(prefix, unescape(key)), ":")
+		ret = append(ret, metric.Measure{Name: name, Value: v, Type: e.typ})
+	}
+	return ret, nil
+}
+
+// parseFieldValue returns the value of the field,
+// ok is false if the field is a string.
+func parseFieldValue(s string) (float64, bool, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return 0, false, nil
+	case s == "t" || s == "T" || s == "true" || s == "True" || s == "TRUE":
+		return 1, true, nil
+	case s == "f" || s == "F" || s == "false" || s == "False" || s == "FALSE":
+		return 0, true, nil
+	case strings.HasSuffix(s, "i"):
+		v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		return float64(v), err == nil, err
+	case strings.HasSuffix(s, "u"):
+		v, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		return 0, false, nil
+	}
+	return v, err == nil, err
+}
+
+// splitUnescaped splits s by sep that is not escaped by '\\' nor quoted.
+func splitUnescaped(s string, sep byte) []string {
+	var ret []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if quoted {
+				continue
+			}
+			if sep == ' ' && i == start {
+				start = i + 1
+				continue
+			}
+			ret = append(ret, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		ret = append(ret, s[start:])
+	}
+	return ret
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package execd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	e := &Execd{DataFormat: "line"}
+	e.typ = metric.GaugeType(metric.UnitShort)
+	tests := []struct {
+		line   string
+		expect []string
+		err    bool
+	}{
+		{line: `app requests=12i`, expect: []string{"app:requests=12"}},
+		{line: `app,host=web1,region=kr requests=12i,latency=0.25 1700000000000000000`, expect: []string{"app:web1:kr:requests=12", "app:web1:kr:latency=0.25"}},
+		{line: `app,host=web\ 1 ok=t,failed=false,msg="a b, c",count=3u`, expect: []string{"app:web 1:ok=1", "app:web 1:failed=0", "app:web 1:count=3"}},
+		{line: `app`, err: true},
+		{line: `app value=abc`, err: true},
+		{line: `app,host value=1`, err: true},
+	}
+	for _, tt := range tests {
+		measures, err := e.parseLine([]byte(tt.line))
+		if tt.err {
+			require.Error(t, err, tt.line)
+			continue
+		}
+		require.NoError(t, err, tt.line)
+		var result []string
+		for _, m := range measures {
+			result = append(result, fmt.Sprintf("%s=%v", m.Name, m.Value))
+		}
+		require.Equal(t, tt.expect, result, tt.line)
+	}
+}
+
+func TestExecd(t *testing.T) {
+	e := &Execd{
+		Command: []string{"sh", "-c", `
+echo '{"name":"app:requests","value":12,"type":"counter"}'
+echo 'not json'
+echo 'WARN: something' >&2
+echo '{"name":"app:ratio","value":0.5,"unit":"percent"}'
+sleep 60
+`},
+	}
+	ch := make(chan metric.Measure, 10)
+	e.SetPush(func(m ...metric.Measure) {
+		for _, x := range m {
+			ch <- x
+		}
+	})
+	require.NoError(t, e.Init())
+	defer e.DeInit()
+
+	var result []string
+	for len(result) < 2 {
+		select {
+		case m := <-ch:
+			result = append(result, fmt.Sprintf("%s %s %s %v", m.Name, m.Type.Name(), m.Type.Unit(), m.Value))
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	require.Equal(t, []string{
+		"app:requests counter Short 12",
+		"app:ratio gauge Percent 0.5",
+	}, result)
+	require.NoError(t, e.Gather(&metric.Gather{}))
+}
+
+func TestExecdRestart(t *testing.T) {
+	e := &Execd{
+		Command:      []string{"sh", "-c", `echo '{"name":"app:up","value":1}'`},
+		RestartDelay: 10 * time.Millisecond,
+	}
+	ch := make(chan metric.Measure, 10)
+	e.SetPush(func(m ...metric.Measure) { ch <- m[0] })
+	require.NoError(t, e.Init())
+	defer e.DeInit()
+	for range 3 {
+		select {
+		case m := <-ch:
+			require.Equal(t, "app:up", m.Name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("not restarted")
+		}
+	}
+}
@@ -19,6 +19,10 @@ func (n *HeapInuse) SampleConfig() string {
 	return go_memSampleConfig
 }
 
+func (n *HeapInuse) Description() string {
+	return "Go runtime memory stats"
+}
+
 type HeapInuse struct {
 	metricType metric.Type `toml:"-"`
 }
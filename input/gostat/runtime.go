@@ -19,6 +19,10 @@ func (n *GoRoutines) SampleConfig() string {
 	return runtimeSampleConfig
 }
 
+func (n *GoRoutines) Description() string {
+	return "Number of goroutines of the Go runtime"
+}
+
 type GoRoutines struct {
 	metricType metric.Type `toml:"-"`
 }
@@ -0,0 +1,213 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Modbus function codes for reading
+const (
+	fnReadCoils            byte = 0x01
+	fnReadDiscreteInputs   byte = 0x02
+	fnReadHoldingRegisters byte = 0x03
+	fnReadInputRegisters   byte = 0x04
+)
+
+// maximum quantity of a single read request by the specification
+const (
+	maxReadBits      = 2000
+	maxReadRegisters = 125
+)
+
+var exceptionCodes = map[byte]string{
+	0x01: "illegal function",
+	0x02: "illegal data address",
+	0x03: "illegal data value",
+	0x04: "server device failure",
+	0x05: "acknowledge",
+	0x06: "server device busy",
+	0x08: "memory parity error",
+	0x0A: "gateway path unavailable",
+	0x0B: "gateway target device failed to respond",
+}
+
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e *ExceptionError) Error() string {
+	msg, ok := exceptionCodes[e.Code]
+	if !ok {
+		msg = "unknown exception"
+	}
+	return fmt.Sprintf("modbus exception 0x%02X (%s) for function 0x%02X", e.Code, msg, e.Function)
+}
+
+// client is a minimal Modbus master over a TCP connection.
+// It speaks either Modbus TCP (MBAP header) or Modbus RTU framing
+// tunneled over TCP (RTU-over-TCP), selected by the endpoint scheme.
+type client struct {
+	conn    net.Conn
+	rtu     bool
+	timeout time.Duration
+	txID    uint16
+}
+
+// dial connects to the endpoint.
+// The endpoint is "tcp://host:port" or "rtuovertcp://host:port".
+func dial(endpoint string, timeout time.Duration) (*client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	var rtu bool
+	switch u.Scheme {
+	case "tcp":
+	case "rtuovertcp":
+		rtu = true
+	default:
+		return nil, fmt.Errorf("unsupported modbus endpoint scheme %q", u.Scheme)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &client{conn: conn, rtu: rtu, timeout: timeout}, nil
+}
+
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// read issues a read request and returns the data bytes of the response.
+func (c *client) read(slaveID uint8, fn byte, address uint16, quantity uint16) ([]byte, error) {
+	pdu := make([]byte, 5)
+	pdu[0] = fn
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	var rsp []byte
+	var err error
+	if c.rtu {
+		rsp, err = c.transactRTU(slaveID, pdu)
+	} else {
+		rsp, err = c.transactTCP(slaveID, pdu)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp) < 2 {
+		return nil, errors.New("modbus response too short")
+	}
+	if rsp[0] == fn|0x80 {
+		return nil, &ExceptionError{Function: fn, Code: rsp[1]}
+	}
+	if rsp[0] != fn {
+		return nil, fmt.Errorf("modbus response function 0x%02X, expected 0x%02X", rsp[0], fn)
+	}
+	count := int(rsp[1])
+	if len(rsp) != count+2 {
+		return nil, fmt.Errorf("modbus response byte count %d, got %d bytes", count, len(rsp)-2)
+	}
+	var expect int
+	switch fn {
+	case fnReadCoils, fnReadDiscreteInputs:
+		expect = (int(quantity) + 7) / 8
+	default:
+		expect = int(quantity) * 2
+	}
+	if count != expect {
+		return nil, fmt.Errorf("modbus response byte count %d, expected %d", count, expect)
+	}
+	return rsp[2:], nil
+}
+
+func (c *client) transactTCP(unitID uint8, pdu []byte) ([]byte, error) {
+	c.txID++
+	adu := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(adu[0:], c.txID)
+	binary.BigEndian.PutUint16(adu[2:], 0) // protocol identifier
+	binary.BigEndian.PutUint16(adu[4:], uint16(len(pdu)+1))
+	adu[6] = unitID
+	copy(adu[7:], pdu)
+	if _, err := c.conn.Write(adu); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("modbus invalid MBAP length %d", length)
+	}
+	body := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return nil, err
+	}
+	if txID := binary.BigEndian.Uint16(header[0:]); txID != c.txID {
+		return nil, fmt.Errorf("modbus transaction id %d, expected %d", txID, c.txID)
+	}
+	if header[6] != unitID {
+		return nil, fmt.Errorf("modbus unit id %d, expected %d", header[6], unitID)
+	}
+	return body, nil
+}
+
+func (c *client) transactRTU(slaveID uint8, pdu []byte) ([]byte, error) {
+	adu := make([]byte, 0, len(pdu)+3)
+	adu = append(adu, slaveID)
+	adu = append(adu, pdu...)
+	adu = binary.LittleEndian.AppendUint16(adu, crc16(adu))
+	if _, err := c.conn.Write(adu); err != nil {
+		return nil, err
+	}
+
+	// slave id, function code, and byte count or exception code
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(c.conn, head); err != nil {
+		return nil, err
+	}
+	remains := 2 // crc
+	if head[1]&0x80 == 0 {
+		remains += int(head[2])
+	}
+	tail := make([]byte, remains)
+	if _, err := io.ReadFull(c.conn, tail); err != nil {
+		return nil, err
+	}
+	frame := append(head, tail...)
+	n := len(frame) - 2
+	if crc := binary.LittleEndian.Uint16(frame[n:]); crc != crc16(frame[:n]) {
+		return nil, errors.New("modbus rtu crc mismatch")
+	}
+	if frame[0] != slaveID {
+		return nil, fmt.Errorf("modbus slave id %d, expected %d", frame[0], slaveID)
+	}
+	return frame[1:n], nil
+}
+
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
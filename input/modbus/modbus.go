@@ -0,0 +1,299 @@
+package modbus
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+func init() {
+	registry.Register("modbus", (*Modbus)(nil))
+}
+
+//go:embed "modbus.toml"
+var modbusSampleConfig string
+
+func (m *Modbus) SampleConfig() string {
+	return modbusSampleConfig
+}
+
+func (m *Modbus) Description() string {
+	return "Modbus TCP/RTU registers and coils"
+}
+
+var _ metric.Input = (*Modbus)(nil)
+
+type Modbus struct {
+	Endpoint          string        `toml:"endpoint"`
+	Timeout           time.Duration `toml:"timeout"`
+	ConnRetryInterval time.Duration `toml:"conn_retry_interval"`
+	ConnRetryCount    int           `toml:"conn_retry_count"`
+	Registers         []Register    `toml:"register"`
+
+	client  *client
+	batches []*batch
+}
+
+type Register struct {
+	Name      string   `toml:"name"`
+	SlaveID   uint8    `toml:"slave_id"`
+	Function  string   `toml:"function"`
+	Address   uint16   `toml:"address"`
+	DataType  string   `toml:"data_type"`
+	ByteOrder string   `toml:"byte_order"`
+	WordOrder string   `toml:"word_order"`
+	Scale     *float64 `toml:"scale"` // default 1, 0 is kept as it is
+	Offset    float64  `toml:"offset"`
+
+	fn    byte
+	width uint16 // number of bits or registers that the value occupies
+	scale float64
+}
+
+// batch is a single read request covering contiguous registers
+// of the same slave and function.
+type batch struct {
+	slaveID   uint8
+	fn        byte
+	address   uint16
+	quantity  uint16
+	registers []*Register
+}
+
+func (m *Modbus) Init() error {
+	if m.Endpoint == "" {
+		return errors.New("endpoint is required")
+	}
+	if len(m.Registers) == 0 {
+		return errors.New("no registers configured")
+	}
+	if m.Timeout == 0 {
+		m.Timeout = 3 * time.Second
+	}
+	if m.ConnRetryInterval == 0 {
+		m.ConnRetryInterval = 1 * time.Second
+	}
+	for i := range m.Registers {
+		if err := m.Registers[i].init(); err != nil {
+			return err
+		}
+	}
+	m.batches = makeBatches(m.Registers)
+	if err := m.connect(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Modbus) DeInit() error {
+	m.disconnect()
+	return nil
+}
+
+func (m *Modbus) Gather(g *metric.Gather) error {
+	var connRetry = 0
+	for m.client == nil {
+		if err := m.connect(); err != nil {
+			slog.Debug("error connecting to Modbus server", "error", err)
+			if connRetry >= m.ConnRetryCount {
+				return err
+			}
+			connRetry++
+			time.Sleep(m.ConnRetryInterval)
+			continue
+		}
+	}
+	for _, b := range m.batches {
+		data, err := m.client.read(b.slaveID, b.fn, b.address, b.quantity)
+		if err != nil {
+			var exception *ExceptionError
+			if errors.As(err, &exception) {
+				// the connection is still usable, skip the registers of this batch only
+				slog.Warn("modbus read exception", "slave_id", b.slaveID, "address", b.address, "error", err)
+				continue
+			}
+			// transport error, reconnect on the next gathering
+			m.disconnect()
+			return fmt.Errorf("error reading modbus slave %d address %d: %w", b.slaveID, b.address, err)
+		}
+		for _, r := range b.registers {
+			val, err := r.decode(data, r.Address-b.address)
+			if err != nil {
+				return err
+			}
+			g.Add("modbus:"+r.Name, val*r.scale+r.Offset, metric.GaugeType(metric.UnitShort))
+		}
+	}
+	return nil
+}
+
+func (m *Modbus) connect() error {
+	if m.client != nil {
+		return nil
+	}
+	c, err := dial(m.Endpoint, m.Timeout)
+	if err != nil {
+		return err
+	}
+	m.client = c
+	return nil
+}
+
+func (m *Modbus) disconnect() {
+	if m.client != nil {
+		m.client.Close()
+		m.client = nil
+	}
+}
+
+func (r *Register) init() error {
+	if r.Name == "" {
+		return errors.New("register name is required")
+	}
+	switch strings.ToLower(r.Function) {
+	case "coils", "coil":
+		r.fn = fnReadCoils
+	case "discrete", "discrete_inputs":
+		r.fn = fnReadDiscreteInputs
+	case "holding", "holding_registers", "":
+		r.fn = fnReadHoldingRegisters
+	case "input", "input_registers":
+		r.fn = fnReadInputRegisters
+	default:
+		return fmt.Errorf("register %s: unknown function %q", r.Name, r.Function)
+	}
+	if r.fn == fnReadCoils || r.fn == fnReadDiscreteInputs {
+		r.width = 1
+	} else {
+		switch strings.ToLower(r.DataType) {
+		case "int16", "uint16", "":
+			r.width = 1
+		case "int32", "uint32", "float32":
+			r.width = 2
+		case "int64", "uint64", "float64":
+			r.width = 4
+		default:
+			return fmt.Errorf("register %s: unknown data type %q", r.Name, r.DataType)
+		}
+	}
+	for _, order := range []string{r.ByteOrder, r.WordOrder} {
+		switch strings.ToLower(order) {
+		case "", "big", "little":
+		default:
+			return fmt.Errorf("register %s: unknown byte/word order %q", r.Name, order)
+		}
+	}
+	if int(r.Address)+int(r.width) > math.MaxUint16+1 {
+		return fmt.Errorf("register %s: address %d out of range", r.Name, r.Address)
+	}
+	r.scale = 1
+	if r.Scale != nil {
+		r.scale = *r.Scale
+	}
+	return nil
+}
+
+// decode returns the value of the register at the offset (in bits or registers)
+// of the response data.
+func (r *Register) decode(data []byte, offset uint16) (float64, error) {
+	if r.fn == fnReadCoils || r.fn == fnReadDiscreteInputs {
+		idx := int(offset)
+		if idx/8 >= len(data) {
+			return 0, fmt.Errorf("register %s: response too short", r.Name)
+		}
+		if data[idx/8]&(1<<(idx%8)) != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	start, end := int(offset)*2, int(offset+r.width)*2
+	if end > len(data) {
+		return 0, fmt.Errorf("register %s: response too short", r.Name)
+	}
+	raw := make([]byte, end-start)
+	copy(raw, data[start:end])
+	if strings.EqualFold(r.ByteOrder, "little") {
+		for i := 0; i < len(raw); i += 2 {
+			raw[i], raw[i+1] = raw[i+1], raw[i]
+		}
+	}
+	if strings.EqualFold(r.WordOrder, "little") {
+		for i, j := 0, len(raw)-2; i < j; i, j = i+2, j-2 {
+			raw[i], raw[i+1], raw[j], raw[j+1] = raw[j], raw[j+1], raw[i], raw[i+1]
+		}
+	}
+	switch strings.ToLower(r.DataType) {
+	case "int16":
+		return float64(int16(binary.BigEndian.Uint16(raw))), nil
+	case "int32":
+		return float64(int32(binary.BigEndian.Uint32(raw))), nil
+	case "uint32":
+		return float64(binary.BigEndian.Uint32(raw)), nil
+	case "float32":
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), nil
+	case "int64":
+		return float64(int64(binary.BigEndian.Uint64(raw))), nil
+	case "uint64":
+		return float64(binary.BigEndian.Uint64(raw)), nil
+	case "float64":
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), nil
+	default: // "uint16"
+		return float64(binary.BigEndian.Uint16(raw)), nil
+	}
+}
+
+// makeBatches groups the registers into read requests,
+// merging the registers of the same slave and function that are contiguous
+// (or overlapping) up to the maximum quantity of a request.
+func makeBatches(registers []Register) []*batch {
+	sorted := make([]*Register, len(registers))
+	for i := range registers {
+		sorted[i] = &registers[i]
+	}
+	slices.SortStableFunc(sorted, func(a, b *Register) int {
+		if a.SlaveID != b.SlaveID {
+			return int(a.SlaveID) - int(b.SlaveID)
+		}
+		if a.fn != b.fn {
+			return int(a.fn) - int(b.fn)
+		}
+		return int(a.Address) - int(b.Address)
+	})
+
+	var ret []*batch
+	var cur *batch
+	for _, r := range sorted {
+		limit := maxReadRegisters
+		if r.fn == fnReadCoils || r.fn == fnReadDiscreteInputs {
+			limit = maxReadBits
+		}
+		end := int(r.Address) + int(r.width)
+		if cur != nil && cur.slaveID == r.SlaveID && cur.fn == r.fn &&
+			int(r.Address) <= int(cur.address)+int(cur.quantity) &&
+			end-int(cur.address) <= limit {
+			if q := end - int(cur.address); q > int(cur.quantity) {
+				cur.quantity = uint16(q)
+			}
+			cur.registers = append(cur.registers, r)
+			continue
+		}
+		cur = &batch{
+			slaveID:   r.SlaveID,
+			fn:        r.fn,
+			address:   r.Address,
+			quantity:  r.width,
+			registers: []*Register{r},
+		}
+		ret = append(ret, cur)
+	}
+	return ret
+}
@@ -0,0 +1,282 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is an in-process Modbus server that serves
+// coils and holding/input registers of a single slave.
+type testServer struct {
+	sync.Mutex
+	ln       net.Listener
+	rtu      bool
+	coils    []bool
+	holding  []uint16
+	input    []uint16
+	requests int
+}
+
+func newTestServer(t *testing.T, rtu bool) *testServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testServer{
+		ln:      ln,
+		rtu:     rtu,
+		coils:   make([]bool, 64),
+		holding: make([]uint16, 64),
+		input:   make([]uint16, 64),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *testServer) endpoint() string {
+	if s.rtu {
+		return "rtuovertcp://" + s.ln.Addr().String()
+	}
+	return "tcp://" + s.ln.Addr().String()
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var header []byte
+		var unitID uint8
+		var pdu []byte
+		if s.rtu {
+			frame := make([]byte, 8)
+			if _, err := io.ReadFull(conn, frame); err != nil {
+				return
+			}
+			unitID, pdu = frame[0], frame[1:6]
+		} else {
+			header = make([]byte, 7)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			pdu = make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+			if _, err := io.ReadFull(conn, pdu); err != nil {
+				return
+			}
+			unitID = header[6]
+		}
+		rsp := s.handle(pdu)
+		if s.rtu {
+			adu := append([]byte{unitID}, rsp...)
+			adu = binary.LittleEndian.AppendUint16(adu, crc16(adu))
+			conn.Write(adu)
+		} else {
+			binary.BigEndian.PutUint16(header[4:], uint16(len(rsp)+1))
+			conn.Write(append(header, rsp...))
+		}
+	}
+}
+
+func (s *testServer) handle(pdu []byte) []byte {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	fn := pdu[0]
+	addr := int(binary.BigEndian.Uint16(pdu[1:]))
+	qty := int(binary.BigEndian.Uint16(pdu[3:]))
+	switch fn {
+	case fnReadCoils:
+		if addr+qty > len(s.coils) {
+			return []byte{fn | 0x80, 0x02}
+		}
+		data := make([]byte, (qty+7)/8)
+		for i := 0; i < qty; i++ {
+			if s.coils[addr+i] {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{fn, byte(len(data))}, data...)
+	case fnReadHoldingRegisters, fnReadInputRegisters:
+		regs := s.holding
+		if fn == fnReadInputRegisters {
+			regs = s.input
+		}
+		if addr+qty > len(regs) {
+			return []byte{fn | 0x80, 0x02}
+		}
+		data := make([]byte, 0, qty*2)
+		for i := 0; i < qty; i++ {
+			data = binary.BigEndian.AppendUint16(data, regs[addr+i])
+		}
+		return append([]byte{fn, byte(len(data))}, data...)
+	default:
+		return []byte{fn | 0x80, 0x01}
+	}
+}
+
+func lastValue(t *testing.T, c *metric.Collector, name string) float64 {
+	t.Helper()
+	mts := c.Timeseries(name)
+	require.NotNil(t, mts, name)
+	_, v := mts[0].Last()
+	gv, ok := v.(*metric.GaugeValue)
+	require.True(t, ok, "%s: %T", name, v)
+	return gv.Value
+}
+
+func TestModbus(t *testing.T) {
+	for _, rtu := range []bool{false, true} {
+		name := "tcp"
+		if rtu {
+			name = "rtuovertcp"
+		}
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, rtu)
+			s.holding[0] = uint16(0xFFFF) // -1 as int16
+			s.holding[1] = 0x4049         // float32 3.14159, big word order
+			s.holding[2] = 0x0FD0
+			s.holding[3] = 0x0FD0 // float32 3.14159, little word order
+			s.holding[4] = 0x4049
+			s.input[10] = 0x3412 // 0x1234 as little byte order
+			s.coils[3] = true
+
+			scale := 0.1
+			m := &Modbus{
+				Endpoint: s.endpoint(),
+				Timeout:  time.Second,
+				Registers: []Register{
+					{Name: "temp", SlaveID: 1, Function: "holding", Address: 0, DataType: "int16", Scale: &scale},
+					{Name: "pi_be", SlaveID: 1, Function: "holding", Address: 1, DataType: "float32"},
+					{Name: "pi_le", SlaveID: 1, Function: "holding", Address: 3, DataType: "float32", WordOrder: "little"},
+					{Name: "swapped", SlaveID: 1, Function: "input", Address: 10, DataType: "uint16", ByteOrder: "little", Offset: 1},
+					{Name: "running", SlaveID: 1, Function: "coils", Address: 3},
+					{Name: "stopped", SlaveID: 1, Function: "coils", Address: 4},
+				},
+			}
+			seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+			require.NoError(t, err)
+			c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+			require.NoError(t, c.AddInput(m))
+			defer m.DeInit()
+
+			// holding 0..4 in one request, input 10, coils 3..4 in one request
+			require.Len(t, m.batches, 3)
+			require.Equal(t, 3, s.requests)
+
+			require.InDelta(t, -0.1, lastValue(t, c, "modbus:temp"), 1e-9)
+			require.InDelta(t, 3.14159, lastValue(t, c, "modbus:pi_be"), 1e-5)
+			require.InDelta(t, 3.14159, lastValue(t, c, "modbus:pi_le"), 1e-5)
+			require.Equal(t, float64(0x1234+1), lastValue(t, c, "modbus:swapped"))
+			require.Equal(t, 1.0, lastValue(t, c, "modbus:running"))
+			require.Equal(t, 0.0, lastValue(t, c, "modbus:stopped"))
+		})
+	}
+}
+
+func TestModbusReconnect(t *testing.T) {
+	s := newTestServer(t, false)
+	s.holding[0] = 7
+	m := &Modbus{
+		Endpoint:  s.endpoint(),
+		Timeout:   time.Second,
+		Registers: []Register{{Name: "value", SlaveID: 1, Address: 0}},
+	}
+	require.NoError(t, m.Init())
+	defer m.DeInit()
+
+	// break the connection, the next gathering fails and the one after reconnects
+	m.client.conn.Close()
+	require.Error(t, m.Gather(&metric.Gather{}))
+	require.Nil(t, m.client)
+	require.NoError(t, m.Gather(&metric.Gather{}))
+	require.NotNil(t, m.client)
+}
+
+func TestModbusException(t *testing.T) {
+	s := newTestServer(t, false)
+	m := &Modbus{
+		Endpoint: s.endpoint(),
+		Timeout:  time.Second,
+		Registers: []Register{
+			{Name: "out_of_range", SlaveID: 1, Address: 100},
+		},
+	}
+	require.NoError(t, m.Init())
+	defer m.DeInit()
+
+	// exception responses skip the registers but keep the connection
+	require.NoError(t, m.Gather(&metric.Gather{}))
+	require.NotNil(t, m.client)
+}
+
+func TestMakeBatches(t *testing.T) {
+	regs := []Register{
+		{Name: "a", SlaveID: 1, Address: 0, DataType: "uint16"},
+		{Name: "b", SlaveID: 1, Address: 1, DataType: "float64"},
+		{Name: "c", SlaveID: 1, Address: 6, DataType: "uint16"}, // gap
+		{Name: "d", SlaveID: 2, Address: 0, DataType: "uint16"}, // another slave
+		{Name: "e", SlaveID: 1, Address: 120, DataType: "uint32"},
+		{Name: "f", SlaveID: 1, Address: 122, DataType: "float64"},
+		{Name: "g", SlaveID: 1, Address: 126, DataType: "float64"},
+	}
+	for i := range regs {
+		require.NoError(t, regs[i].init())
+	}
+	batches := makeBatches(regs)
+	type span struct {
+		slave    uint8
+		addr     uint16
+		quantity uint16
+	}
+	var spans []span
+	for _, b := range batches {
+		spans = append(spans, span{b.slaveID, b.address, b.quantity})
+	}
+	require.Equal(t, []span{
+		{1, 0, 5},
+		{1, 6, 1},
+		{1, 120, 10},
+		{2, 0, 1},
+	}, spans)
+
+	// the maximum quantity of a request splits a contiguous range
+	long := make([]Register, 0, 130)
+	for i := 0; i < 130; i++ {
+		r := Register{Name: "r", SlaveID: 1, Address: uint16(i)}
+		require.NoError(t, r.init())
+		long = append(long, r)
+	}
+	batches = makeBatches(long)
+	require.Len(t, batches, 2)
+	require.Equal(t, uint16(maxReadRegisters), batches[0].quantity)
+	require.Equal(t, uint16(5), batches[1].quantity)
+}
+
+func TestDecodeFloat64(t *testing.T) {
+	r := Register{Name: "f", Function: "holding", DataType: "float64", WordOrder: "little", ByteOrder: "little"}
+	require.NoError(t, r.init())
+	be := binary.BigEndian.AppendUint64(nil, math.Float64bits(1.5))
+	// reverse the words, then swap the bytes within each word
+	data := make([]byte, 8)
+	for i := 0; i < 4; i++ {
+		data[i*2] = be[(3-i)*2+1]
+		data[i*2+1] = be[(3-i)*2]
+	}
+	v, err := r.decode(data, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1.5, v)
+}
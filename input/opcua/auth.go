@@ -0,0 +1,86 @@
+package opcua
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// authOpts returns the options of the user authentication
+// and the user token type for selecting the endpoint.
+func (o *OPCUA) authOpts() ([]opcua.Option, ua.UserTokenType, error) {
+	switch strings.ToLower(o.AuthMethod) {
+	case "", "anonymous":
+		return []opcua.Option{opcua.AuthAnonymous()}, ua.UserTokenTypeAnonymous, nil
+	case "username":
+		if o.Username == "" {
+			return nil, 0, errors.New("username is required for auth_method \"username\"")
+		}
+		return []opcua.Option{opcua.AuthUsername(o.Username, o.Password)}, ua.UserTokenTypeUserName, nil
+	case "certificate":
+		if o.UserCertificate == "" || o.UserPrivateKey == "" {
+			return nil, 0, errors.New("user_certificate and user_private_key are required for auth_method \"certificate\"")
+		}
+		cert, err := LoadCertificate(o.UserCertificate)
+		if err != nil {
+			return nil, 0, err
+		}
+		key, err := LoadPrivateKey(o.UserPrivateKey)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []opcua.Option{
+			opcua.AuthCertificate(cert),
+			opcua.AuthPrivateKey(key),
+		}, ua.UserTokenTypeCertificate, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown auth_method %q", o.AuthMethod)
+	}
+}
+
+// LoadCertificate reads the certificate in PEM or DER format,
+// and returns it in DER format.
+func LoadCertificate(filename string) ([]byte, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate: %w", err)
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	if _, err := x509.ParseCertificate(b); err != nil {
+		return nil, fmt.Errorf("invalid certificate %s: %w", filename, err)
+	}
+	return b, nil
+}
+
+// LoadPrivateKey reads the RSA private key in PEM or DER format,
+// PKCS#1 and PKCS#8 are supported.
+func LoadPrivateKey(filename string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key: %w", err)
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(b); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %w", filename, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not RSA", filename)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,299 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// browsedNode is a variable node found by browsing the address space.
+type browsedNode struct {
+	nodeID *ua.NodeID
+	// browse names from the root of the browsing
+	path     []string
+	dataType string
+}
+
+// node returns the node configuration of the browsed node.
+func (bn browsedNode) node() Node {
+	ret := Node{
+		Name:      nodeName(bn.path),
+		Namespace: fmt.Sprintf("%d", bn.nodeID.Namespace()),
+	}
+	switch bn.nodeID.Type() {
+	case ua.NodeIDTypeTwoByte, ua.NodeIDTypeFourByte, ua.NodeIDTypeNumeric:
+		ret.IdType, ret.Id = "i", fmt.Sprintf("%d", bn.nodeID.IntID())
+	case ua.NodeIDTypeGUID:
+		ret.IdType, ret.Id = "g", bn.nodeID.StringID()
+	case ua.NodeIDTypeByteString:
+		ret.IdType, ret.Id = "b", bn.nodeID.StringID()
+	default:
+		ret.IdType, ret.Id = "s", bn.nodeID.StringID()
+	}
+	return ret
+}
+
+// nodeName makes the measurement name from the browse path,
+// e.g. ["Line1", "Motor 2", "Speed"] to "Line1.Motor_2.Speed"
+func nodeName(browsePath []string) string {
+	parts := make([]string, len(browsePath))
+	for i, p := range browsePath {
+		parts[i] = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+				return r
+			default:
+				return '_'
+			}
+		}, p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// browse walks the hierarchical references from the root node
+// down to the depth, and returns the variable nodes.
+func (o *OPCUA) browse(root *ua.NodeID, depth int) ([]browsedNode, error) {
+	var ret []browsedNode
+	visited := map[string]bool{root.String(): true}
+	var walk func(nodeID *ua.NodeID, parent []string, level int) error
+	walk = func(nodeID *ua.NodeID, parent []string, level int) error {
+		if level >= depth {
+			return nil
+		}
+		refs, err := o.client.Node(nodeID).References(o.ctx, id.HierarchicalReferences, ua.BrowseDirectionForward,
+			ua.NodeClassObject|ua.NodeClassVariable, true)
+		if err != nil {
+			return fmt.Errorf("browse %s: %w", nodeID, err)
+		}
+		for _, ref := range refs {
+			if ref.NodeID == nil || ref.NodeID.NodeID == nil || ref.BrowseName == nil {
+				continue
+			}
+			child := ref.NodeID.NodeID
+			if visited[child.String()] {
+				continue
+			}
+			visited[child.String()] = true
+			p := append(append([]string{}, parent...), ref.BrowseName.Name)
+			if ref.NodeClass == ua.NodeClassVariable {
+				ret = append(ret, browsedNode{nodeID: child, path: p})
+			}
+			if err := walk(child, p, level+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, nil, 0); err != nil {
+		return nil, err
+	}
+	if err := o.readDataTypes(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// readDataTypes reads the DataType attribute of the nodes
+// in the chunks of the MaxNodesPerRead limit.
+func (o *OPCUA) readDataTypes(nodes []browsedNode) error {
+	nodeIDs := make([]*ua.NodeID, len(nodes))
+	for i, n := range nodes {
+		nodeIDs[i] = n.nodeID
+	}
+	return o.readChunked(nodeIDs, ua.AttributeIDDataType, func(offset int, results []*ua.DataValue, err error) error {
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			if result.Status != ua.StatusOK || result.Value == nil {
+				continue
+			}
+			var dt *ua.NodeID
+			switch v := result.Value.Value().(type) {
+			case *ua.NodeID:
+				dt = v
+			case *ua.ExpandedNodeID:
+				dt = v.NodeID
+			}
+			if dt == nil {
+				continue
+			}
+			n := &nodes[offset+i]
+			if dt.Namespace() == 0 && id.Name(dt.IntID()) != "" {
+				n.dataType = id.Name(dt.IntID())
+			} else {
+				n.dataType = dt.String()
+			}
+		}
+		return nil
+	})
+}
+
+// resolvePath returns the node of the browse path relative to the root,
+// the path is the browse names separated by "/", e.g. "Plant/Line1".
+func resolvePath(ctx context.Context, c *opcua.Client, root *ua.NodeID, browsePath string) (*ua.NodeID, error) {
+	current := root
+	for _, name := range strings.Split(strings.Trim(browsePath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		refs, err := c.Node(current).References(ctx, id.HierarchicalReferences, ua.BrowseDirectionForward,
+			ua.NodeClassObject|ua.NodeClassVariable, true)
+		if err != nil {
+			return nil, fmt.Errorf("browse %s: %w", current, err)
+		}
+		var found *ua.NodeID
+		for _, ref := range refs {
+			if ref.BrowseName != nil && ref.BrowseName.Name == name && ref.NodeID != nil {
+				found = ref.NodeID.NodeID
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("browse path %q: %q not found", browsePath, name)
+		}
+		current = found
+	}
+	return current, nil
+}
+
+// Discover adds the variable nodes under the browse path
+// whose browse names match the pattern.
+type Discover struct {
+	// starting node id, default "i=85" (Objects folder)
+	Root string `toml:"root"`
+	// browse names separated by "/" relative to the root
+	Path  string `toml:"path"`
+	Depth int    `toml:"depth"`
+	// glob pattern of the browse name, e.g. "Temp*"
+	Pattern string `toml:"pattern"`
+	// type and unit of the discovered nodes
+	Type string `toml:"type"`
+	Unit string `toml:"unit"`
+}
+
+const defaultBrowseDepth = 5
+
+// discover browses the configured paths and returns the nodes
+// that are not configured yet.
+func (o *OPCUA) discover() ([]Node, error) {
+	known := map[string]bool{}
+	for _, nodeID := range o.nodeIDs {
+		known[nodeID.String()] = true
+	}
+	var ret []Node
+	for _, d := range o.Discover {
+		root, err := ua.ParseNodeID(d.Root)
+		if err != nil {
+			return nil, fmt.Errorf("discover root %q: %w", d.Root, err)
+		}
+		start, err := resolvePath(o.ctx, o.client, root, d.Path)
+		if err != nil {
+			return nil, err
+		}
+		found, err := o.browse(start, d.Depth)
+		if err != nil {
+			return nil, err
+		}
+		for _, bn := range found {
+			if matched, _ := path.Match(d.Pattern, bn.path[len(bn.path)-1]); !matched {
+				continue
+			}
+			if known[bn.nodeID.String()] {
+				continue
+			}
+			known[bn.nodeID.String()] = true
+			node := bn.node()
+			node.Type, node.Unit = d.Type, d.Unit
+			ret = append(ret, node)
+		}
+	}
+	return ret, nil
+}
+
+// BrowseCommand runs "opcua browse" command,
+// it prints the variable nodes under the root node.
+func BrowseCommand(args []string, w io.Writer) error {
+	o := &OPCUA{}
+	var root string
+	var depth int
+	var pattern string
+	var emitToml bool
+	fs := flag.NewFlagSet("opcua browse", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.StringVar(&o.Endpoint, "endpoint", "opc.tcp://localhost:4840", "OPC UA server endpoint URL")
+	fs.StringVar(&root, "root", "i=85", "node id to start browsing")
+	fs.IntVar(&depth, "depth", defaultBrowseDepth, "maximum depth of browsing")
+	fs.StringVar(&pattern, "pattern", "*", "glob pattern of the browse names to print")
+	fs.BoolVar(&emitToml, "toml", false, "print [[input.opcua.nodes]] configuration")
+	fs.IntVar(&o.MaxNodesPerRead, "max-nodes-per-read", 0, "maximum nodes of a read request, 0 for the server limit")
+	fs.StringVar(&o.SecurityMode, "security-mode", "None", "security mode, None, Sign or SignAndEncrypt")
+	fs.StringVar(&o.SecurityPolicy, "security-policy", "", "security policy")
+	fs.StringVar(&o.Certificate, "certificate", "", "client certificate file")
+	fs.StringVar(&o.PrivateKey, "private-key", "", "client private key file")
+	fs.StringVar(&o.AuthMethod, "auth-method", "anonymous", "anonymous, username or certificate")
+	fs.StringVar(&o.Username, "username", "", "username of the username auth method")
+	fs.StringVar(&o.Password, "password", "", "password of the username auth method")
+	fs.StringVar(&o.UserCertificate, "user-certificate", "", "user certificate file of the certificate auth method")
+	fs.StringVar(&o.UserPrivateKey, "user-private-key", "", "user private key file of the certificate auth method")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	rootID, err := ua.ParseNodeID(root)
+	if err != nil {
+		return fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	o.ctx = context.Background()
+	if err := o.connect(); err != nil {
+		return err
+	}
+	defer o.disconnect()
+
+	nodes, err := o.browse(rootID, depth)
+	if err != nil {
+		return err
+	}
+	var tw *tabwriter.Writer
+	if !emitToml {
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+		fmt.Fprintln(tw, "NODE ID\tDATA TYPE\tPATH")
+	}
+	count := 0
+	for _, bn := range nodes {
+		if matched, _ := path.Match(pattern, bn.path[len(bn.path)-1]); !matched {
+			continue
+		}
+		count++
+		if !emitToml {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", bn.nodeID, bn.dataType, strings.Join(bn.path, "/"))
+			continue
+		}
+		n := bn.node()
+		fmt.Fprintln(w, "[[input.opcua.nodes]]")
+		fmt.Fprintf(w, "  name = %q\n", n.Name)
+		fmt.Fprintf(w, "  namespace = %q\n", n.Namespace)
+		fmt.Fprintf(w, "  id_type = %q\n", n.IdType)
+		fmt.Fprintf(w, "  id = %q\n", n.Id)
+		if bn.dataType != "" {
+			fmt.Fprintf(w, "  # data type: %s\n", bn.dataType)
+		}
+		fmt.Fprintln(w)
+	}
+	if count == 0 {
+		return errors.New("no variable nodes found")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package opcua
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+type Node struct {
+	Name      string `toml:"name"`
+	Namespace string `toml:"namespace"`
+	IdType    string `toml:"id_type"`
+	Id        string `toml:"id"`
+
+	// "gauge", "meter", "counter", "odometer", "histogram" or "timer"
+	Type string `toml:"type"`
+	// "short", "scalar", "percent", "bytes" or "duration"
+	Unit   string   `toml:"unit"`
+	Scale  *float64 `toml:"scale"` // default 1, 0 is kept as it is
+	Offset float64  `toml:"offset"`
+	// maps the string values to numbers, e.g. { "RUN" = 1, "STOP" = 0 }
+	Enum map[string]float64 `toml:"enum"`
+	// element index of the array values
+	Index int `toml:"index"`
+
+	metricType metric.Type
+	scale      float64
+}
+
+// init parses the type and unit of the node,
+// defaultType is used if the type is not specified.
+func (n *Node) init(defaultType string) error {
+	unit := n.Unit
+	if unit == "" {
+		unit = "short"
+	}
+	u, err := registry.ParseUnit(unit)
+	if err != nil {
+		return fmt.Errorf("node %s: %w", n.Name, err)
+	}
+	typ := n.Type
+	if typ == "" {
+		typ = defaultType
+	}
+	if n.metricType, err = registry.ParseType(typ, u); err != nil {
+		return fmt.Errorf("node %s: %w", n.Name, err)
+	}
+	n.scale = 1
+	if n.Scale != nil {
+		n.scale = *n.Scale
+	}
+	if n.Index < 0 {
+		return fmt.Errorf("node %s: negative index %d", n.Name, n.Index)
+	}
+	return nil
+}
+
+// convert returns the scaled value of the node,
+// it returns false if the value can not be represented as a number.
+func (n *Node) convert(value any) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		if _, ok := value.([]byte); !ok {
+			if n.Index >= rv.Len() {
+				return 0, false
+			}
+			value = rv.Index(n.Index).Interface()
+		}
+	}
+	var val float64
+	switch v := value.(type) {
+	case string:
+		if enum, ok := n.Enum[v]; ok {
+			val = enum
+		} else if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			val = f
+		} else {
+			return 0, false
+		}
+	case time.Time:
+		// seconds since epoch
+		val = float64(v.UnixNano()) / float64(time.Second)
+	default:
+		f, ok := toFloat(value)
+		if !ok {
+			return 0, false
+		}
+		val = f
+	}
+	return val*n.scale + n.Offset, true
+}
@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/OutOfBedlam/metric"
 	"github.com/OutOfBedlam/metrical/registry"
 	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
 	"github.com/gopcua/opcua/ua"
 )
 
@@ -27,7 +30,12 @@ func (o *OPCUA) SampleConfig() string {
 	return opcuaSampleConfig
 }
 
+func (o *OPCUA) Description() string {
+	return "OPC UA node values, polling or subscription"
+}
+
 var _ metric.Input = (*OPCUA)(nil)
+var _ registry.Pusher = (*OPCUA)(nil)
 
 type OPCUA struct {
 	Endpoint          string        `toml:"endpoint"`
@@ -40,17 +48,39 @@ type OPCUA struct {
 	ReadRetryCount    int           `toml:"read_retry_count"`
 	ConnRetryInterval time.Duration `toml:"conn_retry_interval"`
 	ConnRetryCount    int           `toml:"conn_retry_count"`
+	MaxNodesPerRead   int           `toml:"max_nodes_per_read"`
+	Discover          []Discover    `toml:"discover"`
 
-	ctx     context.Context
-	client  *opcua.Client
-	nodeIDs []*ua.NodeID
-}
+	// select the endpoint matching the security mode and policy
+	// from the endpoints that the server advertises
+	AutoSelectEndpoint bool `toml:"auto_select_endpoint"`
+
+	// "anonymous" (default), "username" or "certificate"
+	AuthMethod      string `toml:"auth_method"`
+	Username        string `toml:"username"`
+	Password        string `toml:"password"`
+	UserCertificate string `toml:"user_certificate"`
+	UserPrivateKey  string `toml:"user_private_key"`
+
+	// "poll" (default) reads the nodes every sampling interval,
+	// "subscribe" creates a subscription with monitored items.
+	Mode               string        `toml:"mode"`
+	PublishingInterval time.Duration `toml:"publishing_interval"`
+	SamplingInterval   time.Duration `toml:"sampling_interval"`
+	QueueSize          uint32        `toml:"queue_size"`
+	DeadbandType       string        `toml:"deadband_type"`
+	DeadbandValue      float64       `toml:"deadband_value"`
 
-type Node struct {
-	Name      string `toml:"name"`
-	Namespace string `toml:"namespace"`
-	IdType    string `toml:"id_type"`
-	Id        string `toml:"id"`
+	ctx             context.Context
+	client          *opcua.Client
+	nodeIDs         []*ua.NodeID
+	maxNodesPerRead int
+	push            func(...metric.Measure)
+	sub             *opcua.Subscription
+	subCancel       context.CancelFunc
+	// subLost is set by the notifications of the failed subscription,
+	// the next gathering reconnects and subscribes again.
+	subLost atomic.Bool
 }
 
 func (o *OPCUA) Init() error {
@@ -58,7 +88,7 @@ func (o *OPCUA) Init() error {
 	if o.Endpoint == "" {
 		return errors.New("endpoint is required")
 	}
-	if len(o.Nodes) == 0 {
+	if len(o.Nodes) == 0 && len(o.Discover) == 0 {
 		return errors.New("no nodes configured")
 	}
 	if o.ReadRetryInterval == 0 {
@@ -67,11 +97,40 @@ func (o *OPCUA) Init() error {
 	if o.ConnRetryInterval == 0 {
 		o.ConnRetryInterval = 1 * time.Second
 	}
-	if o.SecurityMode == "" {
+	if o.SecurityMode == "" && !o.AutoSelectEndpoint {
 		o.SecurityMode = "None"
 	}
+	switch o.Mode {
+	case "", "poll":
+		o.Mode = "poll"
+	case "subscribe":
+		if o.push == nil {
+			return errors.New("subscribe mode is not available")
+		}
+		if o.PublishingInterval == 0 {
+			o.PublishingInterval = time.Second
+		}
+		if o.QueueSize == 0 {
+			o.QueueSize = 10
+		}
+		switch strings.ToLower(o.DeadbandType) {
+		case "", "none", "absolute", "percent":
+		default:
+			return fmt.Errorf("unknown deadband_type %q", o.DeadbandType)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", o.Mode)
+	}
 
-	for _, node := range o.Nodes {
+	// values of the subscription are aggregated as meter by default
+	defaultType := "gauge"
+	if o.Mode == "subscribe" {
+		defaultType = "meter"
+	}
+	for i, node := range o.Nodes {
+		if err := o.Nodes[i].init(defaultType); err != nil {
+			return err
+		}
 		nodeID := fmt.Sprintf("ns=%s;%s=%s", node.Namespace, node.IdType, node.Id)
 		id, err := ua.ParseNodeID(nodeID)
 		if err != nil {
@@ -79,9 +138,49 @@ func (o *OPCUA) Init() error {
 		}
 		o.nodeIDs = append(o.nodeIDs, id)
 	}
+	for i, d := range o.Discover {
+		if d.Root == "" {
+			o.Discover[i].Root = "i=85"
+		}
+		if d.Depth <= 0 {
+			o.Discover[i].Depth = defaultBrowseDepth
+		}
+		if d.Pattern == "" {
+			o.Discover[i].Pattern = "*"
+		} else if _, err := path.Match(d.Pattern, ""); err != nil {
+			return fmt.Errorf("discover pattern %q: %w", d.Pattern, err)
+		}
+	}
 	if err := o.connect(); err != nil {
 		return err
 	}
+	if len(o.Discover) > 0 {
+		nodes, err := o.discover()
+		if err != nil {
+			o.disconnect()
+			return err
+		}
+		for _, node := range nodes {
+			if err := node.init(defaultType); err != nil {
+				return err
+			}
+			id, err := ua.ParseNodeID(fmt.Sprintf("ns=%s;%s=%s", node.Namespace, node.IdType, node.Id))
+			if err != nil {
+				return err
+			}
+			o.Nodes = append(o.Nodes, node)
+			o.nodeIDs = append(o.nodeIDs, id)
+		}
+		slog.Info("OPC UA nodes discovered", "endpoint", o.Endpoint, "count", len(nodes))
+		if len(o.Nodes) == 0 {
+			return errors.New("no nodes configured or discovered")
+		}
+	}
+	if o.Mode == "subscribe" {
+		if err := o.subscribe(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -90,7 +189,16 @@ func (o *OPCUA) DeInit() error {
 	return nil
 }
 
+// SetPush implements registry.Pusher,
+// the data changes of the subscribe mode are delivered through the push.
+func (o *OPCUA) SetPush(push func(...metric.Measure)) {
+	o.push = push
+}
+
 func (o *OPCUA) Gather(g *metric.Gather) error {
+	if o.subLost.Swap(false) {
+		o.disconnect()
+	}
 	var connRetry = 0
 	for o.client == nil {
 		if err := o.connect(); err != nil {
@@ -99,89 +207,198 @@ func (o *OPCUA) Gather(g *metric.Gather) error {
 				return err
 			}
 			connRetry++
+			time.Sleep(o.ConnRetryInterval)
 			continue
 		}
 	}
-	for i, id := range o.nodeIDs {
-		node := o.Nodes[i]
-		req := &ua.ReadRequest{
-			MaxAge:             0,
-			TimestampsToReturn: ua.TimestampsToReturnBoth,
-			NodesToRead: []*ua.ReadValueID{
-				{
-					NodeID:      id,
-					AttributeID: ua.AttributeIDValue,
-				},
-			},
+	if o.Mode == "subscribe" {
+		// values are pushed as they change,
+		// the gathering only recovers the subscription of a new connection.
+		if err := o.subscribe(); err != nil {
+			o.disconnect()
+			return err
 		}
-		var rsp *ua.ReadResponse
-		var retry = 0
-		for {
-			r, err := o.client.Read(o.ctx, req)
-			if err == nil {
-				rsp = r
-				break
-			}
-			if retry >= o.ReadRetryCount {
-				return fmt.Errorf("error reading node %s: %w", node.Name, err)
+		return nil
+	}
+	readErrors := 0
+	err := o.readChunked(o.nodeIDs, ua.AttributeIDValue, func(offset int, results []*ua.DataValue, err error) error {
+		if err != nil && isConnError(err) {
+			// reconnects at the next gathering
+			o.disconnect()
+			return err
+		}
+		if err != nil {
+			slog.Warn("error reading OPC UA nodes", "from", o.Nodes[offset].Name, "count", len(results), "error", err)
+			for _, node := range o.Nodes[offset : offset+len(results)] {
+				g.Add("opcua:"+node.Name+":quality", qualityBad, qualityType)
 			}
-			retry++
-			switch {
-			case err == io.EOF && o.client.State() != opcua.Closed:
-				time.Sleep(o.ReadRetryInterval)
+			readErrors += len(results)
+			return nil
+		}
+		for i, result := range results {
+			node := o.Nodes[offset+i]
+			quality := qualityOf(result.Status)
+			g.Add("opcua:"+node.Name+":quality", quality, qualityType)
+			if quality == qualityBad || result.Value == nil {
+				slog.Debug("bad OPC UA node value", "name", node.Name, "status", result.Status)
+				readErrors++
 				continue
-			case errors.Is(err, ua.StatusBadSessionIDInvalid),
-				errors.Is(err, ua.StatusBadSessionNotActivated),
-				errors.Is(err, ua.StatusBadSecureChannelIDInvalid):
-				time.Sleep(o.ReadRetryInterval)
+			}
+			val, ok := node.convert(result.Value.Value())
+			if !ok {
+				slog.Debug("unsupported OPC UA node value", "name", node.Name, "type", fmt.Sprintf("%T", result.Value.Value()))
 				continue
-			default:
-				return err
 			}
+			g.Add("opcua:"+node.Name, val, node.metricType)
 		}
-		value := rsp.Results[0].Value.Value()
-		var val float64
-		switch v := value.(type) {
-		case float64:
-			val = v
-		case float32:
-			val = float64(v)
-		case int64:
-			val = float64(v)
-		case int32:
-			val = float64(v)
-		case int16:
-			val = float64(v)
-		case int8:
-			val = float64(v)
-		case uint64:
-			val = float64(v)
-		case uint32:
-			val = float64(v)
-		case uint16:
-			val = float64(v)
-		case uint8:
-			val = float64(v)
-		case bool:
-			if v {
-				val = 1
-			} else {
-				val = 0
-			}
-		default:
-			// ignore other types for now
-			continue
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	g.Add("opcua:read_errors", float64(readErrors), readErrorsType)
+	return nil
+}
+
+// readChunked reads the attribute of the nodes in the chunks of
+// the MaxNodesPerRead limit, and calls fn with the offset of each chunk.
+// If the read of a chunk fails, fn is called with the error and
+// the results of the length of the chunk, that are nil.
+// It stops at the first error that fn returns.
+func (o *OPCUA) readChunked(nodeIDs []*ua.NodeID, attr ua.AttributeID, fn func(offset int, results []*ua.DataValue, err error) error) error {
+	chunk := len(nodeIDs)
+	if o.maxNodesPerRead > 0 && o.maxNodesPerRead < chunk {
+		chunk = o.maxNodesPerRead
+	}
+	for offset := 0; offset < len(nodeIDs); offset += chunk {
+		end := min(offset+chunk, len(nodeIDs))
+		nodesToRead := make([]*ua.ReadValueID, 0, end-offset)
+		for _, nodeID := range nodeIDs[offset:end] {
+			nodesToRead = append(nodesToRead, &ua.ReadValueID{
+				NodeID:      nodeID,
+				AttributeID: attr,
+			})
+		}
+		rsp, err := o.read(&ua.ReadRequest{
+			MaxAge:             0,
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			NodesToRead:        nodesToRead,
+		})
+		if err == nil && len(rsp.Results) != len(nodesToRead) {
+			err = fmt.Errorf("got %d results for %d nodes", len(rsp.Results), len(nodesToRead))
+		}
+		results := make([]*ua.DataValue, len(nodesToRead))
+		if err == nil {
+			results = rsp.Results
+		}
+		if err := fn(offset, results, err); err != nil {
+			return err
 		}
-		g.Add("opcua:"+node.Name, val, metric.GaugeType(metric.UnitShort))
 	}
 	return nil
 }
 
+// read sends the request, retrying on the transient errors.
+func (o *OPCUA) read(req *ua.ReadRequest) (*ua.ReadResponse, error) {
+	var retry = 0
+	for {
+		rsp, err := o.client.Read(o.ctx, req)
+		if err == nil {
+			return rsp, nil
+		}
+		if retry >= o.ReadRetryCount {
+			return nil, err
+		}
+		retry++
+		switch {
+		case err == io.EOF && o.client.State() != opcua.Closed:
+			time.Sleep(o.ReadRetryInterval)
+			continue
+		case errors.Is(err, ua.StatusBadSessionIDInvalid),
+			errors.Is(err, ua.StatusBadSessionNotActivated),
+			errors.Is(err, ua.StatusBadSecureChannelIDInvalid):
+			time.Sleep(o.ReadRetryInterval)
+			continue
+		default:
+			return nil, err
+		}
+	}
+}
+
+// isConnError reports whether the error of the read is of the connection
+// or the session, rather than a status of the service for the nodes of the request.
+func isConnError(err error) bool {
+	var status ua.StatusCode
+	if !errors.As(err, &status) {
+		return true
+	}
+	switch status {
+	case ua.StatusBadSessionIDInvalid,
+		ua.StatusBadSessionNotActivated,
+		ua.StatusBadSessionClosed,
+		ua.StatusBadSecureChannelIDInvalid,
+		ua.StatusBadSecureChannelClosed,
+		ua.StatusBadConnectionClosed,
+		ua.StatusBadNotConnected,
+		ua.StatusBadServerNotConnected,
+		ua.StatusBadCommunicationError,
+		ua.StatusBadTimeout:
+		return true
+	}
+	return false
+}
+
+// quality of the node value, reported as "opcua:<name>:quality"
+const (
+	qualityGood      = 1.0
+	qualityUncertain = 0.5
+	qualityBad       = 0.0
+)
+
+var qualityType = metric.GaugeType(metric.UnitScalar)
+var readErrorsType = metric.CounterType(metric.UnitShort)
+
+// qualityOf returns the quality by the severity bits of the status code.
+func qualityOf(status ua.StatusCode) float64 {
+	switch uint32(status) >> 30 {
+	case 0:
+		return qualityGood
+	case 1:
+		return qualityUncertain
+	default:
+		return qualityBad
+	}
+}
+
+// readOperationLimits reads MaxNodesPerRead of the server capabilities,
+// the configured max_nodes_per_read takes precedence if it is smaller.
+func (o *OPCUA) readOperationLimits() {
+	o.maxNodesPerRead = o.MaxNodesPerRead
+	rsp, err := o.client.Read(o.ctx, &ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{{
+			NodeID:      ua.NewNumericNodeID(0, id.Server_ServerCapabilities_OperationLimits_MaxNodesPerRead),
+			AttributeID: ua.AttributeIDValue,
+		}},
+	})
+	if err != nil || len(rsp.Results) == 0 || rsp.Results[0].Status != ua.StatusOK || rsp.Results[0].Value == nil {
+		return
+	}
+	if limit, ok := toFloat(rsp.Results[0].Value.Value()); ok && limit > 0 {
+		if o.maxNodesPerRead == 0 || int(limit) < o.maxNodesPerRead {
+			o.maxNodesPerRead = int(limit)
+		}
+	}
+}
+
 func (o *OPCUA) connect() error {
 	if o.client != nil {
 		return nil
 	}
-	if c, err := opcua.NewClient(o.Endpoint, o.opts()...); err != nil {
+	opts, err := o.opts()
+	if err != nil {
+		return err
+	}
+	if c, err := opcua.NewClient(o.Endpoint, opts...); err != nil {
 		return err
 	} else {
 		o.client = c
@@ -190,53 +407,256 @@ func (o *OPCUA) connect() error {
 		o.client = nil
 		return err
 	}
+	o.readOperationLimits()
 	return nil
 }
 
 func (o *OPCUA) disconnect() {
+	o.unsubscribe()
 	if o.client != nil {
 		o.client.Close(o.ctx)
 		o.client = nil
 	}
 }
 
-func (o *OPCUA) opts() []opcua.Option {
+func (o *OPCUA) subscribe() error {
+	if o.sub != nil {
+		return nil
+	}
+	notifyCh := make(chan *opcua.PublishNotificationData, len(o.nodeIDs))
+	sub, err := o.client.Subscribe(o.ctx, &opcua.SubscriptionParameters{
+		Interval: o.PublishingInterval,
+	}, notifyCh)
+	if err != nil {
+		return err
+	}
+	var filter *ua.ExtensionObject
+	if deadband := strings.ToLower(o.DeadbandType); deadband == "absolute" || deadband == "percent" {
+		deadbandType := ua.DeadbandTypeAbsolute
+		if deadband == "percent" {
+			deadbandType = ua.DeadbandTypePercent
+		}
+		filter = &ua.ExtensionObject{
+			EncodingMask: ua.ExtensionObjectBinary,
+			TypeID: &ua.ExpandedNodeID{
+				NodeID: ua.NewNumericNodeID(0, id.DataChangeFilter_Encoding_DefaultBinary),
+			},
+			Value: ua.DataChangeFilter{
+				Trigger:       ua.DataChangeTriggerStatusValue,
+				DeadbandType:  uint32(deadbandType),
+				DeadbandValue: o.DeadbandValue,
+			},
+		}
+	}
+	items := make([]*ua.MonitoredItemCreateRequest, len(o.nodeIDs))
+	for i, nodeID := range o.nodeIDs {
+		// the client handle is the index of the node
+		item := opcua.NewMonitoredItemCreateRequestWithDefaults(nodeID, ua.AttributeIDValue, uint32(i))
+		item.RequestedParameters.SamplingInterval = float64(o.SamplingInterval) / float64(time.Millisecond)
+		item.RequestedParameters.QueueSize = o.QueueSize
+		item.RequestedParameters.Filter = filter
+		items[i] = item
+	}
+	rsp, err := sub.Monitor(o.ctx, ua.TimestampsToReturnBoth, items...)
+	if err != nil {
+		sub.Cancel(o.ctx)
+		return err
+	}
+	for i, res := range rsp.Results {
+		if res.StatusCode != ua.StatusOK {
+			slog.Warn("error monitoring OPC UA node", "name", o.Nodes[i].Name, "status", res.StatusCode)
+		}
+	}
+	ctx, cancel := context.WithCancel(o.ctx)
+	o.sub = sub
+	o.subCancel = cancel
+	go o.runNotification(ctx, notifyCh)
+	return nil
+}
+
+func (o *OPCUA) unsubscribe() {
+	if o.sub == nil {
+		return
+	}
+	o.subCancel()
+	if err := o.sub.Cancel(o.ctx); err != nil {
+		slog.Debug("error cancelling OPC UA subscription", "error", err)
+	}
+	o.sub = nil
+	o.subCancel = nil
+}
+
+func (o *OPCUA) runNotification(ctx context.Context, notifyCh <-chan *opcua.PublishNotificationData) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-notifyCh:
+			if n.Error != nil {
+				slog.Warn("OPC UA subscription error, subscribing again", "endpoint", o.Endpoint, "error", n.Error)
+				o.subscriptionLost()
+				return
+			}
+			if sc, ok := n.Value.(*ua.StatusChangeNotification); ok {
+				slog.Warn("OPC UA subscription status changed, subscribing again", "endpoint", o.Endpoint, "status", sc.Status)
+				o.subscriptionLost()
+				return
+			}
+			dcn, ok := n.Value.(*ua.DataChangeNotification)
+			if !ok {
+				continue
+			}
+			measures := make([]metric.Measure, 0, len(dcn.MonitoredItems))
+			for _, item := range dcn.MonitoredItems {
+				idx := int(item.ClientHandle)
+				if idx >= len(o.Nodes) || item.Value == nil {
+					continue
+				}
+				node := &o.Nodes[idx]
+				name := "opcua:" + node.Name
+				quality := qualityOf(item.Value.Status)
+				measures = append(measures, metric.Measure{
+					Name:  name + ":quality",
+					Value: quality,
+					Type:  qualityType,
+				})
+				if quality == qualityBad || item.Value.Value == nil {
+					continue
+				}
+				val, ok := node.convert(item.Value.Value.Value())
+				if !ok {
+					continue
+				}
+				measures = append(measures, metric.Measure{
+					Name:  name,
+					Value: val,
+					Type:  node.metricType,
+				})
+			}
+			if len(measures) > 0 {
+				o.push(measures...)
+			}
+		}
+	}
+}
+
+// subscriptionLost marks the nodes bad, and lets the next gathering
+// tear down the subscription and the connection, and subscribe again.
+func (o *OPCUA) subscriptionLost() {
+	measures := make([]metric.Measure, len(o.Nodes))
+	for i, node := range o.Nodes {
+		measures[i] = metric.Measure{Name: "opcua:" + node.Name + ":quality", Value: qualityBad, Type: qualityType}
+	}
+	o.push(measures...)
+	o.subLost.Store(true)
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func (o *OPCUA) opts() ([]opcua.Option, error) {
 	var ret []opcua.Option
+	var mode ua.MessageSecurityMode
 	switch o.SecurityMode {
 	case "None":
-		ret = append(ret,
-			opcua.SecurityMode(ua.MessageSecurityModeNone),
-			opcua.AuthAnonymous())
+		mode = ua.MessageSecurityModeNone
 	case "Sign":
-		ret = append(ret,
-			opcua.SecurityMode(ua.MessageSecurityModeSign),
-			opcua.AuthAnonymous())
+		mode = ua.MessageSecurityModeSign
 	case "SignAndEncrypt":
-		ret = append(ret,
-			opcua.SecurityMode(ua.MessageSecurityModeSignAndEncrypt),
-			opcua.AuthAnonymous())
-		switch strings.ToUpper(strings.TrimSpace(o.SecurityPolicy)) {
-		case "NONE":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURINone))
-		case "PREFIX":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURIPrefix))
-		case "BASIC128RSA15":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURIBasic128Rsa15))
-		case "BASIC256":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURIBasic256))
-		case "BASIC256SHA256":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURIBasic256Sha256))
-		case "AES128SHA256RSAOAP":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURIAes128Sha256RsaOaep))
-		case "AES256SHA256RSAPSS":
-			ret = append(ret, opcua.SecurityPolicy(ua.SecurityPolicyURIAes256Sha256RsaPss))
+		mode = ua.MessageSecurityModeSignAndEncrypt
+	case "":
+		// don't care, only for auto_select_endpoint
+		mode = ua.MessageSecurityModeInvalid
+	default:
+		return nil, fmt.Errorf("unknown security_mode %q", o.SecurityMode)
+	}
+	policy, err := securityPolicyURI(o.SecurityPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if !o.AutoSelectEndpoint {
+		ret = append(ret, opcua.SecurityMode(mode))
+		if mode != ua.MessageSecurityModeNone && policy != "" {
+			ret = append(ret, opcua.SecurityPolicy(policy))
 		}
+	}
+	if o.Certificate != "" || mode == ua.MessageSecurityModeSign || mode == ua.MessageSecurityModeSignAndEncrypt {
 		// Load client certificate and private key
 		ret = append(ret, opcua.CertificateFile(o.Certificate))
 		ret = append(ret, opcua.PrivateKeyFile(o.PrivateKey))
+	}
+
+	authOpts, tokenType, err := o.authOpts()
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, authOpts...)
+
+	if o.AutoSelectEndpoint {
+		endpoints, err := opcua.GetEndpoints(o.ctx, o.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("error getting endpoints: %w", err)
+		}
+		ep, err := opcua.SelectEndpoint(endpoints, policy, mode)
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("OPC UA endpoint selected", "url", ep.EndpointURL,
+			"security_policy", ep.SecurityPolicyURI, "security_mode", ep.SecurityMode)
+		// must be after the auth options, it sets the policy id of the user token
+		ret = append(ret, opcua.SecurityFromEndpoint(ep, tokenType))
+	}
+	return ret, nil
+}
 
+func securityPolicyURI(policy string) (string, error) {
+	switch strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(policy)), "_", "") {
+	case "":
+		return "", nil
+	case "NONE":
+		return ua.SecurityPolicyURINone, nil
+	case "PREFIX":
+		return ua.SecurityPolicyURIPrefix, nil
+	case "BASIC128RSA15":
+		return ua.SecurityPolicyURIBasic128Rsa15, nil
+	case "BASIC256":
+		return ua.SecurityPolicyURIBasic256, nil
+	case "BASIC256SHA256":
+		return ua.SecurityPolicyURIBasic256Sha256, nil
+	case "AES128SHA256RSAOAEP", "AES128SHA256RSAOAP":
+		return ua.SecurityPolicyURIAes128Sha256RsaOaep, nil
+	case "AES256SHA256RSAPSS":
+		return ua.SecurityPolicyURIAes256Sha256RsaPss, nil
 	default:
-		ret = append(ret, opcua.SecurityMode(ua.MessageSecurityModeNone))
+		return "", fmt.Errorf("unknown security_policy %q", policy)
 	}
-	return ret
 }
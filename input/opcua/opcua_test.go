@@ -0,0 +1,533 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/metric"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Debug(msg string, args ...any) {}
+func (l testLogger) Info(msg string, args ...any)  {}
+func (l testLogger) Warn(msg string, args ...any)  {}
+func (l testLogger) Error(msg string, args ...any) { l.t.Logf(msg, args...) }
+
+// testServer is an in-process OPC UA server
+// with variable nodes of string node ids in namespace 1.
+type testServer struct {
+	*server.Server
+	ns       *server.NodeNameSpace
+	endpoint string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	// find a free port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	s := server.New(
+		server.EnableSecurity("None", ua.MessageSecurityModeNone),
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+		server.EndPoint("127.0.0.1", port),
+		server.SetLogger(testLogger{t}),
+	)
+	require.NoError(t, s.Start(context.Background()))
+	t.Cleanup(func() { s.Close() })
+
+	ns := server.NewNodeNameSpace(s, "metrical_test")
+	root, _ := s.Namespace(0)
+	root.Objects().AddRef(ns.Objects(), id.HasComponent, true)
+	return &testServer{
+		Server:   s,
+		ns:       ns,
+		endpoint: fmt.Sprintf("opc.tcp://127.0.0.1:%d", port),
+	}
+}
+
+func (s *testServer) addVariable(name string, value any) *server.Node {
+	n := s.ns.AddNewVariableStringNode(name, value)
+	s.ns.Objects().AddRef(n, id.HasComponent, true)
+	return n
+}
+
+func (s *testServer) setValue(n *server.Node, value any) {
+	n.SetAttribute(ua.AttributeIDValue, &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueSourceTimestamp,
+		Value:           ua.MustVariant(value),
+		SourceTimestamp: time.Now(),
+	})
+	s.ns.ChangeNotification(n.ID())
+}
+
+func (s *testServer) nsIndex() string {
+	return fmt.Sprintf("%d", s.ns.ID())
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(t)
+	temp := s.addVariable("Temperature", float64(20))
+	s.addVariable("Pressure", int32(100))
+
+	var mu sync.Mutex
+	var pushed []metric.Measure
+	o := &OPCUA{
+		Endpoint:           s.endpoint,
+		Mode:               "subscribe",
+		PublishingInterval: 50 * time.Millisecond,
+		Nodes: []Node{
+			{Name: "temp", Namespace: s.nsIndex(), IdType: "s", Id: "Temperature"},
+			{Name: "pressure", Namespace: s.nsIndex(), IdType: "s", Id: "Pressure"},
+		},
+	}
+	o.SetPush(func(ms ...metric.Measure) {
+		mu.Lock()
+		pushed = append(pushed, ms...)
+		mu.Unlock()
+	})
+	require.NoError(t, o.Init())
+	defer o.DeInit()
+
+	// the initial values are notified
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(pushed) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, v := range []float64{21, 22, 23} {
+		s.setValue(temp, v)
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(pushed) > 0 && pushed[len(pushed)-1].Value == 23
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	values := map[string][]float64{}
+	for _, m := range pushed {
+		values[m.Name] = append(values[m.Name], m.Value)
+		if strings.HasSuffix(m.Name, ":quality") {
+			require.Equal(t, "gauge", m.Type.Name())
+		} else {
+			require.Equal(t, "meter", m.Type.Name())
+		}
+	}
+	require.Equal(t, []float64{20, 21, 22, 23}, values["opcua:temp"])
+	require.Equal(t, []float64{100}, values["opcua:pressure"])
+	require.Equal(t, []float64{1, 1, 1, 1}, values["opcua:temp:quality"])
+
+	// gathering in subscribe mode does not read the nodes
+	require.NoError(t, o.Gather(&metric.Gather{}))
+}
+
+func TestSubscriptionLost(t *testing.T) {
+	for _, n := range []*opcua.PublishNotificationData{
+		{Error: errors.New("publish failed")},
+		{Value: &ua.StatusChangeNotification{Status: ua.StatusBadTimeout}},
+	} {
+		var pushed []metric.Measure
+		o := &OPCUA{Endpoint: "opc.tcp://127.0.0.1:1", Nodes: []Node{{Name: "temp"}}, ctx: context.Background()}
+		o.SetPush(func(ms ...metric.Measure) { pushed = append(pushed, ms...) })
+		notifyCh := make(chan *opcua.PublishNotificationData, 1)
+		notifyCh <- n
+		o.runNotification(context.Background(), notifyCh)
+		require.True(t, o.subLost.Load())
+		require.Len(t, pushed, 1)
+		require.Equal(t, "opcua:temp:quality", pushed[0].Name)
+		require.Equal(t, qualityBad, pushed[0].Value)
+
+		// the next gathering reconnects, that fails without the server
+		require.Error(t, o.Gather(&metric.Gather{}))
+		require.False(t, o.subLost.Load())
+	}
+}
+
+func TestSubscribeRequiresPush(t *testing.T) {
+	o := &OPCUA{
+		Endpoint: "opc.tcp://127.0.0.1:4840",
+		Mode:     "subscribe",
+		Nodes:    []Node{{Name: "temp", Namespace: "1", IdType: "s", Id: "Temperature"}},
+	}
+	require.Error(t, o.Init())
+}
+
+func lastValue(t *testing.T, c *metric.Collector, name string) metric.Value {
+	t.Helper()
+	mts := c.Timeseries(name)
+	require.NotNil(t, mts, name)
+	_, v := mts[0].Last()
+	return v
+}
+
+func TestPollBatchAndQuality(t *testing.T) {
+	s := newTestServer(t)
+	s.addVariable("Temperature", float64(20.5))
+	s.addVariable("Pressure", int32(100))
+	s.addVariable("Running", true)
+	bad := s.addVariable("Broken", float64(1))
+	bad.SetAttribute(ua.AttributeIDValue, &ua.DataValue{
+		EncodingMask: ua.DataValueValue | ua.DataValueStatusCode,
+		Value:        ua.MustVariant(float64(999)),
+		Status:       ua.StatusBadSensorFailure,
+	})
+
+	for _, maxNodesPerRead := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("max_nodes_per_read_%d", maxNodesPerRead), func(t *testing.T) {
+			o := &OPCUA{
+				Endpoint:        s.endpoint,
+				MaxNodesPerRead: maxNodesPerRead,
+				Nodes: []Node{
+					{Name: "temp", Namespace: s.nsIndex(), IdType: "s", Id: "Temperature"},
+					{Name: "pressure", Namespace: s.nsIndex(), IdType: "s", Id: "Pressure"},
+					{Name: "missing", Namespace: s.nsIndex(), IdType: "s", Id: "NotExists"},
+					{Name: "running", Namespace: s.nsIndex(), IdType: "s", Id: "Running"},
+					{Name: "broken", Namespace: s.nsIndex(), IdType: "s", Id: "Broken"},
+				},
+			}
+			seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+			require.NoError(t, err)
+			c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+			require.NoError(t, c.AddInput(o))
+			defer o.DeInit()
+
+			require.Equal(t, 20.5, lastValue(t, c, "opcua:temp").(*metric.GaugeValue).Value)
+			require.Equal(t, 100.0, lastValue(t, c, "opcua:pressure").(*metric.GaugeValue).Value)
+			require.Equal(t, 1.0, lastValue(t, c, "opcua:running").(*metric.GaugeValue).Value)
+			// bad values are not reported
+			require.Nil(t, c.Timeseries("opcua:missing"))
+			require.Nil(t, c.Timeseries("opcua:broken"))
+
+			require.Equal(t, qualityGood, lastValue(t, c, "opcua:temp:quality").(*metric.GaugeValue).Value)
+			require.Equal(t, qualityBad, lastValue(t, c, "opcua:missing:quality").(*metric.GaugeValue).Value)
+			require.Equal(t, qualityBad, lastValue(t, c, "opcua:broken:quality").(*metric.GaugeValue).Value)
+			require.Equal(t, 2.0, lastValue(t, c, "opcua:read_errors").(*metric.CounterValue).Value)
+		})
+	}
+}
+
+// proxy forwards the connections to the address until closed,
+// closing it drops the connections as if the server went away.
+type proxy struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newProxy(t *testing.T, addr string) *proxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &proxy{Listener: ln}
+	t.Cleanup(p.close)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			up, err := net.Dial("tcp", addr)
+			if err != nil {
+				c.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, c, up)
+			p.mu.Unlock()
+			go io.Copy(up, c)
+			go io.Copy(c, up)
+		}
+	}()
+	return p
+}
+
+func (p *proxy) close() {
+	p.Listener.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+}
+
+func TestPollServerGone(t *testing.T) {
+	s := newTestServer(t)
+	s.addVariable("Temperature", float64(20.5))
+	p := newProxy(t, strings.TrimPrefix(s.endpoint, "opc.tcp://"))
+	o := &OPCUA{
+		Endpoint:          "opc.tcp://" + p.Addr().String(),
+		ConnRetryInterval: 10 * time.Millisecond,
+		ConnRetryCount:    1,
+		Nodes: []Node{
+			{Name: "temp", Namespace: s.nsIndex(), IdType: "s", Id: "Temperature"},
+		},
+	}
+	require.NoError(t, o.Init())
+	defer o.DeInit()
+	require.NoError(t, o.Gather(&metric.Gather{}))
+
+	// the read error disconnects, the next gathering fails to reconnect
+	p.close()
+	require.Error(t, o.Gather(&metric.Gather{}))
+	require.Nil(t, o.client)
+	start := time.Now()
+	require.Error(t, o.Gather(&metric.Gather{}))
+	require.GreaterOrEqual(t, time.Since(start), o.ConnRetryInterval)
+}
+
+func TestIsConnError(t *testing.T) {
+	require.True(t, isConnError(io.EOF))
+	require.True(t, isConnError(ua.StatusBadSessionIDInvalid))
+	require.True(t, isConnError(fmt.Errorf("read: %w", ua.StatusBadConnectionClosed)))
+	require.False(t, isConnError(ua.StatusBadTooManyOperations))
+	require.False(t, isConnError(ua.StatusBadNodeIDUnknown))
+}
+
+func TestQualityOf(t *testing.T) {
+	require.Equal(t, qualityGood, qualityOf(ua.StatusOK))
+	require.Equal(t, qualityGood, qualityOf(ua.StatusGoodClamped))
+	require.Equal(t, qualityUncertain, qualityOf(ua.StatusUncertainLastUsableValue))
+	require.Equal(t, qualityBad, qualityOf(ua.StatusBadNodeIDUnknown))
+}
+
+func TestNodeConvert(t *testing.T) {
+	scale := 10.0
+	n := Node{Name: "state", Enum: map[string]float64{"RUN": 1, "STOP": 0}, Scale: &scale, Offset: 1}
+	require.NoError(t, n.init("gauge"))
+
+	tests := []struct {
+		value  any
+		expect float64
+		ok     bool
+	}{
+		{value: "RUN", expect: 11, ok: true},
+		{value: "STOP", expect: 1, ok: true},
+		{value: " 2.5 ", expect: 26, ok: true},
+		{value: "UNKNOWN", ok: false},
+		{value: int16(3), expect: 31, ok: true},
+		{value: []float32{4, 5}, expect: 41, ok: true},
+		{value: []string{}, ok: false},
+		{value: time.Unix(2, 0), expect: 21, ok: true},
+		{value: struct{}{}, ok: false},
+	}
+	for _, tt := range tests {
+		val, ok := n.convert(tt.value)
+		require.Equal(t, tt.ok, ok, "%v", tt.value)
+		if ok {
+			require.Equal(t, tt.expect, val, "%v", tt.value)
+		}
+	}
+
+	n = Node{Name: "second", Index: 1}
+	require.NoError(t, n.init("gauge"))
+	val, ok := n.convert([]int32{7, 8, 9})
+	require.True(t, ok)
+	require.Equal(t, 8.0, val)
+
+	scale = 0
+	n = Node{Name: "zero", Scale: &scale, Offset: 1}
+	require.NoError(t, n.init("gauge"))
+	val, ok = n.convert(int16(7))
+	require.True(t, ok)
+	require.Equal(t, 1.0, val)
+
+	require.Error(t, (&Node{Name: "x", Type: "unknown"}).init("gauge"))
+	require.Error(t, (&Node{Name: "x", Unit: "unknown"}).init("gauge"))
+}
+
+func TestPollNodeTypes(t *testing.T) {
+	s := newTestServer(t)
+	s.addVariable("Totalizer", uint32(1200))
+	s.addVariable("Temperature", float64(20.5))
+	s.addVariable("State", "RUN")
+	s.addVariable("Levels", []float64{1.5, 2.5})
+
+	scale := 1024.0
+	o := &OPCUA{
+		Endpoint: s.endpoint,
+		Nodes: []Node{
+			{Name: "total", Namespace: s.nsIndex(), IdType: "s", Id: "Totalizer", Type: "odometer", Unit: "bytes", Scale: &scale},
+			{Name: "temp", Namespace: s.nsIndex(), IdType: "s", Id: "Temperature", Type: "meter", Unit: "scalar", Offset: 273.15},
+			{Name: "state", Namespace: s.nsIndex(), IdType: "s", Id: "State", Enum: map[string]float64{"RUN": 1}},
+			{Name: "level", Namespace: s.nsIndex(), IdType: "s", Id: "Levels", Index: 1},
+		},
+	}
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+	require.NoError(t, c.AddInput(o))
+	defer o.DeInit()
+
+	total := lastValue(t, c, "opcua:total").(*metric.OdometerValue)
+	require.Equal(t, 1200.0*1024, total.Last)
+	require.Equal(t, metric.UnitBytes, c.Timeseries("opcua:total")[0].Meta().(metric.SeriesInfo).MeasureType.Unit())
+	temp := lastValue(t, c, "opcua:temp").(*metric.MeterValue)
+	require.Equal(t, 293.65, temp.Last)
+	require.Equal(t, 1.0, lastValue(t, c, "opcua:state").(*metric.GaugeValue).Value)
+	require.Equal(t, 2.5, lastValue(t, c, "opcua:level").(*metric.GaugeValue).Value)
+}
+
+func TestAutoSelectEndpoint(t *testing.T) {
+	s := newTestServer(t)
+	s.addVariable("Temperature", float64(20.5))
+
+	o := &OPCUA{
+		Endpoint:           s.endpoint,
+		AutoSelectEndpoint: true,
+		Nodes:              []Node{{Name: "temp", Namespace: s.nsIndex(), IdType: "s", Id: "Temperature"}},
+	}
+	require.NoError(t, o.Init())
+	defer o.DeInit()
+	require.NotNil(t, o.client)
+
+	// no endpoint matches
+	o2 := &OPCUA{
+		Endpoint:           s.endpoint,
+		AutoSelectEndpoint: true,
+		SecurityMode:       "SignAndEncrypt",
+		SecurityPolicy:     "Basic256Sha256",
+		Nodes:              []Node{{Name: "temp", Namespace: s.nsIndex(), IdType: "s", Id: "Temperature"}},
+	}
+	require.Error(t, o2.Init())
+}
+
+func TestAuthOpts(t *testing.T) {
+	tests := []struct {
+		name      string
+		o         *OPCUA
+		tokenType ua.UserTokenType
+		wantErr   bool
+	}{
+		{name: "default", o: &OPCUA{}, tokenType: ua.UserTokenTypeAnonymous},
+		{name: "username", o: &OPCUA{AuthMethod: "username", Username: "user", Password: "secret"}, tokenType: ua.UserTokenTypeUserName},
+		{name: "username without user", o: &OPCUA{AuthMethod: "username"}, wantErr: true},
+		{name: "certificate without files", o: &OPCUA{AuthMethod: "certificate"}, wantErr: true},
+		{name: "unknown", o: &OPCUA{AuthMethod: "kerberos"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tokenType, err := tt.o.authOpts()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.tokenType, tokenType)
+		})
+	}
+}
+
+func TestSecurityPolicyURI(t *testing.T) {
+	for policy, expect := range map[string]string{
+		"":                      "",
+		"None":                  ua.SecurityPolicyURINone,
+		"Basic256Sha256":        ua.SecurityPolicyURIBasic256Sha256,
+		"Aes128_Sha256_RsaOaep": ua.SecurityPolicyURIAes128Sha256RsaOaep,
+		"Aes256_Sha256_RsaPss":  ua.SecurityPolicyURIAes256Sha256RsaPss,
+	} {
+		uri, err := securityPolicyURI(policy)
+		require.NoError(t, err, policy)
+		require.Equal(t, expect, uri, policy)
+	}
+	_, err := securityPolicyURI("Unknown")
+	require.Error(t, err)
+}
+
+func TestBrowse(t *testing.T) {
+	s := newTestServer(t)
+	temp := s.addVariable("Temperature", float64(20.5))
+	temp.SetAttribute(ua.AttributeIDDataType, &ua.DataValue{
+		EncodingMask: ua.DataValueValue,
+		Value:        ua.MustVariant(ua.NewNumericExpandedNodeID(0, id.Double)),
+	})
+	s.addVariable("Pressure", int32(100))
+	s.addVariable("Mode", "RUN")
+
+	out := &strings.Builder{}
+	err := BrowseCommand([]string{"-endpoint", s.endpoint, "-pattern", "Temp*"}, out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "ns="+s.nsIndex()+";s=Temperature")
+	require.Contains(t, out.String(), "Double")
+	require.NotContains(t, out.String(), "Pressure")
+
+	// the data types are read in the chunks of the limit
+	out.Reset()
+	err = BrowseCommand([]string{"-endpoint", s.endpoint, "-pattern", "Temp*", "-max-nodes-per-read", "1"}, out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "Double")
+
+	out.Reset()
+	err = BrowseCommand([]string{"-endpoint", s.endpoint, "-pattern", "Pressure", "-toml"}, out)
+	require.NoError(t, err)
+	o := struct {
+		Input struct {
+			OPCUA []OPCUA `toml:"opcua"`
+		} `toml:"input"`
+	}{}
+	// the printed nodes are ready to paste under [[input.opcua]]
+	_, err = toml.Decode("[[input.opcua]]\n"+out.String(), &o)
+	require.NoError(t, err, out.String())
+	require.Len(t, o.Input.OPCUA, 1)
+	require.Len(t, o.Input.OPCUA[0].Nodes, 1)
+	node := o.Input.OPCUA[0].Nodes[0]
+	require.Equal(t, s.nsIndex(), node.Namespace)
+	require.Equal(t, "s", node.IdType)
+	require.Equal(t, "Pressure", node.Id)
+	require.True(t, strings.HasSuffix(node.Name, "Pressure"), node.Name)
+
+	err = BrowseCommand([]string{"-endpoint", s.endpoint, "-pattern", "NotExist"}, out)
+	require.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	s := newTestServer(t)
+	s.addVariable("Temp1", float64(20))
+	s.addVariable("Temp2", float64(30))
+	s.addVariable("Pressure", int32(100))
+
+	o := &OPCUA{
+		Endpoint: s.endpoint,
+		Nodes: []Node{
+			{Name: "first", Namespace: s.nsIndex(), IdType: "s", Id: "Temp1"},
+		},
+		Discover: []Discover{{Pattern: "Temp*", Unit: "percent"}},
+	}
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+	require.NoError(t, c.AddInput(o))
+	defer o.DeInit()
+	// Temp1 is configured already, only Temp2 is added
+	require.Len(t, o.Nodes, 2)
+	require.Equal(t, "Temp2", o.Nodes[1].Id)
+	require.Equal(t, "percent", o.Nodes[1].Unit)
+
+	require.Equal(t, 20.0, lastValue(t, c, "opcua:first").(*metric.GaugeValue).Value)
+	require.Equal(t, 30.0, lastValue(t, c, "opcua:"+o.Nodes[1].Name).(*metric.GaugeValue).Value)
+
+	o2 := &OPCUA{
+		Endpoint: s.endpoint,
+		Discover: []Discover{{Path: "NotExist"}},
+	}
+	require.Error(t, o2.Init())
+}
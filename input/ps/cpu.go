@@ -20,6 +20,10 @@ func (c *CPU) SampleConfig() string {
 	return cpuSampleConfig
 }
 
+func (c *CPU) Description() string {
+	return "CPU usage percent, total or per CPU"
+}
+
 type CPU struct {
 	PerCPU     bool        `toml:"per_cpu"`
 	metricType metric.Type `toml:"-"`
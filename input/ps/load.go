@@ -19,6 +19,10 @@ func (l *Load) SampleConfig() string {
 	return loadSampleConfig
 }
 
+func (l *Load) Description() string {
+	return "System load averages"
+}
+
 var _ metric.Input = (*Load)(nil)
 
 type Load struct {
@@ -20,6 +20,10 @@ func (ms *Memory) SampleConfig() string {
 	return memSampleConfig
 }
 
+func (ms *Memory) Description() string {
+	return "System memory usage"
+}
+
 type Memory struct {
 	metricPercentType metric.Type `toml:"-"`
 }
@@ -20,6 +20,10 @@ func (n *Net) SampleConfig() string {
 	return netSampleConfig
 }
 
+func (n *Net) Description() string {
+	return "Network interface I/O counters"
+}
+
 // bytes_sent, bytes_recv, packets_sent, packets_recv, err_in, err_out, drop_in, drop_out
 type Net struct {
 	Interfaces []string `toml:"interfaces"` // empty for all interfaces (default) e.g. []{"eth*", "en*"}
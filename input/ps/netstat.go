@@ -21,6 +21,10 @@ func (n *NetStat) SampleConfig() string {
 
 }
 
+func (n *NetStat) Description() string {
+	return "TCP connection states and UDP sockets"
+}
+
 // status -> metric_name
 var statusList = map[string]string{
 	"ESTABLISHED": "tcp_established",
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
 	"fmt"
@@ -9,41 +10,60 @@ import (
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/audit"
+	"github.com/OutOfBedlam/metrical/derived"
+	"github.com/OutOfBedlam/metrical/export/opcuaserver"
+	"github.com/OutOfBedlam/metrical/ingest"
 	_ "github.com/OutOfBedlam/metrical/input/disk"
 	_ "github.com/OutOfBedlam/metrical/input/diskio"
+	_ "github.com/OutOfBedlam/metrical/input/execd"
 	_ "github.com/OutOfBedlam/metrical/input/gostat"
-	_ "github.com/OutOfBedlam/metrical/input/opcua"
+	_ "github.com/OutOfBedlam/metrical/input/modbus"
 	_ "github.com/OutOfBedlam/metrical/input/ps"
+	"github.com/OutOfBedlam/metrical/middleware/auth"
+	"github.com/OutOfBedlam/metrical/middleware/graceful"
 	"github.com/OutOfBedlam/metrical/middleware/httpstat"
+	_ "github.com/OutOfBedlam/metrical/output/execd"
+	_ "github.com/OutOfBedlam/metrical/output/metrical"
 	_ "github.com/OutOfBedlam/metrical/output/ndjson"
+	_ "github.com/OutOfBedlam/metrical/processor/convert"
+	_ "github.com/OutOfBedlam/metrical/processor/drop"
+	_ "github.com/OutOfBedlam/metrical/processor/rename"
 	"github.com/OutOfBedlam/metrical/registry"
-	"github.com/OutOfBedlam/metrical/store/sqlite"
+	"github.com/OutOfBedlam/metrical/sshterm"
+	"github.com/OutOfBedlam/metrical/stream"
+	"github.com/OutOfBedlam/metrical/tlsconf"
 	"github.com/OutOfBedlam/webterm"
 	"github.com/OutOfBedlam/webterm/webexec"
 	"github.com/OutOfBedlam/webterm/webport"
-	"github.com/OutOfBedlam/webterm/webssh"
 	"github.com/OutOfBedlam/webterm/webtail"
-	"golang.org/x/crypto/ssh"
 )
 
-//go:generate go run main.go -gen-config ./metrical-example.conf
+//go:generate go run . -gen-config ./metrical-example.conf
 
 type Metrical struct {
-	Log       LogConfig         `toml:"log"`
-	Data      DataConfig        `toml:"data"`
-	Http      HttpConfig        `toml:"http"`
-	Collector *metric.Collector `toml:"-"`
-	Storage   metric.Storage    `toml:"-"`
+	Log         LogConfig          `toml:"log"`
+	Data        DataConfig         `toml:"data"`
+	Http        HttpConfig         `toml:"http"`
+	OPCUAServer opcuaserver.Config `toml:"opcua_server"`
+	Collector   *metric.Collector  `toml:"-"`
+	Storage     metric.Storage     `toml:"-"`
 
 	instantiatedInputs []string
+	selfStat           *registry.SelfStat
+	tags               *registry.Tags
+	stream             *stream.Broker
+	audit              *audit.Auditor
 }
 
 type LogConfig struct {
@@ -81,13 +101,25 @@ func (ll *LogLevel) Level() *slog.LevelVar {
 }
 
 type HttpConfig struct {
-	Listen    string            `toml:"listen"`
-	AdvAddr   string            `toml:"adv_addr"`
-	Dashboard []DashboardConfig `toml:"dashboard"`
-	Tails     []WebTailConfig   `toml:"tail"`
-	Terms     []WebTermConfig   `toml:"term"`
-	SSHs      []WebSSHConfig    `toml:"ssh"`
-	Ports     []WebPortConfig   `toml:"port"`
+	Listen          string            `toml:"listen"`
+	SocketMode      string            `toml:"socket_mode"`
+	ShutdownTimeout time.Duration     `toml:"shutdown_timeout"`
+	AdvAddr         string            `toml:"adv_addr"`
+	TLSCert         string            `toml:"tls_cert"`
+	TLSKey          string            `toml:"tls_key"`
+	ClientCA        string            `toml:"client_ca"`
+	TLSMinVersion   string            `toml:"tls_min_version"`
+	TLSSelfSigned   bool              `toml:"tls_self_signed"`
+	Ingest          bool              `toml:"ingest"`
+	IngestMaxAge    time.Duration     `toml:"ingest_max_age"`
+	Stream          bool              `toml:"stream"`
+	Auth            auth.Config       `toml:"auth"`
+	Audit           audit.Config      `toml:"audit"`
+	Dashboard       []DashboardConfig `toml:"dashboard"`
+	Tails           []WebTailConfig   `toml:"tail"`
+	Terms           []WebTermConfig   `toml:"term"`
+	SSHs            []WebSSHConfig    `toml:"ssh"`
+	Ports           []WebPortConfig   `toml:"port"`
 }
 
 type DashboardConfig struct {
@@ -113,22 +145,30 @@ type WebTermConfig struct {
 }
 
 type WebSSHConfig struct {
-	Path     string      `toml:"path"`
-	Host     string      `toml:"host"`
-	Port     int         `toml:"port"`
-	User     string      `toml:"user"`
-	Password string      `toml:"password"`
-	Keyfile  string      `toml:"keyfile"`
-	Via      []WebSSHVia `toml:"via"`
-	Command  string      `toml:"command"`
+	Path              string      `toml:"path"`
+	Host              string      `toml:"host"`
+	Port              int         `toml:"port"`
+	User              string      `toml:"user"`
+	Password          string      `toml:"password"`
+	Keyfile           string      `toml:"keyfile"`
+	KeyfilePassphrase string      `toml:"keyfile_passphrase"`
+	HostKey           string      `toml:"host_key"`
+	KnownHosts        string      `toml:"known_hosts"`
+	HostKeyCheck      string      `toml:"host_key_check"`
+	Agent             bool        `toml:"agent"`
+	ForwardAgent      bool        `toml:"forward_agent"`
+	Via               []WebSSHVia `toml:"via"`
+	Command           string      `toml:"command"`
 }
 
 type WebSSHVia struct {
-	Host     string `toml:"host"`
-	Port     int    `toml:"port"`
-	User     string `toml:"user"`
-	Password string `toml:"password"`
-	Keyfile  string `toml:"keyfile"`
+	Host              string `toml:"host"`
+	Port              int    `toml:"port"`
+	User              string `toml:"user"`
+	Password          string `toml:"password"`
+	Keyfile           string `toml:"keyfile"`
+	KeyfilePassphrase string `toml:"keyfile_passphrase"`
+	HostKey           string `toml:"host_key"`
 }
 
 type WebPortConfig struct {
@@ -143,6 +183,8 @@ type DataConfig struct {
 	Store            string             `toml:"store"`
 	Filter           FilterConfig       `toml:"filter"`
 	Timeseries       []TimeseriesConfig `toml:"timeseries"`
+	Derived          []derived.Config   `toml:"derived"`
+	Tags             map[string]string  `toml:"tags"`
 }
 
 type TimeseriesConfig struct {
@@ -163,33 +205,46 @@ var configContent string
 //go:embed static/*
 var staticFS embed.FS
 
-func main() {
-	var configFilename string
+// runCommand runs the collector with the inputs and outputs,
+// and the HTTP and OPC UA servers until SIGINT or SIGTERM.
+func runCommand(args []string) error {
 	var genConfigFilename string
-
-	flag.StringVar(&configFilename, "config", "", "metrical config file path")
-	flag.StringVar(&genConfigFilename, "gen-config", "", "Generates default config to the given filename")
-	flag.Parse()
-
-	mc := Metrical{}
-	_, err := toml.Decode(configContent, &mc)
-	if err != nil {
-		panic(err)
-	}
+	var checkConfig bool
+	var strictConfig bool
+	var testMode bool
+	var testInputNames string
+	var testFormat string
+
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	cf := addConfigFlags(fs)
+	fs.BoolVar(&checkConfig, "check-config", false, "checks the config without starting, and exits non-zero on errors")
+	fs.BoolVar(&strictConfig, "strict", false, "refuses to start if the config has unknown keys or invalid values")
+	fs.BoolVar(&testMode, "test", false, "gathers the inputs once, prints the measurements and exits")
+	fs.StringVar(&testInputNames, "input", "", "comma separated input names of -test, e.g. cpu,disk")
+	fs.StringVar(&testFormat, "format", "table", "output format of -test, table or ndjson")
+	fs.StringVar(&genConfigFilename, "gen-config", "", "Generates default config to the given filename")
+	fs.Parse(args)
 
 	if genConfigFilename != "" {
-		mc.genConfig(genConfigFilename)
-		return
+		Metrical{}.genConfig(genConfigFilename)
+		return nil
 	}
-	if configFilename != "" {
-		if b, err := os.ReadFile(configFilename); err != nil {
-			panic(err)
-		} else {
-			configContent = string(b)
+	mc, cfg, meta, err := cf.load()
+	if err != nil {
+		return err
+	}
+	configErr := mc.checkConfig(cfg, meta)
+	if checkConfig || strictConfig {
+		if configErr != nil {
+			return configErr
+		}
+		if checkConfig {
+			fmt.Println("config is valid")
+			return nil
 		}
 	}
-	if _, err := toml.Decode(configContent, &mc); err != nil {
-		panic(err)
+	if testMode {
+		return testInputs(cfg.Content, testInputNames, testFormat, os.Stdout)
 	}
 
 	logWriter := io.Discard
@@ -199,7 +254,7 @@ func main() {
 	if mc.Log.Filename != "" {
 		logFile, err := os.OpenFile(mc.Log.Filename, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			panic(fmt.Sprintf("Failed to open log file %s: %v", mc.Log.Filename, err))
+			return fmt.Errorf("failed to open log file %s: %w", mc.Log.Filename, err)
 		}
 		if mc.Log.Stdout {
 			logWriter = io.MultiWriter(logWriter, logFile)
@@ -211,47 +266,76 @@ func main() {
 	logHandler := slog.NewTextHandler(logWriter, &slog.HandlerOptions{Level: mc.Log.Level.Level()})
 	slog.SetDefault(slog.New(logHandler))
 
-	if mc.Data.Store != "" {
-		if strings.HasPrefix(mc.Data.Store, "sqlite:") {
-			path := strings.TrimPrefix(mc.Data.Store, "sqlite:")
-			if storage, err := sqlite.NewStorage(path, mc.Data.InputBuffer); err != nil {
-				panic(err)
-			} else {
-				mc.Storage = storage
-			}
-		} else { // default to file storage
-			mc.Storage = metric.NewFileStorage(mc.Data.Store, mc.Data.InputBuffer)
-		}
-		if mc.Storage != nil {
-			if opener, ok := mc.Storage.(interface{ Open() error }); ok {
-				if err := opener.Open(); err != nil {
-					panic(err)
-				}
-			}
+	if configErr != nil {
+		for _, err := range configErr.(interface{ Unwrap() []error }).Unwrap() {
+			slog.Warn("Config", "error", err)
 		}
 	}
+
+	if err := mc.openStorage(); err != nil {
+		return err
+	}
 	// load registry and inputs/outputs,
 	// it requires mc.Storage to restore the previous timeseries
-	if err := mc.loadCollector(configContent); err != nil {
-		panic(err)
+	if err := mc.loadCollector(cfg.Content); err != nil {
+		return err
 	}
 	mc.Collector.Start()
 	defer func() {
 		mc.Collector.Stop()
-		if closer, ok := mc.Storage.(interface{ Close() error }); ok {
-			closer.Close()
-		}
+		mc.closeStorage()
 	}()
 
+	// opc ua server
+	if mc.OPCUAServer.Listen != "" {
+		uaSvr, err := opcuaserver.New(mc.Collector, mc.OPCUAServer)
+		if err != nil {
+			return err
+		}
+		if err := uaSvr.Start(); err != nil {
+			return err
+		}
+		defer uaSvr.Stop()
+		slog.Info("- OPC UA server " + strings.Join(uaSvr.Endpoints(), ", "))
+	}
+
 	// http server
 	if mc.Http.Listen != "" {
 		fileSvrFS := http.FileServerFS(staticFS)
 		mux := http.NewServeMux()
+		tracker := graceful.NewTracker()
+		if mc.Http.Audit.Enabled() {
+			a, err := audit.New(mc.Http.Audit)
+			if err != nil {
+				return fmt.Errorf("http.audit: %w", err)
+			}
+			defer a.Close()
+			mc.audit = a
+			mux.Handle(a.Path(), a)
+			slog.Info("- Audit " + mc.Http.AdvAddr + a.Path())
+		}
+		var ingestHandler *ingest.Handler
+		if mc.Http.Ingest {
+			ingestHandler = ingest.NewHandler(mc.Collector, mc.tags)
+			if mc.Http.IngestMaxAge > 0 {
+				ingestHandler.MaxAge = mc.Http.IngestMaxAge
+			}
+			mux.Handle("/api/v1/ingest", ingestHandler)
+			mux.HandleFunc("/api/v1/hosts", ingestHandler.ServeHosts)
+			slog.Info("- Ingest " + mc.Http.AdvAddr + "/api/v1/ingest")
+		}
+		if mc.stream != nil {
+			mux.Handle("/api/v1/stream", mc.stream)
+			slog.Info("- Stream " + mc.Http.AdvAddr + "/api/v1/stream")
+		}
 		for _, cfg := range mc.Http.Dashboard {
 			if path := cfg.Path; path != "" {
 				path = strings.TrimSuffix(path, "/") + "/"
 				mux.Handle(path, mc.makeDashboard())
 				slog.Info("- Dashboard " + mc.Http.AdvAddr + path)
+				if ingestHandler != nil {
+					mux.Handle(path+"host/", mc.makeHostDashboards(path+"host/", ingestHandler))
+				}
 			}
 		}
 		for _, cfg := range mc.Http.Tails {
@@ -261,24 +345,21 @@ func main() {
 				v.Filename = strings.ReplaceAll(v.Filename, "${log-filename}", mc.Log.Filename)
 				cfg.Files[i] = v
 			}
-			mux.Handle(path, mc.makeTail(path, cfg.Files))
+			mux.Handle(path, tracker.Handler(graceful.Terminal, mc.makeTail(path, cfg.Files)))
 			slog.Info("- Tail " + mc.Http.AdvAddr + path)
 		}
 		for _, cfg := range mc.Http.Terms {
 			path := strings.TrimSuffix(cfg.Path, "/") + "/"
-			mux.Handle(path, mc.makeTerminal(path, cfg.Command, cfg.Args, cfg.Dir))
+			mux.Handle(path, tracker.Handler(graceful.Terminal, mc.makeTerminal(path, cfg.Command, cfg.Args, cfg.Dir)))
 			slog.Info("- Term " + mc.Http.AdvAddr + path)
 		}
 		for _, cfg := range mc.Http.SSHs {
 			path := strings.TrimSuffix(cfg.Path, "/") + "/"
-			via := append(cfg.Via, WebSSHVia{
-				Host:     cfg.Host,
-				Port:     cfg.Port,
-				User:     cfg.User,
-				Password: cfg.Password,
-				Keyfile:  cfg.Keyfile,
-			})
-			mux.Handle(path, mc.makeSSH(path, via, cfg.Command))
+			handler, err := mc.makeSSH(path, cfg)
+			if err != nil {
+				return fmt.Errorf("http.ssh %s: %w", cfg.Path, err)
+			}
+			mux.Handle(path, tracker.Handler(graceful.Terminal, handler))
 			slog.Info("- SSH " + mc.Http.AdvAddr + path)
 		}
 		for _, cfg := range mc.Http.Ports {
@@ -291,7 +372,7 @@ func main() {
 				continue
 			}
 			slog.Info("- Port " + mc.Http.AdvAddr + path + " -> " + cfg.RemoteAddr)
-			mux.HandleFunc(path, wp.HandleHTTP)
+			mux.Handle(path, tracker.Handler(graceful.Raw, mc.audit.Port(cfg.RemoteAddr, wp.HandleHTTP)))
 		}
 
 		mux.Handle("/static/", fileSvrFS)
@@ -299,15 +380,46 @@ func main() {
 			http.ServeFile(w, r, "static/favicon.ico")
 		})
 		mux.Handle("/debug/pprof", pprof.Handler("/debug/pprof"))
+		var handler http.Handler = mux
+		if mc.Http.Auth.Enabled() {
+			a, err := auth.New(mc.Http.Auth, mc.defaultAuthRules())
+			if err != nil {
+				return fmt.Errorf("http.auth: %w", err)
+			}
+			handler = a.Handler(mux)
+			slog.Info("- Login " + mc.Http.AdvAddr + auth.LoginPath)
+		} else if !isLocalOnly(mc.Http.Listen, mc.Http.SocketMode) {
+			slog.Warn("HTTP server has no authentication, configure [http.auth] to expose it beyond localhost", "listen", mc.Http.Listen)
+		}
 		svr := &http.Server{
-			Addr:      mc.Http.Listen,
-			Handler:   httpstat.NewHandler(mc.Collector.C, mux),
-			ConnState: connState,
+			Handler: httpstat.NewHandler(mc.selfStat.Send, handler),
+		}
+		if mc.stream != nil {
+			// the streams end so that the shutdown does not wait for them
+			svr.RegisterOnShutdown(mc.stream.DeInit)
 		}
-		defer svr.Close()
+		if tlsOpts := mc.tlsOptions(); tlsOpts.Enabled() {
+			tlsConfig, err := tlsconf.New(tlsOpts)
+			if err != nil {
+				return fmt.Errorf("http tls: %w", err)
+			}
+			svr.TLSConfig = tlsConfig
+		}
+		ln, err := listenHTTP(mc.Http.Listen, mc.Http.SocketMode)
+		if err != nil {
+			return fmt.Errorf("http listen: %w", err)
+		}
+		defer mc.shutdownHTTP(svr, tracker)
 		go func() {
 			slog.Info("Starting HTTP server " + mc.Http.AdvAddr + " ...")
-			if err := svr.ListenAndServe(); err != nil {
+			var err error
+			if svr.TLSConfig != nil {
+				// the certificate is of svr.TLSConfig.GetCertificate
+				err = svr.ServeTLS(ln, "", "")
+			} else {
+				err = svr.Serve(ln)
+			}
+			if err != nil {
 				if err == http.ErrServerClosed {
 					slog.Info("HTTP server closed")
 				} else {
@@ -320,15 +432,141 @@ func main() {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 	<-signalCh
+	return nil
 }
 
-func connState(conn net.Conn, state http.ConnState) {
-	switch state {
-	case http.StateNew:
-		if c, ok := conn.(*net.TCPConn); ok {
-			c.SetLinger(0)
+// defaultAuthRules returns the roles that the paths require by default,
+// the terminals, the SSH sessions, the port forwardings, the audit
+// and pprof require admin.
+func (mc *Metrical) defaultAuthRules() []auth.Rule {
+	rules := []auth.Rule{
+		{Path: "/static/", Role: auth.RolePublic},
+		{Path: "/favicon.ico", Role: auth.RolePublic},
+		{Path: "/debug/pprof", Role: auth.RoleAdmin},
+		{Path: "/api/v1/ingest", Role: auth.RoleIngest},
+	}
+	for _, cfg := range mc.Http.Terms {
+		rules = append(rules, auth.Rule{Path: cfg.Path, Role: auth.RoleAdmin})
+	}
+	for _, cfg := range mc.Http.SSHs {
+		rules = append(rules, auth.Rule{Path: cfg.Path, Role: auth.RoleAdmin})
+	}
+	for _, cfg := range mc.Http.Ports {
+		rules = append(rules, auth.Rule{Path: cfg.Path, Role: auth.RoleAdmin})
+	}
+	if mc.Http.Audit.Enabled() {
+		path := mc.Http.Audit.Path
+		if path == "" {
+			path = audit.DefaultPath
 		}
+		rules = append(rules, auth.Rule{Path: path, Role: auth.RoleAdmin})
+	}
+	return rules
+}
+
+// tlsOptions returns the TLS options of the HTTP server,
+// the self-signed certificate is for the hosts of listen and adv_addr.
+func (mc *Metrical) tlsOptions() tlsconf.Options {
+	opts := tlsconf.Options{
+		CertFile:   mc.Http.TLSCert,
+		KeyFile:    mc.Http.TLSKey,
+		ClientCA:   mc.Http.ClientCA,
+		MinVersion: mc.Http.TLSMinVersion,
+		SelfSigned: mc.Http.TLSSelfSigned,
+	}
+	if host, _, err := net.SplitHostPort(mc.Http.Listen); err == nil && host != "" {
+		opts.Hosts = append(opts.Hosts, host)
+	}
+	if u, err := url.Parse(mc.Http.AdvAddr); err == nil && u.Hostname() != "" {
+		opts.Hosts = append(opts.Hosts, u.Hostname())
+	}
+	return opts
+}
+
+// isLocalOnly reports whether the listen address is only of the loopback interface,
+// or of the unix socket that only the owner can connect to.
+// The socket of the group or the others, e.g. of a reverse proxy, is not local only.
+func isLocalOnly(listen string, socketMode string) bool {
+	if strings.HasPrefix(listen, "unix:") {
+		mode, err := parseSocketMode(socketMode)
+		return err == nil && mode&0077 == 0
+	}
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// shutdownHTTP stops the server gracefully, it waits for the requests
+// and closes the websockets of the terminals with the notice until
+// shutdown_timeout, then closes the connections left.
+func (mc *Metrical) shutdownHTTP(svr *http.Server, tracker *graceful.Tracker) {
+	timeout := mc.Http.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	slog.Info("Shutting down HTTP server", "timeout", timeout, "websockets", tracker.Len())
+	done := make(chan error, 1)
+	go func() {
+		done <- tracker.Shutdown(ctx, "\r\n\x1b[33mmetrical is shutting down.\x1b[0m\r\n")
+	}()
+	if err := svr.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server shutdown", "error", err)
+		svr.Close()
+	}
+	if err := <-done; err != nil {
+		slog.Warn("Closed the websockets left at the shutdown", "error", err)
+	}
+}
+
+// listenHTTP listens on the TCP address, or on the unix socket of "unix:<path>"
+// with the file mode. The socket file left by the previous run is removed.
+func listenHTTP(listen string, mode string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(listen, "unix:")
+	if !ok {
+		return net.Listen("tcp", listen)
+	}
+	fileMode, err := parseSocketMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, fileMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// parseSocketMode parses the octal file mode of the unix socket, default "0660".
+func parseSocketMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0660, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid socket_mode %q, octal like \"0660\"", mode)
+	}
+	return os.FileMode(m), nil
 }
 
 func (mc Metrical) HasInput(name string) bool {
@@ -392,57 +630,132 @@ func (mc *Metrical) loadCollector(content string) error {
 		}
 		options = append(options, metric.WithTimeseriesFilter(filter))
 	}
+	var extra []registry.Processor
+	var derivedInput *derived.Derived
+	if len(mc.Data.Derived) > 0 {
+		d, err := derived.New(mc.Data.Derived)
+		if err != nil {
+			return err
+		}
+		derivedInput = d
+		extra = append(extra, d)
+	}
 	mc.Collector = metric.NewCollector(options...)
-	if inputs, outputs, err := registry.LoadConfig(mc.Collector, content); err != nil {
+	mc.selfStat = registry.NewSelfStat(mc.Collector.C)
+	mc.tags = registry.NewTags(mc.Data.Tags)
+	if tagged, ok := mc.Storage.(registry.Tagged); ok {
+		tagged.SetTags(mc.tags.Lookup)
+	}
+	loadOptions := registry.LoadOptions{Stat: mc.selfStat, Tags: mc.tags, Processors: extra}
+	if inputs, outputs, err := registry.LoadConfig(mc.Collector, content, loadOptions); err != nil {
 		return err
 	} else {
 		mc.instantiatedInputs = inputs
 		_ = outputs
 	}
-	return nil
+	if mc.Http.Listen != "" && mc.Http.Stream {
+		mc.stream = stream.NewBroker(stream.DefaultBufferSize)
+		mc.stream.SetTags(mc.tags.Lookup)
+		if err := mc.Collector.AddOutput(mc.stream); err != nil {
+			return err
+		}
+	}
+	if derivedInput != nil {
+		// derived metrics are evaluated after all the other inputs
+		if err := mc.Collector.AddInput(derivedInput); err != nil {
+			return err
+		}
+	}
+	// reports the gathering of the inputs above, so it is the last input
+	return mc.Collector.AddInput(mc.selfStat)
 }
 
-func (mc *Metrical) makeDashboard() *metric.Dashboard {
+// dashboardChart is a chart of the dashboard,
+// it is shown if the input is instantiated or the input is empty.
+type dashboardChart struct {
+	Input string
+	metric.Chart
+}
+
+var dashboardCharts = []dashboardChart{
+	{"load", metric.Chart{Title: "Load Average", MetricNames: []string{"load:load1", "load:load5", "load:load15"}, FieldNames: []string{"avg"}, Type: metric.ChartTypeLine}},
+	{"cpu", metric.Chart{Title: "CPU Usage", MetricNames: []string{"cpu:cpu_*"}, FieldNames: []string{"ohlc", "avg"}}},
+	{"mem", metric.Chart{Title: "MEM Usage", MetricNames: []string{"mem:percent"}, FieldNames: []string{"max"}}},
+	{"disk", metric.Chart{Title: "Disk Usage", MetricNames: []string{"disk:*:used_percent"}, FieldNames: []string{"last"}, Type: metric.ChartTypeLine}},
+	{"go_runtime", metric.Chart{Title: "Go Routines", MetricNames: []string{"go:runtime:goroutines"}, FieldNames: []string{"max", "min"}}},
+	{"", metric.Chart{Title: "Go Heap In Use", MetricNames: []string{"go:mem:heap_inuse"}, FieldNames: []string{"max", "min"}}},
+	{"net", metric.Chart{Title: "Network I/O", MetricNames: []string{"net:*:bytes_recv", "net:*:bytes_sent"}, FieldNames: []string{"abs_diff"}, Type: metric.ChartTypeLine}},
+	{"net", metric.Chart{Title: "Network Packets", MetricNames: []string{"net:*:packets_recv", "net:*:packets_sent"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine}},
+	{"net", metric.Chart{Title: "Network Errors", MetricNames: []string{"net:*:drop_in", "net:*:drop_out", "net:*:err_in", "net:*:err_out"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeScatter, ShowSymbol: true}},
+	{"netstat", metric.Chart{Title: "Netstat", MetricNames: []string{"netstat:tcp_*", "netstat:udp_*"}, FieldNames: []string{"last"}}},
+	{"diskio", metric.Chart{Title: "Disk I/O Bytes", MetricNames: []string{"diskio:*:read_bytes", "diskio:*:write_bytes"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine}},
+	{"diskio", metric.Chart{Title: "Disk I/O Count", MetricNames: []string{"diskio:*:read_count", "diskio:*:write_count"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine}},
+	{"diskio", metric.Chart{Title: "Disk I/O Time", MetricNames: []string{"diskio:*:read_time", "diskio:*:write_time", "diskio:*:io_time", "diskio:*:weighted_io_time"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine}},
+	{"", metric.Chart{Title: "HTTP Latency", MetricNames: []string{"http:latency"}, FieldNames: []string{"p50", "p90", "p99"}}},
+	{"", metric.Chart{Title: "HTTP I/O", MetricNames: []string{"http:bytes_recv", "http:bytes_sent"}, Type: metric.ChartTypeLine, ShowSymbol: false}},
+	{"", metric.Chart{Title: "HTTP Status", MetricNames: []string{"http:status_[1-5]xx"}, Type: metric.ChartTypeBarStack}},
+	{"", metric.Chart{Title: "Gather Latency", MetricNames: []string{"metrical:input:*:gather_latency", "metrical:output:*:process_latency"}, FieldNames: []string{"p50", "p99"}}},
+	{"", metric.Chart{Title: "Collector Errors", MetricNames: []string{"metrical:input:*:gather_errors", "metrical:output:*:process_errors", "metrical:input_buffer:full"}, Type: metric.ChartTypeBarStack}},
+}
+
+func (mc *Metrical) newDashboard(title string) *metric.Dashboard {
 	dash := metric.NewDashboard(mc.Collector)
-	dash.PageTitle = "Metrical - Demo"
+	dash.PageTitle = title
 	dash.ShowRemains = false
 	dash.Option.JsSrc = []string{"/static/js/echarts.min.js"}
+	if mc.Http.Ingest {
+		// the host selector
+		dash.Option.JsSrc = append(dash.Option.JsSrc, "/static/js/hosts.js")
+	}
 	dash.SetTheme("light")
 	dash.SetPanelHeight("280px")   // default
 	dash.SetPanelMinWidth("400px") // default
 	dash.SetPanelMaxWidth("1fr")   // default
-	if mc.HasInput("load") {
-		dash.AddChart(metric.Chart{Title: "Load Average", MetricNames: []string{"load:load1", "load:load5", "load:load15"}, FieldNames: []string{"avg"}, Type: metric.ChartTypeLine})
-	}
-	if mc.HasInput("cpu") {
-		dash.AddChart(metric.Chart{Title: "CPU Usage", MetricNames: []string{"cpu:cpu_*"}, FieldNames: []string{"ohlc", "avg"}})
-	}
-	if mc.HasInput("mem") {
-		dash.AddChart(metric.Chart{Title: "MEM Usage", MetricNames: []string{"mem:percent"}, FieldNames: []string{"max"}})
-	}
-	if mc.HasInput("disk") {
-		dash.AddChart(metric.Chart{Title: "Disk Usage", MetricNames: []string{"disk:*:used_percent"}, FieldNames: []string{"last"}, Type: metric.ChartTypeLine})
-	}
-	if mc.HasInput("go_runtime") {
-		dash.AddChart(metric.Chart{Title: "Go Routines", MetricNames: []string{"go:runtime:goroutines"}, FieldNames: []string{"max", "min"}})
-	}
-	dash.AddChart(metric.Chart{Title: "Go Heap In Use", MetricNames: []string{"go:mem:heap_inuse"}, FieldNames: []string{"max", "min"}})
-	if mc.HasInput("net") {
-		dash.AddChart(metric.Chart{Title: "Network I/O", MetricNames: []string{"net:*:bytes_recv", "net:*:bytes_sent"}, FieldNames: []string{"abs_diff"}, Type: metric.ChartTypeLine})
-		dash.AddChart(metric.Chart{Title: "Network Packets", MetricNames: []string{"net:*:packets_recv", "net:*:packets_sent"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine})
-		dash.AddChart(metric.Chart{Title: "Network Errors", MetricNames: []string{"net:*:drop_in", "net:*:drop_out", "net:*:err_in", "net:*:err_out"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeScatter, ShowSymbol: true})
-	}
-	if mc.HasInput("netstat") {
-		dash.AddChart(metric.Chart{Title: "Netstat", MetricNames: []string{"netstat:tcp_*", "netstat:udp_*"}, FieldNames: []string{"last"}})
+	return dash
+}
+
+func (mc *Metrical) makeDashboard() *metric.Dashboard {
+	dash := mc.newDashboard("Metrical - Demo")
+	for _, c := range dashboardCharts {
+		if c.Input == "" || mc.HasInput(c.Input) {
+			dash.AddChart(c.Chart)
+		}
 	}
-	if mc.HasInput("diskio") {
-		dash.AddChart(metric.Chart{Title: "Disk I/O Bytes", MetricNames: []string{"diskio:*:read_bytes", "diskio:*:write_bytes"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine})
-		dash.AddChart(metric.Chart{Title: "Disk I/O Count", MetricNames: []string{"diskio:*:read_count", "diskio:*:write_count"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine})
-		dash.AddChart(metric.Chart{Title: "Disk I/O Time", MetricNames: []string{"diskio:*:read_time", "diskio:*:write_time", "diskio:*:io_time", "diskio:*:weighted_io_time"}, FieldNames: []string{"non_negative_diff"}, Type: metric.ChartTypeLine})
+	return dash
+}
+
+// makeHostDashboards serves the dashboards of the ingested hosts
+// at cutPrefix + "<host>/".
+func (mc *Metrical) makeHostDashboards(cutPrefix string, ih *ingest.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, cutPrefix), "/")
+		if !slices.ContainsFunc(ih.Hosts(), func(h ingest.Host) bool { return h.Name == host }) {
+			http.NotFound(w, r)
+			return
+		}
+		mc.makeHostDashboard(host).ServeHTTP(w, r)
+	})
+}
+
+// makeHostDashboard returns the dashboard of the charts
+// that have the metrics of the host.
+func (mc *Metrical) makeHostDashboard(host string) *metric.Dashboard {
+	dash := mc.newDashboard("Metrical - " + host)
+	names := mc.Collector.MetricNames()
+	for i, c := range dashboardCharts {
+		chart := c.Chart
+		// the ID is the same whichever charts the host has
+		chart.ID = fmt.Sprintf("@%d", i+1)
+		chart.MetricNames = make([]string, len(c.MetricNames))
+		for j, name := range c.MetricNames {
+			chart.MetricNames[j] = ingest.MetricName(host, name)
+		}
+		filter, err := metric.Compile(chart.MetricNames, ':')
+		if err != nil || !slices.ContainsFunc(names, filter.Match) {
+			continue
+		}
+		dash.AddChart(chart)
 	}
-	dash.AddChart(metric.Chart{Title: "HTTP Latency", MetricNames: []string{"http:latency"}, FieldNames: []string{"p50", "p90", "p99"}})
-	dash.AddChart(metric.Chart{Title: "HTTP I/O", MetricNames: []string{"http:bytes_recv", "http:bytes_sent"}, Type: metric.ChartTypeLine, ShowSymbol: false})
-	dash.AddChart(metric.Chart{Title: "HTTP Status", MetricNames: []string{"http:status_[1-5]xx"}, Type: metric.ChartTypeBarStack})
 	return dash
 }
 
@@ -473,7 +786,7 @@ func (mc *Metrical) makeTail(cutPrefix string, files []WebTailFile) http.Handler
 }
 
 func (mc *Metrical) makeTerminal(cutPrefix string, cmd string, args []string, dir string) http.Handler {
-	term := webterm.New(
+	term := mc.audit.Terminal("term", cutPrefix, strings.Join(append([]string{cmd}, args...), " "),
 		&webexec.WebExec{
 			Command: cmd,
 			Args:    args,
@@ -486,35 +799,60 @@ func (mc *Metrical) makeTerminal(cutPrefix string, cmd string, args []string, di
 	return term
 }
 
-func (mc *Metrical) makeSSH(cutPrefix string, vai []WebSSHVia, cmd string) http.Handler {
-	hops := webssh.Hops{}
-	for _, v := range vai {
-		auth := []ssh.AuthMethod{}
-		if v.Password != "" {
-			auth = append(auth, webssh.AuthPassword(v.Password))
-		}
-		if v.Keyfile != "" {
-			key, _ := os.ReadFile(v.Keyfile)
-			auth = append(auth, webssh.AuthPrivateKey(key))
-		}
-		hop := webssh.Hop{
-			Host: v.Host,
-			Port: v.Port,
-			User: v.User,
-			Auth: auth,
-		}
-		hops = append(hops, hop)
+// sshHops returns the jump hosts and the target of the config.
+func sshHops(cfg WebSSHConfig) []sshterm.Hop {
+	hops := []sshterm.Hop{}
+	for _, v := range cfg.Via {
+		hops = append(hops, sshterm.Hop{
+			Host:              v.Host,
+			Port:              v.Port,
+			User:              v.User,
+			Password:          v.Password,
+			Keyfile:           v.Keyfile,
+			KeyfilePassphrase: v.KeyfilePassphrase,
+			HostKey:           v.HostKey,
+		})
 	}
+	return append(hops, sshterm.Hop{
+		Host:              cfg.Host,
+		Port:              cfg.Port,
+		User:              cfg.User,
+		Password:          cfg.Password,
+		Keyfile:           cfg.Keyfile,
+		KeyfilePassphrase: cfg.KeyfilePassphrase,
+		HostKey:           cfg.HostKey,
+	})
+}
 
-	term := webterm.New(
-		&webssh.WebSSH{
-			Hops:     hops,
-			TermType: "xterm-256color",
-			Command:  cmd,
-		},
+// newSSH returns the runner of the SSH sessions of the config,
+// it fails if the key files, the host keys or the agent are invalid.
+func newSSH(cfg WebSSHConfig) (*sshterm.SSH, error) {
+	return sshterm.New(sshHops(cfg), sshterm.Options{
+		KnownHosts:   cfg.KnownHosts,
+		HostKeyCheck: cfg.HostKeyCheck,
+		Agent:        cfg.Agent,
+		ForwardAgent: cfg.ForwardAgent,
+		TermType:     "xterm-256color",
+		Command:      cfg.Command,
+	})
+}
+
+func (mc *Metrical) makeSSH(cutPrefix string, cfg WebSSHConfig) (http.Handler, error) {
+	runner, err := newSSH(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if runner.Insecure() {
+		slog.Warn("SSH host keys are not verified, set known_hosts or host_key", "path", cfg.Path)
+	}
+	command := cfg.User + "@" + sshterm.Hop{Host: cfg.Host, Port: cfg.Port}.Addr()
+	if cfg.Command != "" {
+		command += " " + cfg.Command
+	}
+	term := mc.audit.Terminal("ssh", cutPrefix, command, runner,
 		webterm.WithCutPrefix(cutPrefix),
 		webterm.WithFontSize(11),
 		webterm.WithTheme(webterm.ThemeMolokai),
 	)
-	return term
+	return term, nil
 }
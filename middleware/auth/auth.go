@@ -0,0 +1,372 @@
+// Package auth authenticates the requests of the HTTP server
+// and authorizes them by the role that each path requires.
+//
+// A request is authenticated by, in order,
+//
+//   - the session cookie issued by the login page
+//   - the "Authorization: Bearer <token>" header of the static tokens
+//   - the "Authorization: Basic" header of the users with bcrypt hashes
+//   - the header set by a trusted reverse proxy, e.g. X-Forwarded-User
+//
+// The roles are "viewer", "ingest" and "admin". A path that requires
+// "viewer" is allowed to any authenticated request, the other roles
+// are allowed to the role itself and to "admin". The path of the
+// role "public" is allowed without the authentication.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RolePublic = "public"
+	RoleViewer = "viewer"
+	RoleIngest = "ingest"
+	RoleAdmin  = "admin"
+)
+
+var roles = []string{RoleViewer, RoleIngest, RoleAdmin}
+
+// Config is the [http.auth] section.
+// The authentication is disabled if there is neither user, token nor proxy_header.
+type Config struct {
+	Users         []User        `toml:"user"`
+	Tokens        []Token       `toml:"token"`
+	ProxyHeader   string        `toml:"proxy_header"`
+	ProxyTrusted  []string      `toml:"proxy_trusted"` // the CIDRs, the IPs or "unix" for the unix socket
+	ProxyRole     string        `toml:"proxy_role"`
+	SessionSecret string        `toml:"session_secret"`
+	SessionTTL    time.Duration `toml:"session_ttl"`
+	Rules         []Rule        `toml:"rule"`
+}
+
+// User is a user of the login page and the basic auth,
+// the user without the password is only for the proxy header auth.
+type User struct {
+	Name         string `toml:"name"`
+	PasswordHash string `toml:"password_hash"`
+	Role         string `toml:"role"`
+}
+
+// Token is a static bearer token.
+type Token struct {
+	Name  string `toml:"name"`
+	Token string `toml:"token"`
+	Role  string `toml:"role"`
+}
+
+// Rule is the role that the paths under the path require.
+type Rule struct {
+	Path string `toml:"path"`
+	Role string `toml:"role"`
+}
+
+// Enabled reports whether the authentication is configured.
+func (c Config) Enabled() bool {
+	return len(c.Users) > 0 || len(c.Tokens) > 0 || c.ProxyHeader != ""
+}
+
+// Identity is the authenticated user of the request.
+type Identity struct {
+	Name   string
+	Role   string
+	Method string // "session", "token", "basic" or "proxy"
+}
+
+type contextKey struct{}
+
+// FromContext returns the identity of the authenticated request.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// Auth is the middleware of the authentication.
+type Auth struct {
+	users   map[string]User
+	tokens  []Token
+	proxy   string
+	trusted []*net.IPNet
+	unix    bool // trusts the connections of the unix socket
+	proxyAs string
+	secret  []byte
+	ttl     time.Duration
+	rules   []Rule
+
+	mu       sync.Mutex
+	verified map[string][32]byte // the users and the hashes of the verified passwords
+}
+
+// New returns the Auth of the config, the rules of the config
+// take precedence over the defaults, e.g. the admin role of the terminals.
+func New(cfg Config, defaults []Rule) (*Auth, error) {
+	a := &Auth{
+		users:    map[string]User{},
+		proxy:    cfg.ProxyHeader,
+		proxyAs:  cfg.ProxyRole,
+		ttl:      cfg.SessionTTL,
+		verified: map[string][32]byte{},
+	}
+	var errs []error
+	for i, u := range cfg.Users {
+		if u.Name == "" {
+			errs = append(errs, fmt.Errorf("user[%d]: name is required", i))
+			continue
+		}
+		if _, dup := a.users[u.Name]; dup {
+			errs = append(errs, fmt.Errorf("user %q: duplicate name", u.Name))
+		}
+		if u.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+				errs = append(errs, fmt.Errorf("user %q: password_hash should be a bcrypt hash, see \"metrical passwd\": %w", u.Name, err))
+			}
+		}
+		if !slices.Contains(roles, u.Role) {
+			errs = append(errs, fmt.Errorf("user %q: role %q should be one of %v", u.Name, u.Role, roles))
+		}
+		a.users[u.Name] = u
+	}
+	for i, t := range cfg.Tokens {
+		if len(t.Token) < 16 {
+			errs = append(errs, fmt.Errorf("token[%d] %q: token should be at least 16 characters", i, t.Name))
+		}
+		if !slices.Contains(roles, t.Role) {
+			errs = append(errs, fmt.Errorf("token[%d] %q: role %q should be one of %v", i, t.Name, t.Role, roles))
+		}
+		a.tokens = append(a.tokens, t)
+	}
+	if a.proxyAs == "" {
+		a.proxyAs = RoleViewer
+	} else if !slices.Contains(roles, a.proxyAs) {
+		errs = append(errs, fmt.Errorf("proxy_role %q should be one of %v", a.proxyAs, roles))
+	}
+	trusted := cfg.ProxyTrusted
+	if len(trusted) == 0 {
+		trusted = []string{"127.0.0.1/32", "::1/128"}
+	}
+	for _, cidr := range trusted {
+		if cidr == "unix" {
+			a.unix = true
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy_trusted: %w", err))
+			continue
+		}
+		a.trusted = append(a.trusted, ipNet)
+	}
+	for _, r := range cfg.Rules {
+		if !strings.HasPrefix(r.Path, "/") {
+			errs = append(errs, fmt.Errorf("rule %q: path should start with /", r.Path))
+		}
+		if r.Role != RolePublic && !slices.Contains(roles, r.Role) {
+			errs = append(errs, fmt.Errorf("rule %q: role %q should be %q or one of %v", r.Path, r.Role, RolePublic, roles))
+		}
+	}
+	if cfg.SessionTTL < 0 {
+		errs = append(errs, errors.New("session_ttl should not be negative"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if a.ttl == 0 {
+		a.ttl = 12 * time.Hour
+	}
+	if cfg.SessionSecret != "" {
+		a.secret = []byte(cfg.SessionSecret)
+	} else {
+		// the sessions are invalidated by the restart
+		a.secret = make([]byte, 32)
+		rand.Read(a.secret)
+	}
+	// the rules of the config first, the first longest match wins
+	a.rules = append(slices.Clone(cfg.Rules), defaults...)
+	return a, nil
+}
+
+// Required returns the role that the path requires, "viewer" by default.
+func (a *Auth) Required(path string) string {
+	role, length := RoleViewer, -1
+	for _, r := range a.rules {
+		if matchPath(r.Path, path) && len(r.Path) > length {
+			role, length = r.Role, len(r.Path)
+		}
+	}
+	return role
+}
+
+// matchPath reports whether the path is the prefix or under it.
+func matchPath(prefix, path string) bool {
+	if path == prefix || strings.TrimSuffix(prefix, "/") == path {
+		return true
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return strings.HasPrefix(path, prefix)
+}
+
+// Allowed reports whether the role is allowed to the path that requires the required role.
+func Allowed(role, required string) bool {
+	switch required {
+	case RolePublic:
+		return true
+	case RoleViewer:
+		return role != ""
+	default:
+		return role == required || role == RoleAdmin
+	}
+}
+
+// Handler returns the handler that serves the login page at /login,
+// /logout, and the next of the authorized requests.
+func (a *Auth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case LoginPath:
+			a.serveLogin(w, r)
+			return
+		case LogoutPath:
+			a.serveLogout(w, r)
+			return
+		}
+		required := a.Required(r.URL.Path)
+		id, ok := a.authenticate(r)
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, id))
+		}
+		if Allowed(id.Role, required) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok {
+			http.Error(w, fmt.Sprintf("forbidden, %q requires the role %q", r.URL.Path, required), http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, LoginPath+"?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		if len(a.users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrical", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrical"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func (a *Auth) authenticate(r *http.Request) (Identity, bool) {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		if id, ok := a.verifySession(c.Value); ok {
+			return id, true
+		}
+	}
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		if token, ok := strings.CutPrefix(authz, "Bearer "); ok {
+			return a.verifyToken(strings.TrimSpace(token))
+		}
+		if name, password, ok := r.BasicAuth(); ok {
+			return a.verifyPassword(name, password, "basic")
+		}
+		return Identity{}, false
+	}
+	if a.proxy != "" {
+		if name := r.Header.Get(a.proxy); name != "" && a.trustedProxy(r) {
+			role := a.proxyAs
+			if u, ok := a.users[name]; ok {
+				role = u.Role
+			}
+			return Identity{Name: name, Role: role, Method: "proxy"}, true
+		}
+	}
+	return Identity{}, false
+}
+
+func (a *Auth) verifyToken(token string) (Identity, bool) {
+	sum := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		expect := sha256.Sum256([]byte(t.Token))
+		if subtle.ConstantTimeCompare(sum[:], expect[:]) == 1 {
+			return Identity{Name: t.Name, Role: t.Role, Method: "token"}, true
+		}
+	}
+	return Identity{}, false
+}
+
+// verifyPassword verifies the password with the bcrypt hash,
+// the password once verified is compared with its sha256 hash
+// to keep the basic auth of every request of the dashboards cheap.
+func (a *Auth) verifyPassword(name, password, method string) (Identity, bool) {
+	u, ok := a.users[name]
+	if !ok || u.PasswordHash == "" {
+		return Identity{}, false
+	}
+	sum := sha256.Sum256([]byte(password))
+	a.mu.Lock()
+	cached, hit := a.verified[name]
+	a.mu.Unlock()
+	if !hit || subtle.ConstantTimeCompare(sum[:], cached[:]) != 1 {
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+			return Identity{}, false
+		}
+		a.mu.Lock()
+		a.verified[name] = sum
+		a.mu.Unlock()
+	}
+	return Identity{Name: u.Name, Role: u.Role, Method: method}, true
+}
+
+// trustedProxy reports whether the request is from the trusted proxy,
+// the remote address of the unix socket is not an IP,
+// so the connections of the unix socket are trusted by "unix".
+func (a *Auth) trustedProxy(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return a.unix
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HashPassword returns the bcrypt hash of the password for password_hash.
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestAuth(t *testing.T) *Auth {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	a, err := New(Config{
+		Users: []User{
+			{Name: "alice", PasswordHash: string(hash), Role: RoleAdmin},
+			{Name: "bob", PasswordHash: string(hash), Role: RoleViewer},
+			{Name: "carol", Role: RoleAdmin},
+		},
+		Tokens:      []Token{{Name: "edge", Token: "0123456789abcdef", Role: RoleIngest}},
+		ProxyHeader: "X-Forwarded-User",
+		Rules:       []Rule{{Path: "/public", Role: RolePublic}},
+	}, []Rule{
+		{Path: "/term/home", Role: RoleAdmin},
+		{Path: "/api/v1/ingest", Role: RoleIngest},
+		{Path: "/public", Role: RoleAdmin},
+	})
+	require.NoError(t, err)
+	return a
+}
+
+func serve(a *Auth, r *http.Request) *httptest.ResponseRecorder {
+	rsp := httptest.NewRecorder()
+	a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		w.Write([]byte(id.Name + " " + id.Role + " " + id.Method))
+	})).ServeHTTP(rsp, r)
+	return rsp
+}
+
+func TestAuth(t *testing.T) {
+	a := newTestAuth(t)
+
+	require.Equal(t, RoleAdmin, a.Required("/term/home/"))
+	require.Equal(t, RoleAdmin, a.Required("/term/home"))
+	require.Equal(t, RoleViewer, a.Required("/term/homes"))
+	require.Equal(t, RolePublic, a.Required("/public/x"), "the rules of the config first")
+	require.Equal(t, RoleViewer, a.Required("/dashboard/"))
+
+	tests := []struct {
+		name   string
+		path   string
+		setup  func(r *http.Request)
+		status int
+		body   string
+	}{
+		{name: "public", path: "/public/", status: 200, body: "  "},
+		{name: "no auth", path: "/dashboard/", status: 401},
+		{name: "basic viewer", path: "/dashboard/", setup: func(r *http.Request) { r.SetBasicAuth("bob", "secret") }, status: 200, body: "bob viewer basic"},
+		{name: "basic wrong", path: "/dashboard/", setup: func(r *http.Request) { r.SetBasicAuth("bob", "wrong") }, status: 401},
+		{name: "basic no password", path: "/dashboard/", setup: func(r *http.Request) { r.SetBasicAuth("carol", "") }, status: 401},
+		{name: "viewer term", path: "/term/home/", setup: func(r *http.Request) { r.SetBasicAuth("bob", "secret") }, status: 403},
+		{name: "admin term", path: "/term/home/", setup: func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, status: 200, body: "alice admin basic"},
+		{name: "token ingest", path: "/api/v1/ingest", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer 0123456789abcdef") }, status: 200, body: "edge ingest token"},
+		{name: "token term", path: "/term/home/", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer 0123456789abcdef") }, status: 403},
+		{name: "token wrong", path: "/dashboard/", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, status: 401},
+		{name: "proxy", path: "/term/home/", setup: func(r *http.Request) { r.Header.Set("X-Forwarded-User", "carol") }, status: 200, body: "carol admin proxy"},
+		{name: "proxy unknown user", path: "/dashboard/", setup: func(r *http.Request) { r.Header.Set("X-Forwarded-User", "dave") }, status: 200, body: "dave viewer proxy"},
+		{name: "proxy untrusted", path: "/dashboard/", setup: func(r *http.Request) {
+			r.Header.Set("X-Forwarded-User", "carol")
+			r.RemoteAddr = "10.0.0.1:1234"
+		}, status: 401},
+		{name: "proxy unix untrusted", path: "/dashboard/", setup: func(r *http.Request) {
+			r.Header.Set("X-Forwarded-User", "carol")
+			*r = *r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/metrical.sock", Net: "unix"}))
+			r.RemoteAddr = "@"
+		}, status: 401},
+		{name: "browser", path: "/dashboard/?tsIdx=1", setup: func(r *http.Request) { r.Header.Set("Accept", "text/html") }, status: 303},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.RemoteAddr = "127.0.0.1:1234"
+		if tt.setup != nil {
+			tt.setup(r)
+		}
+		rsp := serve(a, r)
+		require.Equal(t, tt.status, rsp.Code, tt.name)
+		if tt.body != "" {
+			require.Equal(t, tt.body, rsp.Body.String(), tt.name)
+		}
+		if tt.status == 303 {
+			require.Equal(t, "/login?next="+url.QueryEscape(tt.path), rsp.Header().Get("Location"))
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	a := newTestAuth(t)
+
+	rsp := serve(a, httptest.NewRequest(http.MethodGet, "/login?next=/dashboard/", nil))
+	require.Equal(t, http.StatusOK, rsp.Code)
+	require.Contains(t, rsp.Body.String(), `name="next" value="/dashboard/"`)
+
+	login := func(user, password, next string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {user}, "password": {password}, "next": {next}}
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(a, r)
+	}
+	rsp = login("bob", "wrong", "/dashboard/")
+	require.Equal(t, http.StatusUnauthorized, rsp.Code)
+	require.Contains(t, rsp.Body.String(), "Invalid username or password")
+
+	rsp = login("bob", "secret", "//evil.example/")
+	require.Equal(t, http.StatusSeeOther, rsp.Code)
+	require.Equal(t, "/", rsp.Header().Get("Location"))
+
+	rsp = login("bob", "secret", "/dashboard/")
+	require.Equal(t, http.StatusSeeOther, rsp.Code)
+	require.Equal(t, "/dashboard/", rsp.Header().Get("Location"))
+	cookies := rsp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, SessionCookie, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+
+	r := httptest.NewRequest(http.MethodGet, "/dashboard/", nil)
+	r.AddCookie(cookies[0])
+	rsp = serve(a, r)
+	require.Equal(t, http.StatusOK, rsp.Code)
+	require.Equal(t, "bob viewer session", rsp.Body.String())
+
+	// tampered session
+	r = httptest.NewRequest(http.MethodGet, "/dashboard/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: a.newSession("alice", cookies[0].Expires)[:10] + cookies[0].Value[10:]})
+	require.Equal(t, http.StatusUnauthorized, serve(a, r).Code)
+
+	// expired session
+	r = httptest.NewRequest(http.MethodGet, "/dashboard/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: a.newSession("bob", cookies[0].Expires.Add(-2*a.ttl))})
+	require.Equal(t, http.StatusUnauthorized, serve(a, r).Code)
+
+	rsp = serve(a, httptest.NewRequest(http.MethodGet, "/logout", nil))
+	require.Equal(t, http.StatusSeeOther, rsp.Code)
+	require.Equal(t, -1, rsp.Result().Cookies()[0].MaxAge)
+}
+
+func TestConfigErrors(t *testing.T) {
+	_, err := New(Config{
+		Users:        []User{{Name: "a", PasswordHash: "plain", Role: "root"}},
+		Tokens:       []Token{{Name: "t", Token: "short", Role: RoleViewer}},
+		ProxyTrusted: []string{"not-an-ip"},
+		Rules:        []Rule{{Path: "term", Role: RoleAdmin}},
+	}, nil)
+	require.Error(t, err)
+	for _, msg := range []string{"bcrypt", `role "root"`, "at least 16", "proxy_trusted", "should start with /"} {
+		require.Contains(t, err.Error(), msg)
+	}
+	require.False(t, Config{}.Enabled())
+}
+
+func TestProxyUnix(t *testing.T) {
+	get := func(trusted []string) string {
+		a, err := New(Config{ProxyHeader: "X-Forwarded-User", ProxyTrusted: trusted}, nil)
+		require.NoError(t, err)
+		sock := filepath.Join(t.TempDir(), "metrical.sock")
+		ln, err := net.Listen("unix", sock)
+		require.NoError(t, err)
+		svr := &http.Server{Handler: a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := FromContext(r.Context())
+			w.Write([]byte(id.Name + " " + id.Method))
+		}))}
+		go svr.Serve(ln)
+		defer svr.Close()
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+			},
+		}}
+		req, err := http.NewRequest(http.MethodGet, "http://metrical/dashboard/", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-User", "carol")
+		rsp, err := client.Do(req)
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+		b, err := io.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		return rsp.Status + " " + string(b)
+	}
+	require.Equal(t, "200 OK carol proxy", get([]string{"unix"}))
+	require.Contains(t, get(nil), "401")
+}
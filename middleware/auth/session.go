@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LoginPath     = "/login"
+	LogoutPath    = "/logout"
+	SessionCookie = "metrical_session"
+)
+
+//go:embed "login.html"
+var loginHTML string
+
+var loginTmpl = template.Must(template.New("login").Parse(loginHTML))
+
+// newSession returns the cookie value of the session of the user,
+// "<base64 of name and expiry>.<base64 of hmac>".
+func (a *Auth) newSession(name string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(name + "\n" + strconv.FormatInt(expires.Unix(), 10)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.sign(payload))
+}
+
+// verifySession returns the identity of the session,
+// the role is of the current config of the user.
+func (a *Auth) verifySession(value string) (Identity, bool) {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return Identity{}, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, a.sign(payload)) {
+		return Identity{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Identity{}, false
+	}
+	name, exp, ok := strings.Cut(string(b), "\n")
+	if !ok {
+		return Identity{}, false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return Identity{}, false
+	}
+	u, ok := a.users[name]
+	if !ok {
+		return Identity{}, false
+	}
+	return Identity{Name: u.Name, Role: u.Role, Method: "session"}, true
+}
+
+func (a *Auth) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// safeNext returns the path to redirect after the login,
+// only the paths of this server are allowed.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (a *Auth) serveLogin(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Next  string
+		Error string
+	}{Next: safeNext(r.FormValue("next"))}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, ok := a.verifyPassword(r.PostFormValue("username"), r.PostFormValue("password"), "session")
+		if ok {
+			expires := time.Now().Add(a.ttl)
+			http.SetCookie(w, &http.Cookie{
+				Name:     SessionCookie,
+				Value:    a.newSession(id.Name, expires),
+				Path:     "/",
+				Expires:  expires,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, data.Next, http.StatusSeeOther)
+			return
+		}
+		data.Error = "Invalid username or password"
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	loginTmpl.Execute(w, data)
+}
+
+func (a *Auth) serveLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+}
@@ -0,0 +1,189 @@
+// Package graceful closes the hijacked connections of the websockets
+// at the shutdown of the HTTP server, which http.Server.Shutdown
+// neither notifies nor waits for.
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Kind is how the connection is closed at the shutdown.
+type Kind int
+
+const (
+	// Terminal is the websocket of the web terminals, the notice is written
+	// to the terminal and the websocket is closed right away.
+	Terminal Kind = iota
+	// Raw is the connection that carries the raw bytes after the upgrade,
+	// e.g. the port forwarding, it is closed at the end of the grace period.
+	Raw
+)
+
+// Tracker tracks the hijacked connections.
+type Tracker struct {
+	mu       sync.Mutex
+	conns    map[*conn]struct{}
+	notice   string
+	shutdown bool
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{conns: map[*conn]struct{}{}}
+}
+
+// Handler tracks the connections that next hijacks until it returns.
+func (t *Tracker) Handler(kind Kind, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &responseWriter{ResponseWriter: w, t: t, kind: kind}
+		defer tw.done()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// Len returns the number of the tracked connections.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// Shutdown writes the notice to the terminals and closes their websockets,
+// then waits for the connections until ctx is done and closes the rest.
+// The connections hijacked afterwards are closed in the same way.
+func (t *Tracker) Shutdown(ctx context.Context, notice string) error {
+	t.mu.Lock()
+	t.shutdown = true
+	t.notice = notice
+	for c := range t.conns {
+		c.notify(notice)
+	}
+	t.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if t.Len() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			t.mu.Lock()
+			for c := range t.conns {
+				c.Conn.Close()
+			}
+			t.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	t    *Tracker
+	kind Kind
+	conn *conn
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter does not support hijacking")
+	}
+	nc, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &conn{Conn: nc, kind: w.kind}
+	w.conn = c
+	w.t.mu.Lock()
+	w.t.conns[c] = struct{}{}
+	if w.t.shutdown {
+		c.notify(w.t.notice)
+	}
+	w.t.mu.Unlock()
+	return c, rw, nil
+}
+
+func (w *responseWriter) done() {
+	if w.conn == nil {
+		return
+	}
+	w.t.mu.Lock()
+	delete(w.t.conns, w.conn)
+	w.t.mu.Unlock()
+}
+
+// errClosing is of the writes after the close frame.
+var errClosing = errors.New("websocket is closing for the shutdown")
+
+// conn serializes the writes, so that the frames of the shutdown
+// are not interleaved with the frames of the handler.
+type conn struct {
+	net.Conn
+	kind Kind
+
+	mu      sync.Mutex
+	closing bool
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return 0, errClosing
+	}
+	return c.Conn.Write(p)
+}
+
+// notify writes the notice as a text frame and the close frame
+// "going away" to the websocket of the terminal.
+func (c *conn) notify(notice string) {
+	if c.kind != Terminal {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return
+	}
+	c.closing = true
+	c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if notice != "" {
+		c.Conn.Write(frame(0x1, []byte(notice)))
+	}
+	c.Conn.Write(frame(0x8, binary.BigEndian.AppendUint16(nil, 1001)))
+}
+
+// frame returns the unmasked websocket frame of the server.
+func frame(opcode byte, payload []byte) []byte {
+	b := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, byte(n))
+	case n <= 0xFFFF:
+		b = append(b, 126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	return append(b, payload...)
+}
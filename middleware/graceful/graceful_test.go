@@ -0,0 +1,106 @@
+package graceful
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// hijack serves the handler that hijacks the connection,
+// the handler reads until the connection is closed.
+func hijack(t *testing.T, tracker *Tracker, kind Kind) (net.Conn, <-chan net.Conn) {
+	t.Helper()
+	conns := make(chan net.Conn, 1)
+	svr := httptest.NewServer(tracker.Handler(kind, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+		defer c.Close()
+		conns <- c
+		io.Copy(io.Discard, c)
+	})))
+	t.Cleanup(svr.Close)
+	client, err := net.Dial("tcp", svr.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	_, err = client.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return tracker.Len() == 1 }, time.Second, 10*time.Millisecond)
+	return client, conns
+}
+
+func TestTerminal(t *testing.T) {
+	tracker := NewTracker()
+	client, conns := hijack(t, tracker, Terminal)
+	server := <-conns
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		done <- tracker.Shutdown(ctx, "bye")
+	}()
+
+	// the notice and the close frame "going away"
+	want := append(frame(0x1, []byte("bye")), 0x88, 2, 0x03, 0xe9)
+	got := make([]byte, len(want))
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := io.ReadFull(client, got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// the handler can not write after the close frame
+	_, err = server.Write([]byte("data"))
+	require.ErrorIs(t, err, errClosing)
+
+	// the shutdown returns when the client closes
+	client.Close()
+	require.NoError(t, <-done)
+	require.Equal(t, 0, tracker.Len())
+}
+
+func TestRaw(t *testing.T) {
+	tracker := NewTracker()
+	client, conns := hijack(t, tracker, Raw)
+	server := <-conns
+	_, err := server.Write([]byte("raw"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, tracker.Shutdown(ctx, "bye"), context.DeadlineExceeded)
+
+	// no frame is written, the connection is closed at the deadline
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	b, err := io.ReadAll(bufio.NewReader(client))
+	require.NoError(t, err)
+	require.Equal(t, []byte("raw"), b)
+}
+
+func TestNotHijacked(t *testing.T) {
+	tracker := NewTracker()
+	w := httptest.NewRecorder()
+	tracker.Handler(Terminal, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event"))
+		require.NoError(t, http.NewResponseController(w).Flush())
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.True(t, w.Flushed)
+	require.Equal(t, 0, tracker.Len())
+	require.NoError(t, tracker.Shutdown(context.Background(), ""))
+}
+
+func TestFrame(t *testing.T) {
+	require.Equal(t, []byte{0x81, 2, 'h', 'i'}, frame(0x1, []byte("hi")))
+	b := frame(0x1, bytes.Repeat([]byte("x"), 300))
+	require.Equal(t, []byte{0x81, 126, 0x01, 0x2c}, b[:4])
+	require.Len(t, b, 304)
+	b = frame(0x2, make([]byte, 70000))
+	require.Equal(t, []byte{0x82, 127, 0, 0, 0, 0, 0, 0x01, 0x11, 0x70}, b[:10])
+}
@@ -14,14 +14,16 @@ import (
 
 type ServerMeter struct {
 	name    string
-	ch      chan<- *metric.Gather
+	send    func(*metric.Gather)
 	handler http.Handler
 }
 
-func NewHandler(ch chan<- *metric.Gather, handler http.Handler) *ServerMeter {
+// NewHandler returns the handler that measures the requests of the handler,
+// the measurements of each request are passed to send.
+func NewHandler(send func(*metric.Gather), handler http.Handler) *ServerMeter {
 	return &ServerMeter{
 		name:    "http",
-		ch:      ch,
+		send:    send,
 		handler: handler,
 	}
 }
@@ -42,7 +44,7 @@ func (sm *ServerMeter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		measure.Add("http:bytes_sent", float64(rsp.responseBytes), bytesCounterType)
 		measure.Add("http:bytes_recv", float64(reqCounter.total), bytesCounterType)
 		measure.Add(fmt.Sprintf("http:status_%dxx", rsp.statusCode/100), 1, counterType)
-		sm.ch <- measure
+		sm.send(measure)
 
 		if err := recover(); err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
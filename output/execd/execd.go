@@ -0,0 +1,93 @@
+package execd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+	"github.com/OutOfBedlam/metrical/supervisor"
+)
+
+func init() {
+	registry.Register("execd", (*Execd)(nil))
+}
+
+//go:embed "execd.toml"
+var execdSampleConfig string
+
+func (e *Execd) SampleConfig() string {
+	return execdSampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Writes products as ndjson or line protocol to stdin of a long-running child process"
+}
+
+var _ metric.Output = (*Execd)(nil)
+var _ registry.Tagged = (*Execd)(nil)
+
+type Execd struct {
+	Command         []string      `toml:"command"`
+	Environment     []string      `toml:"environment"`
+	DataFormat      string        `toml:"data_format"`
+	RestartDelay    time.Duration `toml:"restart_delay"`
+	MaxRestartDelay time.Duration `toml:"max_restart_delay"`
+
+	process *supervisor.Process
+	tags    func(name string) map[string]string
+}
+
+func (e *Execd) SetTags(tags func(name string) map[string]string) {
+	e.tags = tags
+}
+
+func (e *Execd) Init() error {
+	switch e.DataFormat {
+	case "", "ndjson", "line":
+	default:
+		return fmt.Errorf("unknown data_format %q, ndjson or line", e.DataFormat)
+	}
+	e.process = &supervisor.Process{
+		Command:         e.Command,
+		Environment:     e.Environment,
+		RestartDelay:    e.RestartDelay,
+		MaxRestartDelay: e.MaxRestartDelay,
+		DrainStdin:      true,
+	}
+	return e.process.Start()
+}
+
+func (e *Execd) DeInit() {
+	if e.process != nil {
+		e.process.Stop()
+	}
+}
+
+// taggedProduct is the product with the tags in the ndjson format.
+type taggedProduct struct {
+	metric.Product
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Process writes the product as a line to the child,
+// the products are dropped while the child is restarting.
+func (e *Execd) Process(pd metric.Product) error {
+	var tags map[string]string
+	if e.tags != nil {
+		tags = e.tags(pd.Name)
+	}
+	if e.DataFormat == "line" {
+		if line := lineProtocol(pd, tags); line != nil {
+			return e.process.Write(line)
+		}
+		return nil
+	}
+	b, err := json.Marshal(taggedProduct{Product: pd, Tags: tags})
+	if err != nil {
+		return err
+	}
+	return e.process.Write(b)
+}
@@ -0,0 +1,50 @@
+package execd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecd(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.ndjson")
+	e := &Execd{Command: []string{"sh", "-c", "cat > " + out}}
+	e.SetTags(func(name string) map[string]string { return map[string]string{"host": "web1"} })
+	require.NoError(t, e.Init())
+
+	now := time.Unix(1700000000, 0).UTC()
+	require.NoError(t, e.Process(metric.Product{Name: "cpu:percent", Time: now, Type: "gauge", Value: &metric.GaugeValue{Samples: 1, Sum: 10, Value: 10}}))
+	require.NoError(t, e.Process(metric.Product{Name: "mem:used", Time: now, Type: "gauge", Value: &metric.GaugeValue{Samples: 2, Sum: 4, Value: 2}}))
+	e.DeInit()
+
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	var pd map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &pd))
+	require.Equal(t, "mem:used", pd["name"])
+	require.Equal(t, "gauge", pd["type"])
+	require.Equal(t, map[string]any{"host": "web1"}, pd["tags"])
+
+	// the products are dropped after the child is stopped
+	require.Error(t, e.Process(metric.Product{Name: "cpu:percent", Time: now, Type: "gauge", Value: &metric.GaugeValue{}}))
+}
+
+func TestLineProtocol(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	tags := map[string]string{"site": "plant a", "host": "web1", "empty": ""}
+	line := lineProtocol(metric.Product{Name: "disk:/:used percent", Time: now, Value: &metric.GaugeValue{Samples: 2, Sum: 5, Value: 2.5}}, tags)
+	require.Equal(t, `disk:/:used\ percent,host=web1,site=plant\ a value=2.5,sum=5,samples=2i 1700000000000000000`, string(line))
+
+	line = lineProtocol(metric.Product{Name: "http:latency", Time: now, Value: &metric.HistogramValue{Samples: 3, P: []float64{0.5, 0.999}, Values: []float64{10, 20}}}, nil)
+	require.Equal(t, `http:latency p50=10,p99.9=20,samples=3i 1700000000000000000`, string(line))
+
+	require.Nil(t, lineProtocol(metric.Product{Name: "x", Time: now, Value: &metric.CounterValue{}}, nil))
+}
@@ -0,0 +1,92 @@
+package execd
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/OutOfBedlam/metric"
+)
+
+// lineProtocol encodes the product in the line protocol,
+// "name[,tag=value...] field=value[,field=value...] timestamp",
+// e.g. "cpu:percent,host=web1 value=12.5,sum=75,samples=6i 1700000000000000000".
+// It returns nil if the product has no samples.
+func lineProtocol(pd metric.Product, tags map[string]string) []byte {
+	var fields []string
+	add := func(key string, value float64) {
+		fields = append(fields, key+"="+strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	var samples int64
+	switch p := pd.Value.(type) {
+	case *metric.CounterValue:
+		samples = p.Samples
+		add("value", p.Value)
+	case *metric.GaugeValue:
+		samples = p.Samples
+		add("value", p.Value)
+		add("sum", p.Sum)
+	case *metric.MeterValue:
+		samples = p.Samples
+		if p.Samples > 0 {
+			add("value", p.Sum/float64(p.Samples))
+		}
+		add("sum", p.Sum)
+		add("first", p.First)
+		add("last", p.Last)
+		add("min", p.Min)
+		add("max", p.Max)
+	case *metric.OdometerValue:
+		samples = p.Samples
+		add("value", p.Diff())
+		add("first", p.First)
+		add("last", p.Last)
+	case *metric.HistogramValue:
+		samples = p.Samples
+		for i, x := range p.P {
+			add("p"+strconv.FormatFloat(x*100, 'f', -1, 64), p.Values[i])
+		}
+	case *metric.TimerValue:
+		samples = p.Samples
+		add("sum", float64(p.Sum))
+		add("min", float64(p.Min))
+		add("max", float64(p.Max))
+	}
+	if samples == 0 {
+		return nil
+	}
+	fields = append(fields, "samples="+strconv.FormatInt(samples, 10)+"i")
+
+	var sb strings.Builder
+	sb.WriteString(escapeLine(pd.Name, ", "))
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		if tags[k] == "" {
+			continue
+		}
+		sb.WriteString(",")
+		sb.WriteString(escapeLine(k, ", ="))
+		sb.WriteString("=")
+		sb.WriteString(escapeLine(tags[k], ", ="))
+	}
+	sb.WriteString(" ")
+	sb.WriteString(strings.Join(fields, ","))
+	sb.WriteString(" ")
+	sb.WriteString(strconv.FormatInt(pd.Time.UnixNano(), 10))
+	return []byte(sb.String())
+}
+
+// escapeLine escapes the chars of s with '\\'.
+func escapeLine(s string, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,281 @@
+package metrical
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/ingest"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+func init() {
+	registry.Register("metrical", (*Forwarder)(nil))
+}
+
+//go:embed "metrical.toml"
+var metricalSampleConfig string
+
+func (f *Forwarder) SampleConfig() string {
+	return metricalSampleConfig
+}
+
+func (f *Forwarder) Description() string {
+	return "Forwards products to the ingest endpoint of a central metrical"
+}
+
+var _ metric.Output = (*Forwarder)(nil)
+var _ registry.Tagged = (*Forwarder)(nil)
+
+type Forwarder struct {
+	URL           string            `toml:"url"`
+	Host          string            `toml:"host"`
+	Series        string            `toml:"series"`
+	Headers       map[string]string `toml:"headers"`
+	BatchSize     int               `toml:"batch_size"`
+	FlushInterval time.Duration     `toml:"flush_interval"`
+	Timeout       time.Duration     `toml:"timeout"`
+	BufferLimit   int               `toml:"buffer_limit"`
+
+	TLSCA              string `toml:"tls_ca"`
+	TLSCert            string `toml:"tls_cert"`
+	TLSKey             string `toml:"tls_key"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+
+	client *http.Client
+	tags   func(name string) map[string]string
+	flush  chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	period  time.Duration
+	lines   [][]byte
+	dropped int
+}
+
+func (f *Forwarder) SetTags(tags func(name string) map[string]string) {
+	f.tags = tags
+}
+
+func (f *Forwarder) Init() error {
+	if f.URL == "" {
+		return errors.New("url is required")
+	}
+	if f.Host != "" && !ingest.ValidHost(f.Host) {
+		return fmt.Errorf("invalid host %q", f.Host)
+	}
+	if f.BatchSize <= 0 {
+		f.BatchSize = 500
+	}
+	if f.FlushInterval <= 0 {
+		f.FlushInterval = 10 * time.Second
+	}
+	if f.Timeout <= 0 {
+		f.Timeout = 10 * time.Second
+	}
+	if f.BufferLimit <= 0 {
+		f.BufferLimit = 10000
+	}
+	tlsConfig, err := f.tlsConfig()
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	f.client = &http.Client{Timeout: f.Timeout, Transport: transport}
+	f.flush = make(chan struct{}, 1)
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+	go f.run()
+	return nil
+}
+
+// tlsConfig returns the TLS config of the https url,
+// the CA of the self-signed central and the client certificate of mTLS.
+func (f *Forwarder) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: f.InsecureSkipVerify}
+	if f.TLSCA != "" {
+		b, err := os.ReadFile(f.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("tls_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("tls_ca %s: no certificate", f.TLSCA)
+		}
+		cfg.RootCAs = pool
+	}
+	if f.TLSCert != "" || f.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(f.TLSCert, f.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls_cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// DeInit sends the buffered products before it returns.
+func (f *Forwarder) DeInit() {
+	if f.stop == nil {
+		return
+	}
+	close(f.stop)
+	<-f.done
+	f.stop = nil
+}
+
+// Process buffers the products of the series, the products of
+// the other series are aggregated again by the central metrical.
+// The series defaults to the one of the shortest period.
+func (f *Forwarder) Process(pd metric.Product) error {
+	if pd.IsNull || pd.Value == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Series != "" {
+		if pd.SeriesID != f.Series {
+			return nil
+		}
+	} else {
+		if f.period == 0 || pd.Period < f.period {
+			f.period = pd.Period
+		}
+		if pd.Period != f.period {
+			return nil
+		}
+	}
+	tags := map[string]string{}
+	if f.tags != nil {
+		for k, v := range f.tags(pd.Name) {
+			tags[k] = v
+		}
+	}
+	if f.Host != "" {
+		tags["host"] = f.Host
+	} else if tags["host"] == "" {
+		tags["host"] = hostname()
+	}
+	b, err := json.Marshal(ingest.Record{Product: pd, Tags: tags})
+	if err != nil {
+		return err
+	}
+	f.lines = append(f.lines, b)
+	if over := len(f.lines) - f.BufferLimit; over > 0 {
+		f.lines = f.lines[over:]
+		f.dropped += over
+	}
+	if len(f.lines) >= f.BatchSize {
+		select {
+		case f.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (f *Forwarder) run() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			if err := f.send(); err != nil {
+				slog.Error("Failed to forward products", "url", f.URL, "error", err)
+			}
+			return
+		case <-ticker.C:
+		case <-f.flush:
+		}
+		if err := f.send(); err != nil {
+			slog.Error("Failed to forward products", "url", f.URL, "error", err)
+		}
+	}
+}
+
+// send posts the buffered products in batches.
+// The batch is buffered again to retry at the next flush
+// if the central metrical is unreachable or responds 5xx,
+// it is dropped if the central metrical rejects it.
+func (f *Forwarder) send() error {
+	for {
+		f.mu.Lock()
+		if f.dropped > 0 {
+			slog.Warn("Dropped products, the buffer is full", "url", f.URL, "dropped", f.dropped)
+			f.dropped = 0
+		}
+		n := min(len(f.lines), f.BatchSize)
+		batch := f.lines[:n:n]
+		f.lines = f.lines[n:]
+		f.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		retry, err := f.post(batch)
+		if err != nil {
+			if retry {
+				f.mu.Lock()
+				f.lines = append(batch, f.lines...)
+				if over := len(f.lines) - f.BufferLimit; over > 0 {
+					f.lines = f.lines[over:]
+					f.dropped += over
+				}
+				f.mu.Unlock()
+			}
+			return err
+		}
+	}
+}
+
+func (f *Forwarder) post(batch [][]byte) (bool, error) {
+	body := bytes.Join(batch, []byte("\n"))
+	ctx, cancel := context.WithTimeout(context.Background(), f.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range f.Headers {
+		req.Header.Set(k, v)
+	}
+	rsp, err := f.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		io.Copy(io.Discard, rsp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+	err = fmt.Errorf("error response from server: %s %s", rsp.Status, strings.TrimSpace(string(msg)))
+	return rsp.StatusCode >= 500 || rsp.StatusCode == http.StatusTooManyRequests, err
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	if short, _, ok := strings.Cut(name, "."); ok && short != "" {
+		return short
+	}
+	return name
+}
@@ -0,0 +1,100 @@
+package metrical
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/ingest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwarder(t *testing.T) {
+	var mu sync.Mutex
+	var received []ingest.Record
+	failures := 1
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var rec ingest.Record
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+			received = append(received, rec)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+
+	f := &Forwarder{
+		URL:           svr.URL,
+		Headers:       map[string]string{"Authorization": "Bearer secret"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	}
+	f.SetTags(func(name string) map[string]string { return map[string]string{"host": "web1", "site": "a"} })
+	require.NoError(t, f.Init())
+
+	ts := time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC)
+	products := []metric.Product{
+		{Name: "cpu:percent", Time: ts, Period: 10 * time.Second, SeriesID: "TS_10S", Type: "gauge", Value: &metric.GaugeValue{Samples: 1, Sum: 1, Value: 1}},
+		{Name: "cpu:percent", Time: ts, Period: time.Minute, SeriesID: "TS_1M", Type: "gauge", Value: &metric.GaugeValue{Samples: 6, Sum: 6, Value: 1}},
+		{Name: "mem:percent", Time: ts, Period: 10 * time.Second, SeriesID: "TS_10S", IsNull: true},
+		{Name: "mem:percent", Time: ts, Period: 10 * time.Second, SeriesID: "TS_10S", Type: "gauge", Value: &metric.GaugeValue{Samples: 1, Sum: 2, Value: 2}},
+	}
+	for _, pd := range products {
+		require.NoError(t, f.Process(pd))
+	}
+	// the first batch fails, it is sent again at the next flush
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return failures == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	f.DeInit()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 2)
+	require.Equal(t, "cpu:percent", received[0].Name)
+	require.Equal(t, "TS_10S", received[0].SeriesID)
+	require.Equal(t, map[string]string{"host": "web1", "site": "a"}, received[0].Tags)
+	require.Equal(t, "mem:percent", received[1].Name)
+	require.Equal(t, &metric.GaugeValue{Samples: 1, Sum: 2, Value: 2}, received[1].Value)
+}
+
+func TestForwarderHost(t *testing.T) {
+	f := &Forwarder{URL: "http://127.0.0.1:0", Host: "edge-1", Series: "TS_1M", FlushInterval: time.Hour}
+	require.NoError(t, f.Init())
+	defer func() {
+		f.mu.Lock()
+		f.lines = nil
+		f.mu.Unlock()
+		f.DeInit()
+	}()
+	ts := time.Now()
+	require.NoError(t, f.Process(metric.Product{Name: "a", Time: ts, SeriesID: "TS_10S", Period: 10 * time.Second, Type: "counter", Value: &metric.CounterValue{}}))
+	require.NoError(t, f.Process(metric.Product{Name: "a", Time: ts, SeriesID: "TS_1M", Period: time.Minute, Type: "counter", Value: &metric.CounterValue{}}))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	require.Len(t, f.lines, 1)
+	var rec ingest.Record
+	require.NoError(t, json.Unmarshal(f.lines[0], &rec))
+	require.Equal(t, "TS_1M", rec.SeriesID)
+	require.Equal(t, map[string]string{"host": "edge-1"}, rec.Tags)
+
+	require.Error(t, (&Forwarder{}).Init())
+	require.Error(t, (&Forwarder{URL: "http://x", Host: "a:b"}).Init())
+}
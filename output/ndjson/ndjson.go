@@ -23,13 +23,24 @@ func (o *Encoder) SampleConfig() string {
 	return ndjsonSampleConfig
 }
 
+func (o *Encoder) Description() string {
+	return "Writes products as ndjson to stdout or an HTTP endpoint"
+}
+
 var _ metric.Output = (*Encoder)(nil)
+var _ registry.Tagged = (*Encoder)(nil)
 
 type Encoder struct {
 	DestUrl                  string  `toml:"dest"`
 	Timeformat               string  `toml:"timeformat"`
 	HistogramValuePercentile float64 `toml:"histogram_value_selector"`
 	OdometerValueSelector    string  `toml:"odometer_value_selector"`
+
+	tags func(name string) map[string]string
+}
+
+func (o *Encoder) SetTags(tags func(name string) map[string]string) {
+	o.tags = tags
 }
 
 func (o *Encoder) Init() error {
@@ -71,12 +82,13 @@ func (o Encoder) Process(pd metric.Product) error {
 }
 
 type Record struct {
-	Name    string  `json:"NAME"`
-	Time    any     `json:"TIME"`
-	Type    string  `json:"TYPE"`
-	Period  string  `json:"PERIOD"`
-	Samples int64   `json:"SAMPLES"`
-	Value   float64 `json:"VALUE,omitempty"`
+	Name    string            `json:"NAME"`
+	Time    any               `json:"TIME"`
+	Type    string            `json:"TYPE"`
+	Period  string            `json:"PERIOD"`
+	Tags    map[string]string `json:"TAGS,omitempty"`
+	Samples int64             `json:"SAMPLES"`
+	Value   float64           `json:"VALUE,omitempty"`
 	// Gauge
 	Sum float64 `json:"SUM,omitempty"`
 	// Meter
@@ -105,6 +117,9 @@ func (o Encoder) convert(pd metric.Product) (*Record, error) {
 	}
 	r.Type = pd.Type
 	r.Period = pd.Period.String()
+	if o.tags != nil {
+		r.Tags = o.tags(pd.Name)
+	}
 
 	switch p := pd.Value.(type) {
 	case *metric.CounterValue:
@@ -0,0 +1,76 @@
+package convert
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+func init() {
+	registry.Register("convert", (*Convert)(nil))
+}
+
+//go:embed "convert.toml"
+var convertSampleConfig string
+
+func (c *Convert) SampleConfig() string {
+	return convertSampleConfig
+}
+
+func (c *Convert) Description() string {
+	return "Converts the value, type and unit of measurements"
+}
+
+var _ registry.Processor = (*Convert)(nil)
+
+type Convert struct {
+	Scale  float64 `toml:"scale"`
+	Offset float64 `toml:"offset"`
+	// "gauge", "meter", "counter", "odometer", "histogram" or "timer"
+	Type string `toml:"type"`
+	// "short", "scalar", "percent", "bytes" or "duration"
+	Unit string `toml:"unit"`
+
+	unit metric.Unit
+}
+
+func (c *Convert) Init() error {
+	if c.Scale == 0 {
+		c.Scale = 1
+	}
+	if c.Unit != "" {
+		unit, err := registry.ParseUnit(c.Unit)
+		if err != nil {
+			return fmt.Errorf("convert: %w", err)
+		}
+		c.unit = unit
+	}
+	if c.Type != "" {
+		if _, err := registry.ParseType(c.Type, metric.UnitShort); err != nil {
+			return fmt.Errorf("convert: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Convert) Apply(measures []metric.Measure) []metric.Measure {
+	for i, m := range measures {
+		m.Value = m.Value*c.Scale + c.Offset
+		if c.Type != "" || c.unit != "" {
+			typ, unit := c.Type, c.unit
+			if typ == "" {
+				typ = m.Type.Name()
+			}
+			if unit == "" {
+				unit = m.Type.Unit()
+			}
+			if t, err := registry.ParseType(typ, unit); err == nil {
+				m.Type = t
+			}
+		}
+		measures[i] = m
+	}
+	return measures
+}
@@ -0,0 +1,31 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	c := &Convert{Scale: 1024, Unit: "bytes"}
+	require.NoError(t, c.Init())
+	ms := c.Apply([]metric.Measure{
+		{Name: "mem_kib", Value: 2, Type: metric.MeterType(metric.UnitShort)},
+	})
+	require.Equal(t, 2048.0, ms[0].Value)
+	require.Equal(t, "meter", ms[0].Type.Name())
+	require.Equal(t, metric.UnitBytes, ms[0].Type.Unit())
+
+	c = &Convert{Offset: -273.15, Type: "Gauge"}
+	require.NoError(t, c.Init())
+	ms = c.Apply([]metric.Measure{
+		{Name: "temp_kelvin", Value: 300, Type: metric.MeterType(metric.UnitScalar)},
+	})
+	require.InDelta(t, 26.85, ms[0].Value, 1e-9)
+	require.Equal(t, "gauge", ms[0].Type.Name())
+	require.Equal(t, metric.UnitScalar, ms[0].Type.Unit())
+
+	require.Error(t, (&Convert{Type: "unknown"}).Init())
+	require.Error(t, (&Convert{Unit: "unknown"}).Init())
+}
@@ -0,0 +1,34 @@
+package drop
+
+import (
+	_ "embed"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+func init() {
+	registry.Register("drop", (*Drop)(nil))
+}
+
+//go:embed "drop.toml"
+var dropSampleConfig string
+
+func (d *Drop) SampleConfig() string {
+	return dropSampleConfig
+}
+
+func (d *Drop) Description() string {
+	return "Drops measurements matching the filter"
+}
+
+var _ registry.Processor = (*Drop)(nil)
+
+// Drop discards the measurements, it is used with the filter
+// to drop the matching measurements.
+type Drop struct {
+}
+
+func (d *Drop) Apply(measures []metric.Measure) []metric.Measure {
+	return nil
+}
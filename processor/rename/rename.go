@@ -0,0 +1,56 @@
+package rename
+
+import (
+	_ "embed"
+	"errors"
+	"strings"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/OutOfBedlam/metrical/registry"
+)
+
+func init() {
+	registry.Register("rename", (*Rename)(nil))
+}
+
+//go:embed "rename.toml"
+var renameSampleConfig string
+
+func (r *Rename) SampleConfig() string {
+	return renameSampleConfig
+}
+
+func (r *Rename) Description() string {
+	return "Renames measurements by replacing substrings"
+}
+
+var _ registry.Processor = (*Rename)(nil)
+
+type Rename struct {
+	Replaces []Replace `toml:"replace"`
+}
+
+type Replace struct {
+	Old string `toml:"old"`
+	New string `toml:"new"`
+}
+
+func (r *Rename) Init() error {
+	for _, rep := range r.Replaces {
+		if rep.Old == "" {
+			return errors.New("rename: old is required")
+		}
+	}
+	return nil
+}
+
+// Apply replaces the substrings of the names in order.
+func (r *Rename) Apply(measures []metric.Measure) []metric.Measure {
+	for i, m := range measures {
+		for _, rep := range r.Replaces {
+			m.Name = strings.ReplaceAll(m.Name, rep.Old, rep.New)
+		}
+		measures[i] = m
+	}
+	return measures
+}
@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/metric"
+)
+
+// GatherResult is the measurements of an input gathered once.
+type GatherResult struct {
+	Input    string
+	Measures []metric.Measure
+	Err      error
+}
+
+// GatherInputs instantiates the inputs of the content without a collector,
+// and runs Init and Gather once on each of them with the filters and the processors.
+// If names is not empty, only the inputs of the names are gathered.
+// The errors of the inputs are reported in the results.
+func GatherInputs(content string, names []string) ([]GatherResult, error) {
+	cfg := make(map[string]any)
+	meta, err := toml.Decode(content, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	processors, err := loadProcessors(cfg, meta)
+	if err != nil {
+		return nil, err
+	}
+	var ret []GatherResult
+	var gathered []string
+	for _, keys := range meta.Keys() {
+		if len(keys) != 2 || keys[0] != "input" {
+			continue
+		}
+		name := keys[1]
+		if slices.Contains(gathered, name) || (len(names) > 0 && !slices.Contains(names, name)) {
+			continue
+		}
+		gathered = append(gathered, name)
+		reg, ok := registry["input."+name]
+		if !ok {
+			return nil, fmt.Errorf("unknown input type: %s", name)
+		}
+		sections, ok := ((cfg["input"].(map[string]any))[name]).([]map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("input %s should be an array of tables [[input.%s]]", name, name)
+		}
+		for _, section := range sections {
+			opts, section, err := splitInputOptions(reg, section)
+			if err != nil {
+				return nil, fmt.Errorf("input %s: %w", name, err)
+			}
+			v, filter, _, err := decodeSection(reg, section)
+			if err != nil {
+				return nil, err
+			}
+			input, ok := v.(metric.Input)
+			if !ok {
+				return nil, fmt.Errorf("type %s is not implement input", name)
+			}
+			input = wrapInput(input, filter, processors, func(...metric.Measure) {})
+			// gathers once, the interval and the jitter do not matter
+			input = opts.withTimeout(input)
+			ret = append(ret, gatherOnce(name, input))
+		}
+	}
+	for _, name := range names {
+		if !slices.Contains(gathered, name) {
+			return ret, fmt.Errorf("input %s is not configured", name)
+		}
+	}
+	return ret, nil
+}
+
+func gatherOnce(name string, input metric.Input) GatherResult {
+	ret := GatherResult{Input: name}
+	if err := initInput(input); err != nil {
+		ret.Err = err
+		return ret
+	}
+	defer deinitInput(input)
+	g := &metric.Gather{}
+	if err := input.Gather(g); err != nil {
+		ret.Err = err
+	}
+	ret.Measures = slices.Clone(g.Measures())
+	return ret
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherInputs(t *testing.T) {
+	Register("gather_cpu", (*CPUMock)(nil))
+	Register("gather_mem", (*MEMMock)(nil))
+	Register("gather_scale", (*ScaleMock)(nil))
+
+	content := `
+		[[input.gather_cpu]]
+			measure = "percent"
+		[[input.gather_mem]]
+			measure = "stack"
+			[input.gather_mem.filter]
+				excludes = ["mem:stack"]
+		[[input.gather_mem]]
+			measure = "heap"
+		[[processor.gather_scale]]
+			factor = 2
+			[processor.gather_scale.filter]
+				includes = ["mem:*"]
+		`
+	results, err := GatherInputs(content, nil)
+	require.NoError(t, err)
+	summary := []string{}
+	for _, r := range results {
+		require.NoError(t, r.Err)
+		for _, m := range r.Measures {
+			summary = append(summary, fmt.Sprintf("%s %s %v %s %s", r.Input, m.Name, m.Value, m.Type.Name(), m.Type.Unit()))
+		}
+	}
+	require.Len(t, results, 3)
+	require.Equal(t, []string{
+		"gather_cpu cpu:percent 10 meter Percent",
+		"gather_mem mem:heap 40 gauge Bytes",
+	}, summary)
+
+	results, err = GatherInputs(content, []string{"gather_cpu"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	_, err = GatherInputs(content, []string{"gather_disk"})
+	require.Error(t, err)
+}
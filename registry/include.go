@@ -0,0 +1,271 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the content of the config files merged,
+// with the positions of the keys in the files.
+type Config struct {
+	Content string
+	pos     map[string]any
+}
+
+// Position returns the "file:line" of the key, e.g. ["input", "cpu", "0", "percpu"],
+// or the position of the closest table if the line of the key is unknown.
+func (c *Config) Position(key ...string) string {
+	return lookupPosition(c.pos, key)
+}
+
+// ReadConfig interpolates the config content of the file name,
+// and merges the files of the "include" key and the *.toml files of the config directory.
+// The relative paths of the "include" are resolved from the directory
+// of the file that has the key.
+//
+// The arrays of tables, e.g. [[input.cpu]] and [[http.term]], are concatenated,
+// the tables are merged key by key and the other values are overridden
+// by the later files. The config directory is merged after the content
+// in the order of the file names.
+// The content is kept as it is if there is nothing to merge,
+// otherwise the merged content keeps the keys in the order of appearance
+// in the files, that is the order of the processors, for example.
+func ReadConfig(name string, content string, configDir string) (*Config, error) {
+	content, err := Interpolate(content)
+	if err != nil {
+		return nil, err
+	}
+	root := map[string]any{}
+	meta, err := toml.Decode(content, &root)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Config{Content: content, pos: keyPositions(name, content)}
+	if _, ok := root["include"]; !ok && configDir == "" {
+		return ret, nil
+	}
+	visited := map[string]bool{}
+	order := newKeyOrder()
+	order.add(meta.Keys())
+	if err := resolveIncludes(root, ret.pos, filepath.Dir(name), visited, order); err != nil {
+		return nil, err
+	}
+	if configDir != "" {
+		files, err := filepath.Glob(filepath.Join(configDir, "*.toml"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			if _, err := os.Stat(configDir); err != nil {
+				return nil, err
+			}
+		}
+		slices.Sort(files)
+		for _, file := range files {
+			m, pos, err := readConfigFile(file, visited, order)
+			if err != nil {
+				return nil, err
+			}
+			mergeConfig(root, m)
+			mergeConfig(ret.pos, pos)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := order.encode(buf, nil, root, false); err != nil {
+		return nil, err
+	}
+	ret.Content = buf.String()
+	return ret, nil
+}
+
+// readConfigFile reads the file and the files of its "include" key.
+func readConfigFile(path string, visited map[string]bool, order *keyOrder) (map[string]any, map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if visited[abs] {
+		return nil, nil, fmt.Errorf("config %s is included more than once", path)
+	}
+	visited[abs] = true
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := Interpolate(string(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	m := map[string]any{}
+	meta, err := toml.Decode(content, &m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	order.add(meta.Keys())
+	pos := keyPositions(path, content)
+	if err := resolveIncludes(m, pos, filepath.Dir(path), visited, order); err != nil {
+		return nil, nil, err
+	}
+	return m, pos, nil
+}
+
+// resolveIncludes merges the files of the "include" key of the config
+// into the config and its positions, the patterns of the key can have wildcards.
+func resolveIncludes(cfg map[string]any, pos map[string]any, dir string, visited map[string]bool, order *keyOrder) error {
+	v, ok := cfg["include"]
+	if !ok {
+		return nil
+	}
+	delete(cfg, "include")
+	delete(pos, "include")
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("include should be an array of file names, got %T", v)
+	}
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("include should be an array of file names, got %T", item)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		files := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if files, err = filepath.Glob(pattern); err != nil {
+				return fmt.Errorf("include %q: %w", pattern, err)
+			}
+			slices.Sort(files)
+		}
+		for _, file := range files {
+			m, p, err := readConfigFile(file, visited, order)
+			if err != nil {
+				return err
+			}
+			mergeConfig(cfg, m)
+			mergeConfig(pos, p)
+		}
+	}
+	return nil
+}
+
+// mergeConfig merges src into dst, the arrays of tables are concatenated,
+// the tables are merged and the others are overridden.
+func mergeConfig(dst, src map[string]any) {
+	for k, sv := range src {
+		switch s := sv.(type) {
+		case map[string]any:
+			if d, ok := dst[k].(map[string]any); ok {
+				mergeConfig(d, s)
+				continue
+			}
+		case []map[string]any:
+			if d, ok := dst[k].([]map[string]any); ok {
+				dst[k] = append(d, s...)
+				continue
+			}
+		}
+		dst[k] = sv
+	}
+}
+
+// keyOrder is the order of appearance of the keys in the config files,
+// the keys of the arrays of tables are without the indexes,
+// e.g. "input.cpu.percpu" for the "percpu" of every [[input.cpu]].
+type keyOrder struct {
+	rank map[string]int
+}
+
+func newKeyOrder() *keyOrder {
+	return &keyOrder{rank: map[string]int{}}
+}
+
+// add adds the keys that have not appeared yet, with their parents
+// that appear implicitly, e.g. "input" of [[input.cpu]].
+func (o *keyOrder) add(keys []toml.Key) {
+	for _, key := range keys {
+		for i := range key {
+			k := key[:i+1].String()
+			if _, ok := o.rank[k]; !ok {
+				o.rank[k] = len(o.rank)
+			}
+		}
+	}
+}
+
+// sorted returns the keys of the table at the path in the order of appearance,
+// the keys that have not appeared are sorted after them.
+func (o *keyOrder) sorted(path []string, tbl map[string]any) []string {
+	keys := make([]string, 0, len(tbl))
+	ranks := make(map[string]int, len(tbl))
+	for k := range tbl {
+		keys = append(keys, k)
+		r, ok := o.rank[toml.Key(append(slices.Clone(path), k)).String()]
+		if !ok {
+			r = len(o.rank)
+		}
+		ranks[k] = r
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := ranks[a] - ranks[b]; c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// encode writes the table at the path as TOML with the keys in the order
+// of appearance, toml.Encoder sorts the keys of the tables.
+// The header of the table is written if it has values of its own,
+// is empty, or is an element of an array of tables.
+func (o *keyOrder) encode(w *bytes.Buffer, path []string, tbl map[string]any, arrayElem bool) error {
+	keys := o.sorted(path, tbl)
+	var values, tables []string
+	for _, k := range keys {
+		switch tbl[k].(type) {
+		case map[string]any, []map[string]any:
+			tables = append(tables, k)
+		default:
+			values = append(values, k)
+		}
+	}
+	if len(path) > 0 && (arrayElem || len(values) > 0 || len(tables) == 0) {
+		header := toml.Key(path).String()
+		if arrayElem {
+			fmt.Fprintf(w, "[[%s]]\n", header)
+		} else {
+			fmt.Fprintf(w, "[%s]\n", header)
+		}
+	}
+	for _, k := range values {
+		b, err := toml.Marshal(map[string]any{k: tbl[k]})
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+	}
+	for _, k := range tables {
+		sub := append(slices.Clone(path), k)
+		switch v := tbl[k].(type) {
+		case map[string]any:
+			if err := o.encode(w, sub, v, false); err != nil {
+				return err
+			}
+		case []map[string]any:
+			for _, elem := range v {
+				if err := o.encode(w, sub, elem, true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, 0755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("common.toml", `
+[log]
+  level = "DEBUG"
+[[input.mock]]
+  name = "common"
+`)
+	write("conf.d/20-output.toml", `
+[[output.mock]]
+  name = "out"
+[http]
+  listen = ":4000"
+`)
+	write("conf.d/10-input.toml", `
+[[input.mock]]
+  name = "conf.d"
+[[http.term]]
+  path = "/term"
+`)
+
+	// nothing to merge
+	content := "[log]\n  # comment\n  level = \"${METRICAL_TEST_LEVEL:-INFO}\"\n"
+	ret, err := ReadConfig(filepath.Join(dir, "main.toml"), content, "")
+	require.NoError(t, err)
+	require.Equal(t, "[log]\n  # comment\n  level = \"INFO\"\n", ret.Content)
+	require.Equal(t, filepath.Join(dir, "main.toml")+":3", ret.Position("log", "level"))
+
+	content = `
+include = ["common.toml"]
+[log]
+  stdout = true
+[http]
+  listen = ":3000"
+  [[http.term]]
+    path = "/shell"
+[[input.mock]]
+  name = "main"
+`
+	ret, err = ReadConfig(filepath.Join(dir, "main.toml"), content, confDir)
+	require.NoError(t, err)
+	cfg := map[string]any{}
+	_, err = toml.Decode(ret.Content, &cfg)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"log": map[string]any{"stdout": true, "level": "DEBUG"},
+		"http": map[string]any{
+			"listen": ":4000",
+			"term":   []map[string]any{{"path": "/shell"}, {"path": "/term"}},
+		},
+		"input": map[string]any{
+			"mock": []map[string]any{{"name": "main"}, {"name": "common"}, {"name": "conf.d"}},
+		},
+		"output": map[string]any{
+			"mock": []map[string]any{{"name": "out"}},
+		},
+	}, cfg)
+
+	// positions of the keys in the merged files
+	require.Equal(t, filepath.Join(dir, "main.toml")+":4", ret.Position("log", "stdout"))
+	require.Equal(t, filepath.Join(dir, "common.toml")+":3", ret.Position("log", "level"))
+	require.Equal(t, filepath.Join(confDir, "20-output.toml")+":5", ret.Position("http", "listen"))
+	require.Equal(t, filepath.Join(dir, "main.toml")+":10", ret.Position("input", "mock", "0", "name"))
+	require.Equal(t, filepath.Join(dir, "common.toml")+":5", ret.Position("input", "mock", "1", "name"))
+	require.Equal(t, filepath.Join(confDir, "10-input.toml")+":2", ret.Position("input", "mock", "2"))
+	require.Equal(t, filepath.Join(confDir, "10-input.toml")+":5", ret.Position("http", "term", "1", "path"))
+	require.Equal(t, filepath.Join(confDir, "10-input.toml")+":2", ret.Position("input", "mock", "2", "unknown"))
+
+	// include cycle
+	write("a.toml", `include = ["b.toml"]`)
+	write("b.toml", `include = ["a.toml"]`)
+	_, err = ReadConfig(filepath.Join(dir, "main.toml"), `include = ["a.toml"]`, "")
+	require.Error(t, err)
+
+	// missing files
+	_, err = ReadConfig(filepath.Join(dir, "main.toml"), `include = ["missing.toml"]`, "")
+	require.Error(t, err)
+	_, err = ReadConfig(filepath.Join(dir, "main.toml"), ``, filepath.Join(dir, "missing.d"))
+	require.Error(t, err)
+	// no matching files of the wildcard
+	_, err = ReadConfig(filepath.Join(dir, "main.toml"), `include = ["missing/*.toml"]`, "")
+	require.NoError(t, err)
+}
+
+func TestReadConfigOrder(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "processors.toml"), []byte(`
+[[processor.zeta]]
+  order = 1
+[[processor.alpha]]
+  "quoted key" = "a"
+  [processor.alpha.rules]
+    b = 2
+    a = 1
+[[processor.zeta]]
+`), 0644))
+	content := `
+include = ["processors.toml"]
+[log]
+  level = "INFO"
+[[input.mem]]
+[[input.cpu]]
+  percpu = true
+  [input.cpu.filter]
+    includes = ["cpu*"]
+[[input.mem]]
+`
+	ret, err := ReadConfig(filepath.Join(dir, "main.toml"), content, "")
+	require.NoError(t, err)
+	meta, err := toml.Decode(ret.Content, &map[string]any{})
+	require.NoError(t, err, ret.Content)
+	var keys []string
+	for _, key := range meta.Keys() {
+		keys = append(keys, key.String())
+	}
+	// the keys are in the order of appearance, not alphabetical
+	require.Equal(t, []string{
+		"log", "log.level", "input.mem", "input.mem", "input.cpu", "input.cpu.percpu", "input.cpu.filter", "input.cpu.filter.includes",
+		"processor.zeta", "processor.zeta.order", "processor.zeta",
+		"processor.alpha", `processor.alpha."quoted key"`, "processor.alpha.rules", "processor.alpha.rules.b", "processor.alpha.rules.a",
+	}, keys)
+}
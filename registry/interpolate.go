@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var interpolateRegexp = regexp.MustCompile(`^\$?\$\{(file:[^}]+|[A-Za-z_][A-Za-z0-9_]*(?::-[^}]*)?)\}`)
+
+// the lexical context of the reference in the TOML content
+type tomlContext int
+
+const (
+	tomlBare tomlContext = iota
+	tomlComment
+	tomlBasic            // "..."
+	tomlLiteral          // '...'
+	tomlMultilineBasic   // """..."""
+	tomlMultilineLiteral // '''...'''
+)
+
+// Interpolate replaces the references in the config content,
+//
+//	${ENV_VAR}            the value of the environment variable, error if not set
+//	${ENV_VAR:-default}   the default if the environment variable is not set or empty
+//	${file:/path/to/file} the content of the file without trailing newlines
+//
+// "$${" is the escape of the literal "${", the comments are kept as they are.
+// The values are escaped in the basic strings "...", and it is an error
+// if the value can not be placed in the literal string '...'.
+func Interpolate(content string) (string, error) {
+	if !strings.Contains(content, "${") {
+		return content, nil
+	}
+	var sb strings.Builder
+	var ctx = tomlBare
+	for i := 0; i < len(content); {
+		rest := content[i:]
+		if ctx == tomlComment {
+			if rest[0] == '\n' {
+				ctx = tomlBare
+			}
+			sb.WriteByte(rest[0])
+			i++
+			continue
+		}
+		if rest[0] == '$' {
+			if loc := interpolateRegexp.FindStringSubmatchIndex(rest); loc != nil {
+				ref := rest[:loc[1]]
+				if strings.HasPrefix(ref, "$$") {
+					sb.WriteString(ref[1:])
+				} else if v, err := interpolateValue(ctx, rest[loc[2]:loc[3]]); err != nil {
+					return "", fmt.Errorf("line %d: %w", strings.Count(content[:i], "\n")+1, err)
+				} else {
+					sb.WriteString(v)
+				}
+				i += loc[1]
+				continue
+			}
+		}
+		n := 1
+		switch ctx {
+		case tomlBare:
+			switch {
+			case rest[0] == '#':
+				ctx = tomlComment
+			case strings.HasPrefix(rest, `"""`):
+				ctx, n = tomlMultilineBasic, 3
+			case strings.HasPrefix(rest, `'''`):
+				ctx, n = tomlMultilineLiteral, 3
+			case rest[0] == '"':
+				ctx = tomlBasic
+			case rest[0] == '\'':
+				ctx = tomlLiteral
+			}
+		case tomlBasic:
+			switch rest[0] {
+			case '\\':
+				n = min(2, len(rest))
+			case '"', '\n':
+				ctx = tomlBare
+			}
+		case tomlLiteral:
+			if rest[0] == '\'' || rest[0] == '\n' {
+				ctx = tomlBare
+			}
+		case tomlMultilineBasic:
+			if rest[0] == '\\' {
+				n = min(2, len(rest))
+			} else if strings.HasPrefix(rest, `"""`) {
+				ctx, n = tomlBare, 3
+			}
+		case tomlMultilineLiteral:
+			if strings.HasPrefix(rest, `'''`) {
+				ctx, n = tomlBare, 3
+			}
+		}
+		sb.WriteString(rest[:n])
+		i += n
+	}
+	return sb.String(), nil
+}
+
+// interpolateValue resolves the reference, and escapes the value for the context.
+func interpolateValue(ctx tomlContext, ref string) (string, error) {
+	v, err := resolveRef(ref)
+	if err != nil {
+		return "", err
+	}
+	switch ctx {
+	case tomlBasic, tomlMultilineBasic:
+		return escapeBasic(v), nil
+	case tomlLiteral:
+		if strings.ContainsAny(v, "'\r\n") {
+			return "", fmt.Errorf("the value of ${%s} can not be in '...', use \"...\" instead", ref)
+		}
+	case tomlMultilineLiteral:
+		if strings.Contains(v, "'''") {
+			return "", fmt.Errorf("the value of ${%s} can not be in '''...''', use \"\"\"...\"\"\" instead", ref)
+		}
+	}
+	return v, nil
+}
+
+// escapeBasic escapes the value for the basic strings of TOML.
+func escapeBasic(v string) string {
+	var sb strings.Builder
+	for _, r := range v {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func resolveRef(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	name, def, hasDefault := strings.Cut(ref, ":-")
+	if v, ok := os.LookupEnv(name); ok && (v != "" || !hasDefault) {
+		return v, nil
+	}
+	if hasDefault {
+		return def, nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
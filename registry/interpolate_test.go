@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secret, []byte("s3cr3t\n"), 0600))
+	t.Setenv("METRICAL_TEST_HOST", "example.com")
+	t.Setenv("METRICAL_TEST_EMPTY", "")
+	t.Setenv("METRICAL_TEST_QUOTE", `p"a\ss'`)
+
+	content := `dest = "http://${METRICAL_TEST_HOST}:${METRICAL_TEST_PORT:-5654}/write"
+password = '${file:` + secret + `}'
+empty = "${METRICAL_TEST_EMPTY}"
+fallback = "${METRICAL_TEST_EMPTY:-none}"
+escaped = "$${METRICAL_TEST_HOST}"
+filename = "${log-filename}"
+# comment = "${METRICAL_TEST_UNDEFINED}" $${METRICAL_TEST_HOST}
+port = ${METRICAL_TEST_PORT:-5654} # ${METRICAL_TEST_UNDEFINED}
+hash = "#${METRICAL_TEST_HOST}"
+quote = "${METRICAL_TEST_QUOTE}"
+multiline = """
+${METRICAL_TEST_QUOTE}"""
+`
+	ret, err := Interpolate(content)
+	require.NoError(t, err)
+	require.Equal(t, `dest = "http://example.com:5654/write"
+password = 's3cr3t'
+empty = ""
+fallback = "none"
+escaped = "${METRICAL_TEST_HOST}"
+filename = "${log-filename}"
+# comment = "${METRICAL_TEST_UNDEFINED}" $${METRICAL_TEST_HOST}
+port = 5654 # ${METRICAL_TEST_UNDEFINED}
+hash = "#example.com"
+quote = "p\"a\\ss'"
+multiline = """
+p\"a\\ss'"""
+`, ret)
+	var decoded struct{ Quote, Multiline string }
+	_, err = toml.Decode(ret, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, `p"a\ss'`, decoded.Quote)
+	require.Equal(t, `p"a\ss'`, decoded.Multiline)
+
+	_, err = Interpolate("\nkey = \"${METRICAL_TEST_UNDEFINED}\"")
+	require.EqualError(t, err, "line 2: environment variable METRICAL_TEST_UNDEFINED is not set")
+	_, err = Interpolate(`key = "${file:/nonexistent/metrical}"`)
+	require.Error(t, err)
+	_, err = Interpolate(`key = '${METRICAL_TEST_QUOTE}'`)
+	require.EqualError(t, err, `line 1: the value of ${METRICAL_TEST_QUOTE} can not be in '...', use "..." instead`)
+}
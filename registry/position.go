@@ -0,0 +1,229 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// posKey is the key of the table header position in the position tree.
+const posKey = "\x00pos"
+
+// keyPositions scans the TOML content, and returns the positions
+// of the keys in the same shape as the decoded content,
+// the positions are "file:line" strings and the tables have
+// the position of their header in the posKey.
+// The content is assumed to be valid TOML.
+func keyPositions(file string, content string) map[string]any {
+	root := map[string]any{}
+	current := root
+	var st valueState
+	for i, line := range strings.Split(content, "\n") {
+		pos := fmt.Sprintf("%s:%d", file, i+1)
+		if st.continued() {
+			st.scan(line)
+			continue
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[["):
+			end := strings.Index(line, "]]")
+			if end < 0 {
+				continue
+			}
+			path := splitKey(line[2:end])
+			if len(path) == 0 {
+				continue
+			}
+			parent := walkTables(root, path[:len(path)-1])
+			last := path[len(path)-1]
+			arr, _ := parent[last].([]map[string]any)
+			current = map[string]any{posKey: pos}
+			parent[last] = append(arr, current)
+		case strings.HasPrefix(line, "["):
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			current = walkTables(root, splitKey(line[1:end]))
+			if _, ok := current[posKey]; !ok {
+				current[posKey] = pos
+			}
+		default:
+			eq := keyEnd(line)
+			if eq < 0 {
+				continue
+			}
+			path := splitKey(line[:eq])
+			if len(path) == 0 {
+				continue
+			}
+			parent := walkTables(current, path[:len(path)-1])
+			parent[path[len(path)-1]] = pos
+			st.scan(line[eq+1:])
+		}
+	}
+	return root
+}
+
+// walkTables returns the table of the path from the table,
+// the missing tables are created, the last element of an array of tables is used.
+func walkTables(table map[string]any, path []string) map[string]any {
+	for _, k := range path {
+		switch v := table[k].(type) {
+		case map[string]any:
+			table = v
+		case []map[string]any:
+			if len(v) == 0 {
+				v = append(v, map[string]any{})
+				table[k] = v
+			}
+			table = v[len(v)-1]
+		default:
+			m := map[string]any{}
+			table[k] = m
+			table = m
+		}
+	}
+	return table
+}
+
+// keyEnd returns the index of '=' after the key, -1 if not found.
+func keyEnd(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitKey splits the dotted key, e.g. `a."b.c".d` to ["a", "b.c", "d"].
+func splitKey(key string) []string {
+	var ret []string
+	var quote byte
+	part := strings.Builder{}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(key) {
+				i++
+				part.WriteByte(key[i])
+			} else if c == quote {
+				quote = 0
+			} else {
+				part.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			ret = append(ret, strings.TrimSpace(part.String()))
+			part.Reset()
+		case c != ' ' && c != '\t':
+			part.WriteByte(c)
+		}
+	}
+	if s := strings.TrimSpace(part.String()); s != "" || len(ret) > 0 {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// valueState tracks the values that continue to the next lines,
+// the arrays, inline tables and multi-line strings.
+type valueState struct {
+	depth int
+	// delimiter of the multi-line string
+	multi string
+}
+
+func (st *valueState) continued() bool {
+	return st.depth > 0 || st.multi != ""
+}
+
+func (st *valueState) scan(s string) {
+	for i := 0; i < len(s); i++ {
+		if st.multi != "" {
+			end := strings.Index(s[i:], st.multi)
+			if end < 0 {
+				return
+			}
+			i += end + len(st.multi) - 1
+			st.multi = ""
+			continue
+		}
+		switch c := s[i]; c {
+		case '"', '\'':
+			delim := strings.Repeat(string(c), 3)
+			if strings.HasPrefix(s[i:], delim) {
+				st.multi = delim
+				i += 2
+				continue
+			}
+			for i++; i < len(s) && s[i] != c; i++ {
+				if c == '"' && s[i] == '\\' {
+					i++
+				}
+			}
+		case '#':
+			return
+		case '[', '{':
+			st.depth++
+		case ']', '}':
+			st.depth--
+		}
+	}
+}
+
+// lookupPosition returns the position of the key in the position tree,
+// or the position of the closest table of the key.
+// A number after an array of tables is the index of the array,
+// otherwise the first table that has the rest of the key is used.
+func lookupPosition(tree map[string]any, key []string) string {
+	pos, _ := tree[posKey].(string)
+	for i := 0; i < len(key); i++ {
+		switch v := tree[key[i]].(type) {
+		case string:
+			return v
+		case map[string]any:
+			tree = v
+		case []map[string]any:
+			if len(v) == 0 {
+				return pos
+			}
+			if i+1 < len(key) {
+				if idx, err := strconv.Atoi(key[i+1]); err == nil && idx >= 0 && idx < len(v) {
+					tree = v[idx]
+					i++
+					break
+				}
+			}
+			tree = v[0]
+			for _, t := range v {
+				if i+1 < len(key) && t[key[i+1]] != nil {
+					tree = t
+					break
+				}
+			}
+		default:
+			return pos
+		}
+		if p, ok := tree[posKey].(string); ok {
+			pos = p
+		}
+	}
+	return pos
+}
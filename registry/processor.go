@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/metric"
+)
+
+type processorItem struct {
+	name      string
+	order     int64
+	filter    metric.Filter
+	processor Processor
+}
+
+// loadProcessors instantiates the processors of the "processor" sections.
+// The processors are sorted by the "order" key of the sections,
+// the sections without "order" keep the order of appearance.
+func loadProcessors(cfg map[string]any, meta toml.MetaData) ([]*processorItem, error) {
+	var ret []*processorItem
+	var names []string
+	for _, keys := range meta.Keys() {
+		if len(keys) != 2 || keys[0] != "processor" || slices.Contains(names, keys[1]) {
+			continue
+		}
+		name := keys[1]
+		names = append(names, name)
+		reg, ok := registry["processor."+name]
+		if !ok {
+			return nil, fmt.Errorf("unknown processor type: %s", name)
+		}
+		sections, ok := ((cfg["processor"].(map[string]any))[name]).([]map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("processor %s should be an array of tables [[processor.%s]]", name, name)
+		}
+		for _, section := range sections {
+			v, filter, _, err := decodeSection(reg, section)
+			if err != nil {
+				return nil, err
+			}
+			item := &processorItem{name: name, filter: filter, processor: v.(Processor)}
+			if order, ok := section["order"].(int64); ok {
+				item.order = order
+			}
+			if hasInit, ok := v.(interface{ Init() error }); ok {
+				if err := hasInit.Init(); err != nil {
+					return nil, fmt.Errorf("processor %s error %v", name, err)
+				}
+			}
+			ret = append(ret, item)
+		}
+	}
+	slices.SortStableFunc(ret, func(a, b *processorItem) int {
+		return int(a.order - b.order)
+	})
+	return ret, nil
+}
+
+// applyProcessors passes the measurements through the processors in order,
+// a processor with the filter gets only the matching measurements,
+// the others bypass the processor.
+func applyProcessors(processors []*processorItem, measures []metric.Measure) []metric.Measure {
+	for _, p := range processors {
+		if len(measures) == 0 {
+			break
+		}
+		if p.filter == nil {
+			measures = p.processor.Apply(measures)
+			continue
+		}
+		var matched, bypass []metric.Measure
+		for _, m := range measures {
+			if p.filter.Match(m.Name) {
+				matched = append(matched, m)
+			} else {
+				bypass = append(bypass, m)
+			}
+		}
+		if len(matched) > 0 {
+			matched = p.processor.Apply(matched)
+		}
+		measures = append(bypass, matched...)
+	}
+	return measures
+}
+
+// processedInput applies the processors to the measurements of the input.
+type processedInput struct {
+	inputWrapper
+	processors []*processorItem
+}
+
+func (pi *processedInput) Gather(g *metric.Gather) error {
+	if err := pi.Input.Gather(g); err != nil {
+		return err
+	}
+	measures := applyProcessors(pi.processors, slices.Clone(g.Measures()))
+	g.Filter(matchNone{})
+	for _, m := range measures {
+		g.Add(m.Name, m.Value, m.Type)
+	}
+	return nil
+}
+
+// matchNone is the filter that removes all measurements of a gather.
+type matchNone struct{}
+
+func (matchNone) Match(string) bool { return false }
+
+// gatherNames returns the names of the measurements of the gather.
+func gatherNames(g *metric.Gather) []string {
+	var names []string
+	for _, m := range g.Measures() {
+		names = append(names, m.Name)
+	}
+	return names
+}
@@ -16,6 +16,22 @@ var registry = make(map[string]RegisterItem)
 type RegisterItem struct {
 	Type         reflect.Type
 	SampleConfig string
+	Description  string
+}
+
+// Pusher is implemented by the inputs that produce measurements
+// asynchronously (e.g. subscriptions) besides the periodic Gather.
+// LoadConfig calls SetPush with a function that delivers
+// the measurements to the collector, after applying the input's filter.
+type Pusher interface {
+	SetPush(push func(...metric.Measure))
+}
+
+// Processor transforms the measurements between the inputs and the collector,
+// e.g. renaming, dropping, scaling or changing the type of the measurements.
+// Apply returns the measurements to pass to the next processor.
+type Processor interface {
+	Apply(measures []metric.Measure) []metric.Measure
 }
 
 func Register(name string, nilPtr any) error {
@@ -23,6 +39,10 @@ func Register(name string, nilPtr any) error {
 	if sample, ok := nilPtr.(interface{ SampleConfig() string }); ok {
 		sampleConfig = sample.SampleConfig()
 	}
+	description := ""
+	if desc, ok := nilPtr.(interface{ Description() string }); ok {
+		description = desc.Description()
+	}
 	if _, ok := nilPtr.(metric.Input); ok {
 		if !strings.HasPrefix(name, "input.") {
 			name = "input." + name
@@ -31,8 +51,12 @@ func Register(name string, nilPtr any) error {
 		if !strings.HasPrefix(name, "output.") {
 			name = "output." + name
 		}
+	} else if _, ok := nilPtr.(Processor); ok {
+		if !strings.HasPrefix(name, "processor.") {
+			name = "processor." + name
+		}
 	} else {
-		return fmt.Errorf("only Input or Output can be registered, got: %T", nilPtr)
+		return fmt.Errorf("only Input, Output or Processor can be registered, got: %T", nilPtr)
 	}
 	if _, exists := registry[name]; exists {
 		return fmt.Errorf("already registered name: %s", name)
@@ -40,36 +64,85 @@ func Register(name string, nilPtr any) error {
 	registry[name] = RegisterItem{
 		Type:         reflect.TypeOf(nilPtr).Elem(),
 		SampleConfig: sampleConfig,
+		Description:  description,
 	}
 	return nil
 }
 
-func GenerateSampleConfig(w io.Writer) {
+// Names returns the sorted names of the registered plugins,
+// e.g. "input.cpu", "output.ndjson" and "processor.rename".
+func Names() []string {
 	names := []string{}
 	for k := range registry {
 		names = append(names, k)
 	}
 	slices.Sort(names)
-	for _, k := range names {
+	return names
+}
+
+// Lookup returns the registered plugin of the name,
+// the name without the kind, e.g. "cpu", is looked up
+// in the order of input, output and processor.
+func Lookup(name string) (RegisterItem, bool) {
+	if item, ok := registry[name]; ok {
+		return item, true
+	}
+	for _, kind := range []string{"input.", "output.", "processor."} {
+		if item, ok := registry[kind+name]; ok {
+			return item, true
+		}
+	}
+	return RegisterItem{}, false
+}
+
+func GenerateSampleConfig(w io.Writer) {
+	for _, k := range Names() {
 		sample := registry[k].SampleConfig
 		fmt.Fprintln(w, sample)
 		fmt.Fprintln(w)
 	}
 }
 
-func LoadConfig(c *metric.Collector, content string) ([]string, []string, error) {
+// LoadOptions is the optional parts that LoadConfig connects to the collector.
+type LoadOptions struct {
+	// Stat records the inputs and the outputs if not nil.
+	Stat *SelfStat
+	// Tags records the tags of the metrics of the inputs,
+	// the outputs get the tags from it. If nil, the metrics have no tags.
+	Tags *Tags
+	// Processors are applied after the processors of the content.
+	Processors []Processor
+}
+
+// LoadConfig instantiates the inputs, outputs and processors of the content,
+// and adds them to the collector.
+func LoadConfig(c *metric.Collector, content string, opts LoadOptions) ([]string, []string, error) {
 	var inputs []string
 	var outputs []string
+	tags := opts.Tags
+	if tags == nil {
+		tags = NewTags(nil)
+	}
 
 	cfg := make(map[string]any)
 	processedNames := map[string][]string{
-		"input":  {},
-		"output": {},
+		"input":     {},
+		"output":    {},
+		"processor": {},
 	}
 	meta, err := toml.Decode(content, &cfg)
 	if err != nil {
 		return inputs, outputs, err
 	}
+	// processors are loaded first, since the inputs are wrapped by them
+	// regardless of the order of the sections.
+	processors, err := loadProcessors(cfg, meta)
+	if err != nil {
+		return inputs, outputs, err
+	}
+	for _, p := range opts.Processors {
+		processors = append(processors, &processorItem{processor: p})
+	}
 	for _, keys := range meta.Keys() {
 		if len(keys) != 2 {
 			continue
@@ -87,35 +160,45 @@ func LoadConfig(c *metric.Collector, content string) ([]string, []string, error)
 			processedNames[kind] = append(processedNames[kind], name)
 			sections := ((cfg[kind].(map[string]any))[name]).([]map[string]any)
 			for _, section := range sections {
-				v := reflect.New(reg.Type).Interface()
-				if b, err := toml.Marshal(section); err != nil {
-					return inputs, outputs, err
-				} else {
-					if _, err := toml.Decode(string(b), v); err != nil {
-						return inputs, outputs, err
+				var inOpts inputOptions
+				if kind == "input" {
+					if inOpts, section, err = splitInputOptions(reg, section); err != nil {
+						return inputs, outputs, fmt.Errorf("input %s: %w", name, err)
 					}
 				}
-				var filter metric.Filter
-				if x, ok := section["filter"].(map[string]any); ok {
-					includes, excludes := x["includes"], x["excludes"]
-					if f, err := compileFilter(includes, excludes); err != nil {
-						return inputs, outputs, err
-					} else {
-						filter = f
-					}
+				v, filter, _, err := decodeSection(reg, section)
+				if err != nil {
+					return inputs, outputs, err
 				}
 				if input, ok := v.(metric.Input); ok {
-					if filter != nil {
-						input = &metric.FilterInput{Filter: filter, Input: input}
+					input = wrapInput(input, filter, processors, tags.wrapSend(inOpts.Tags, c.Send))
+					input = tags.wrapInput(inOpts.Tags, input)
+					input = inOpts.withTimeout(input)
+					if opts.Stat != nil {
+						input = opts.Stat.wrapInput(name, input)
 					}
+					input = inOpts.withSchedule(input, c.SamplingInterval(), c.Send)
 					if err := c.AddInput(input); err != nil {
 						return inputs, outputs, fmt.Errorf("input %T error %v", input, err)
 					}
 					inputs = append(inputs, name)
 				} else if output, ok := v.(metric.Output); ok {
+					if tagged, ok := output.(Tagged); ok {
+						tagged.SetTags(tags.Lookup)
+					}
 					if filter != nil {
 						output = &metric.FilterOutput{Filter: filter, Output: output}
 					}
+					tf, err := sectionTagFilter(section)
+					if err != nil {
+						return inputs, outputs, fmt.Errorf("output %s filter %w", name, err)
+					}
+					if len(tf) > 0 {
+						output = &tagFilterOutput{outputWrapper: outputWrapper{output}, filter: tf, tags: tags}
+					}
+					if opts.Stat != nil {
+						output = opts.Stat.wrapOutput(name, output)
+					}
 					if err := c.AddOutput(output); err != nil {
 						return inputs, outputs, fmt.Errorf("output %T error %v", output, err)
 					}
@@ -129,6 +212,143 @@ func LoadConfig(c *metric.Collector, content string) ([]string, []string, error)
 	return inputs, outputs, nil
 }
 
+// decodeSection decodes the section into a new instance of the registered type,
+// and compiles the filter of the section if exists.
+// It returns also the keys of the section that the type does not have,
+// except the "filter" that is handled by the registry.
+func decodeSection(reg RegisterItem, section map[string]any) (any, metric.Filter, []toml.Key, error) {
+	v := reflect.New(reg.Type).Interface()
+	var undecoded []toml.Key
+	if b, err := toml.Marshal(section); err != nil {
+		return nil, nil, nil, err
+	} else {
+		meta, err := toml.Decode(string(b), v)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, key := range meta.Undecoded() {
+			if key[0] != "filter" {
+				undecoded = append(undecoded, key)
+			}
+		}
+	}
+	var filter metric.Filter
+	if x, ok := section["filter"].(map[string]any); ok {
+		includes, excludes := x["includes"], x["excludes"]
+		if f, err := compileFilter(includes, excludes); err != nil {
+			return nil, nil, nil, err
+		} else {
+			filter = f
+		}
+	}
+	return v, filter, undecoded, nil
+}
+
+// sectionTagFilter compiles the "tags" of the filter of the section if exists.
+func sectionTagFilter(section map[string]any) (tagFilter, error) {
+	filter, ok := section["filter"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	tbl, ok := filter["tags"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	return compileTagFilter(tbl)
+}
+
+// wrapInput applies the filter and the processors to the measurements
+// of the input, the pushed measurements are delivered to send.
+func wrapInput(input metric.Input, filter metric.Filter, processors []*processorItem, send func(...metric.Measure)) metric.Input {
+	if pusher, ok := input.(Pusher); ok {
+		pusher.SetPush(makePush(send, filter, processors))
+	}
+	if filter != nil {
+		input = &filteredInput{FilterInput: &metric.FilterInput{Filter: filter, Input: input}}
+	}
+	if len(processors) > 0 {
+		input = &processedInput{inputWrapper: inputWrapper{input}, processors: processors}
+	}
+	return input
+}
+
+// filteredInput is a metric.FilterInput that calls also
+// the DeInit of the input that returns an error.
+type filteredInput struct {
+	*metric.FilterInput
+}
+
+func (fi *filteredInput) DeInit() error {
+	return deinitInput(fi.Input)
+}
+
+// inputWrapper forwards Init and DeInit to the input it wraps,
+// the wrappers of the inputs embed it and override Gather.
+type inputWrapper struct {
+	metric.Input
+}
+
+func (w inputWrapper) Init() error {
+	return initInput(w.Input)
+}
+
+func (w inputWrapper) DeInit() error {
+	return deinitInput(w.Input)
+}
+
+// initInput calls the Init of the input if it has one.
+func initInput(input metric.Input) error {
+	if hasInit, ok := input.(interface{ Init() error }); ok {
+		return hasInit.Init()
+	}
+	return nil
+}
+
+// deinitInput calls the DeInit of the input if it has one,
+// the DeInit of an input may or may not return an error.
+func deinitInput(input metric.Input) error {
+	switch in := input.(type) {
+	case interface{ DeInit() error }:
+		return in.DeInit()
+	case interface{ DeInit() }:
+		in.DeInit()
+	}
+	return nil
+}
+
+// outputWrapper forwards Init and DeInit to the output it wraps,
+// the wrappers of the outputs embed it and override Process.
+type outputWrapper struct {
+	metric.Output
+}
+
+func (w outputWrapper) Init() error {
+	if hasInit, ok := w.Output.(interface{ Init() error }); ok {
+		return hasInit.Init()
+	}
+	return nil
+}
+
+func (w outputWrapper) DeInit() {
+	if hasDeInit, ok := w.Output.(interface{ DeInit() }); ok {
+		hasDeInit.DeInit()
+	}
+}
+
+func makePush(send func(...metric.Measure), filter metric.Filter, processors []*processorItem) func(...metric.Measure) {
+	return func(measures ...metric.Measure) {
+		if filter != nil {
+			measures = slices.DeleteFunc(measures, func(m metric.Measure) bool {
+				return !filter.Match(m.Name)
+			})
+		}
+		measures = applyProcessors(processors, measures)
+		if len(measures) > 0 {
+			send(measures...)
+		}
+	}
+}
+
 func compileFilter(includesAny any, excludesAny any) (metric.Filter, error) {
 	excludes, ok := excludesAny.([]any)
 	if !ok {
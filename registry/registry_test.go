@@ -1,7 +1,9 @@
 package registry
 
 import (
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/OutOfBedlam/metric"
 	"github.com/stretchr/testify/require"
@@ -15,8 +17,9 @@ func (c *CPUMock) Init() error {
 	return nil
 }
 
-func (c *CPUMock) Gather(g metric.Gather) {
+func (c *CPUMock) Gather(g *metric.Gather) error {
 	g.Add("cpu:"+c.Measure, 10, metric.MeterType(metric.UnitPercent))
+	return nil
 }
 
 type MEMMock struct {
@@ -27,8 +30,9 @@ func (m *MEMMock) Init() error {
 	return nil
 }
 
-func (m *MEMMock) Gather(g metric.Gather) {
+func (m *MEMMock) Gather(g *metric.Gather) error {
 	g.Add("mem:"+m.Measure, 20, metric.GaugeType(metric.UnitBytes))
+	return nil
 }
 
 func TestConfig(t *testing.T) {
@@ -51,18 +55,86 @@ func TestConfig(t *testing.T) {
 				[[input.mem]]
 					measure = "heap"
 				`,
-			expect: []string{"cpu:percent", "mem:stack", "mem:heap"},
+			expect: []string{"cpu:percent", "mem:heap", "mem:stack"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := metric.NewCollector()
-			if _, _, err := LoadConfig(c, tt.content); (err != nil) != tt.wantErr {
+			if _, _, err := LoadConfig(c, tt.content, LoadOptions{}); (err != nil) != tt.wantErr {
 				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
 			} else {
 				var inputNames = c.MetricNames()
+				slices.Sort(inputNames)
 				require.EqualValues(t, tt.expect, inputNames)
 			}
 		})
 	}
 }
+
+type ScaleMock struct {
+	Factor float64 `toml:"factor"`
+}
+
+func (s *ScaleMock) Apply(measures []metric.Measure) []metric.Measure {
+	for i := range measures {
+		measures[i].Value *= s.Factor
+	}
+	return measures
+}
+
+type PrefixMock struct {
+	Prefix string `toml:"prefix"`
+}
+
+func (p *PrefixMock) Apply(measures []metric.Measure) []metric.Measure {
+	for i := range measures {
+		measures[i].Name = p.Prefix + measures[i].Name
+	}
+	return measures
+}
+
+func TestProcessor(t *testing.T) {
+	Register("proc_cpu", (*CPUMock)(nil))
+	Register("proc_mem", (*MEMMock)(nil))
+	Register("scale_mock", (*ScaleMock)(nil))
+	Register("prefix_mock", (*PrefixMock)(nil))
+
+	content := `
+		[[input.proc_cpu]]
+			measure = "percent"
+		[[input.proc_mem]]
+			measure = "heap"
+		[[processor.prefix_mock]]
+			order = 2
+			prefix = "host1:"
+		[[processor.scale_mock]]
+			order = 1
+			factor = 10.0
+			[processor.scale_mock.filter]
+				includes = ["mem:*"]
+		`
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+	_, _, err = LoadConfig(c, content, LoadOptions{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"host1:cpu:percent", "host1:mem:heap"}, c.MetricNames())
+
+	_, v := c.Timeseries("host1:cpu:percent")[0].Last()
+	require.Equal(t, 10.0, v.(*metric.MeterValue).Last)
+	// the scale processor is applied before the prefix processor by the order
+	_, v = c.Timeseries("host1:mem:heap")[0].Last()
+	require.Equal(t, 200.0, v.(*metric.GaugeValue).Value)
+
+	_, _, err = LoadConfig(metric.NewCollector(), `[[processor.not_exists]]`, LoadOptions{})
+	require.Error(t, err)
+}
+
+func TestGatherNames(t *testing.T) {
+	g := &metric.Gather{}
+	require.Empty(t, gatherNames(g))
+	g.Add("a", 1, metric.GaugeType(metric.UnitShort))
+	g.Add("b", 2, metric.CounterType(metric.UnitShort))
+	require.Equal(t, []string{"a", "b"}, gatherNames(g))
+}
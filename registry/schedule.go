@@ -0,0 +1,222 @@
+package registry
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/metric"
+)
+
+// inputOptions is the keys that every [[input.*]] section can have,
+// the registry gathers the input at its own interval with the jitter,
+// cancels the gathering that takes longer than the timeout,
+// and adds the tags to the metrics of the input.
+type inputOptions struct {
+	Interval time.Duration     `toml:"interval"`
+	Timeout  time.Duration     `toml:"timeout"`
+	Jitter   time.Duration     `toml:"jitter"`
+	Tags     map[string]string `toml:"tags"`
+}
+
+var inputOptionKeys = []string{"interval", "timeout", "jitter", "tags"}
+
+// splitInputOptions takes the input options out of the section.
+// The keys that the type of the input has as its own,
+// e.g. "timeout" of modbus, are left for the input.
+func splitInputOptions(reg RegisterItem, section map[string]any) (inputOptions, map[string]any, error) {
+	var opts inputOptions
+	sub := map[string]any{}
+	for _, key := range inputOptionKeys {
+		if v, ok := section[key]; ok && !hasKey(reg.Type, key) {
+			sub[key] = v
+		}
+	}
+	if len(sub) == 0 {
+		return opts, section, nil
+	}
+	rest := make(map[string]any, len(section))
+	for k, v := range section {
+		if _, ok := sub[k]; !ok {
+			rest[k] = v
+		}
+	}
+	b, err := toml.Marshal(sub)
+	if err != nil {
+		return opts, nil, err
+	}
+	if _, err := toml.Decode(string(b), &opts); err != nil {
+		return opts, nil, err
+	}
+	return opts, rest, nil
+}
+
+// hasKey reports whether the struct type has the field of the toml key.
+func hasKey(t reflect.Type, key string) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			if hasKey(f.Type, key) {
+				return true
+			}
+			continue
+		}
+		if name == key || (name == "" && strings.EqualFold(f.Name, key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTimeout returns the input that cancels the gathering
+// that takes longer than the timeout, the input itself if there is no timeout.
+func (o inputOptions) withTimeout(input metric.Input) metric.Input {
+	if o.Timeout <= 0 {
+		return input
+	}
+	return &timeoutInput{inputWrapper: inputWrapper{input}, timeout: o.Timeout}
+}
+
+// withSchedule returns the input that is gathered at its own interval with the jitter,
+// the input itself if there is neither interval nor jitter.
+// The interval defaults to the sampling interval if only the jitter is set.
+// The measurements gathered at the interval are delivered to send.
+func (o inputOptions) withSchedule(input metric.Input, samplingInterval time.Duration, send func(...metric.Measure)) metric.Input {
+	if o.Interval <= 0 && o.Jitter <= 0 {
+		return input
+	}
+	interval := o.Interval
+	if interval <= 0 {
+		interval = samplingInterval
+	}
+	return &scheduledInput{inputWrapper: inputWrapper{input}, interval: interval, jitter: min(max(o.Jitter, 0), interval), send: send}
+}
+
+// timeoutInput cancels the gathering that takes longer than the timeout.
+// The cancelled gathering keeps running in the background,
+// the gatherings fail until it returns.
+type timeoutInput struct {
+	inputWrapper
+	timeout time.Duration
+	running atomic.Bool
+}
+
+func (ti *timeoutInput) Gather(g *metric.Gather) error {
+	if !ti.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("gather is still running after the timeout %s", ti.timeout)
+	}
+	result := &metric.Gather{}
+	done := make(chan error, 1)
+	go func() {
+		defer ti.running.Store(false)
+		done <- ti.Input.Gather(result)
+	}()
+	select {
+	case err := <-done:
+		for _, m := range result.Measures() {
+			g.Add(m.Name, m.Value, m.Type)
+		}
+		return err
+	case <-time.After(ti.timeout):
+		return fmt.Errorf("gather timeout %s", ti.timeout)
+	}
+}
+
+// scheduledInput gathers the input at its own interval
+// instead of the sampling interval of the collector.
+type scheduledInput struct {
+	inputWrapper
+	interval time.Duration
+	jitter   time.Duration
+	send     func(...metric.Measure)
+
+	// mu guards the state, Gather of the collector runs concurrently
+	// and DeInit is called from the Stop of the collector.
+	mu       sync.Mutex
+	started  bool
+	deinited bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// DeInit stops gathering at the interval, the calls after the first do nothing.
+func (si *scheduledInput) DeInit() error {
+	si.mu.Lock()
+	if si.deinited {
+		si.mu.Unlock()
+		return nil
+	}
+	si.deinited = true
+	started := si.started
+	si.mu.Unlock()
+	if started {
+		close(si.stop)
+		<-si.done
+	}
+	return si.inputWrapper.DeInit()
+}
+
+// Gather gathers the input at the first call, that is when the input
+// is added to the collector, and starts gathering at the interval.
+// The other calls at the sampling interval of the collector,
+// and the calls after DeInit do nothing.
+func (si *scheduledInput) Gather(g *metric.Gather) error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if si.started || si.deinited {
+		return nil
+	}
+	if err := si.Input.Gather(g); err != nil {
+		return err
+	}
+	si.started = true
+	si.stop = make(chan struct{})
+	si.done = make(chan struct{})
+	go si.run()
+	return nil
+}
+
+func (si *scheduledInput) run() {
+	defer close(si.done)
+	ticker := time.NewTicker(si.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-si.stop:
+			return
+		case <-ticker.C:
+		}
+		if si.jitter > 0 {
+			select {
+			case <-si.stop:
+				return
+			case <-time.After(rand.N(si.jitter)):
+			}
+		}
+		g := &metric.Gather{}
+		if err := si.Input.Gather(g); err != nil {
+			slog.Error("Error gathering metrics", "error", err)
+			continue
+		}
+		if measures := slices.Clone(g.Measures()); len(measures) > 0 {
+			si.send(measures...)
+		}
+	}
+}
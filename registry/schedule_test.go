@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+type CountMock struct {
+	Delay time.Duration `toml:"delay"`
+	count atomic.Int64
+}
+
+func (c *CountMock) Gather(g *metric.Gather) error {
+	time.Sleep(c.Delay)
+	g.Add("count:value", float64(c.count.Add(1)), metric.GaugeType(metric.UnitShort))
+	return nil
+}
+
+func TestSplitInputOptions(t *testing.T) {
+	Register("split_count", (*CountMock)(nil))
+	Register("split_duration", (*DurationMock)(nil))
+
+	section := map[string]any{"delay": "1s", "interval": "5s", "timeout": "2s", "jitter": "100ms"}
+	opts, rest, err := splitInputOptions(registry["input.split_count"], section)
+	require.NoError(t, err)
+	require.Equal(t, inputOptions{Interval: 5 * time.Second, Timeout: 2 * time.Second, Jitter: 100 * time.Millisecond}, opts)
+	require.Equal(t, map[string]any{"delay": "1s"}, rest)
+
+	// the input has its own interval
+	opts, rest, err = splitInputOptions(registry["input.split_duration"], section)
+	require.NoError(t, err)
+	require.Equal(t, inputOptions{Timeout: 2 * time.Second, Jitter: 100 * time.Millisecond}, opts)
+	require.Equal(t, map[string]any{"delay": "1s", "interval": "5s"}, rest)
+
+	_, _, err = splitInputOptions(registry["input.split_count"], map[string]any{"timeout": "soon"})
+	require.Error(t, err)
+}
+
+type SlowMock struct {
+	release chan struct{}
+}
+
+func (s *SlowMock) Gather(g *metric.Gather) error {
+	<-s.release
+	g.Add("slow:value", 1, metric.GaugeType(metric.UnitShort))
+	return nil
+}
+
+func TestTimeoutInput(t *testing.T) {
+	mock := &SlowMock{release: make(chan struct{})}
+	input := inputOptions{Timeout: 50 * time.Millisecond}.withTimeout(mock)
+	g := &metric.Gather{}
+	require.ErrorContains(t, input.Gather(g), "gather timeout 50ms")
+	require.Empty(t, g.Measures())
+	// the cancelled gathering is still running
+	require.ErrorContains(t, input.Gather(g), "still running")
+	close(mock.release)
+	require.Eventually(t, func() bool { return input.Gather(g) == nil }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "slow:value", g.Measures()[0].Name)
+}
+
+func TestScheduledInput(t *testing.T) {
+	Register("schedule_count", (*CountMock)(nil))
+
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()), metric.WithSamplingInterval(time.Hour))
+	_, _, err = LoadConfig(c, `
+		[[input.schedule_count]]
+			interval = "20ms"
+			jitter = "5ms"
+			timeout = "1s"
+		`, LoadOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, v := c.Timeseries("count:value")[0].Last()
+		return v.(*metric.GaugeValue).Samples >= 4
+	}, 2*time.Second, 10*time.Millisecond)
+	c.Stop()
+}
+
+func TestScheduledInputDeInit(t *testing.T) {
+	mock := &CountMock{}
+	input := inputOptions{Interval: time.Millisecond}.withSchedule(mock, time.Hour, func(...metric.Measure) {})
+	si := input.(*scheduledInput)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, input.Gather(&metric.Gather{}))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(1), mock.count.Load(), "gathered once, then at the interval")
+	require.Eventually(t, func() bool { return mock.count.Load() > 2 }, time.Second, time.Millisecond)
+
+	// DeInit concurrently with Gather, and more than once
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		require.NoError(t, si.DeInit())
+	}()
+	go func() {
+		defer wg.Done()
+		require.NoError(t, input.Gather(&metric.Gather{}))
+	}()
+	wg.Wait()
+	require.NoError(t, si.DeInit())
+	count := mock.count.Load()
+	require.NoError(t, input.Gather(&metric.Gather{}))
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, count, mock.count.Load(), "no gathering after DeInit")
+}
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+)
+
+// SelfStatPrefix is the prefix of the names of the measurements
+// that the collector reports about itself.
+const SelfStatPrefix = "metrical:"
+
+var selfLatencyType = metric.HistogramType(metric.UnitDuration)
+var selfCounterType = metric.CounterType(metric.UnitShort)
+var selfTimestampType = metric.GaugeType(metric.UnitShort)
+
+// SelfStat records the health of the collector itself,
+//
+//	metrical:input:<input>:gather_latency     histogram of the durations of Gather
+//	metrical:input:<input>:gather_errors      counter of the errors of Gather
+//	metrical:input:<input>:last_success       unix time of the last successful Gather
+//	metrical:output:<output>:process_latency  histogram of the durations of Process
+//	metrical:output:<output>:process_errors   counter of the errors of Process
+//	metrical:input_buffer:full                counter of the measurements that waited
+//	                                          because the input buffer was full
+//
+// The second instance of the same input or output is named with
+// the index, e.g. "cpu", "cpu_2", "cpu_3".
+// SelfStat is an input that reports the recorded measurements
+// at every sampling interval.
+type SelfStat struct {
+	ch chan<- *metric.Gather
+
+	mu       sync.Mutex
+	measures []metric.Measure
+	full     int
+	counts   map[string]int
+}
+
+var _ metric.Input = (*SelfStat)(nil)
+
+// NewSelfStat returns a SelfStat that sends to ch, the input buffer of the collector.
+func NewSelfStat(ch chan<- *metric.Gather) *SelfStat {
+	return &SelfStat{ch: ch, counts: map[string]int{}}
+}
+
+// Send sends the gathered measurements to the input buffer,
+// the measurements are counted if the buffer is full and Send waits for it.
+func (s *SelfStat) Send(g *metric.Gather) {
+	select {
+	case s.ch <- g:
+		return
+	default:
+	}
+	s.mu.Lock()
+	s.full += len(gatherNames(g))
+	s.mu.Unlock()
+	s.ch <- g
+}
+
+func (s *SelfStat) Gather(g *metric.Gather) error {
+	s.mu.Lock()
+	measures, full := s.measures, s.full
+	s.measures, s.full = nil, 0
+	s.mu.Unlock()
+	for _, m := range measures {
+		g.Add(m.Name, m.Value, m.Type)
+	}
+	g.Add(SelfStatPrefix+"input_buffer:full", float64(full), selfCounterType)
+	return nil
+}
+
+func (s *SelfStat) add(measures ...metric.Measure) {
+	s.mu.Lock()
+	s.measures = append(s.measures, measures...)
+	s.mu.Unlock()
+}
+
+// instanceName returns the name of the next instance of the kind and the name.
+func (s *SelfStat) instanceName(kind, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[kind+"."+name]++
+	if n := s.counts[kind+"."+name]; n > 1 {
+		return fmt.Sprintf("%s_%d", name, n)
+	}
+	return name
+}
+
+// wrapInput returns the input that records the gathering of the input.
+func (s *SelfStat) wrapInput(name string, input metric.Input) metric.Input {
+	prefix := SelfStatPrefix + "input:" + s.instanceName("input", name) + ":"
+	return &statInput{inputWrapper: inputWrapper{input}, stat: s, prefix: prefix}
+}
+
+// wrapOutput returns the output that records the processing of the output.
+func (s *SelfStat) wrapOutput(name string, output metric.Output) metric.Output {
+	prefix := SelfStatPrefix + "output:" + s.instanceName("output", name) + ":"
+	return &statOutput{outputWrapper: outputWrapper{output}, stat: s, prefix: prefix}
+}
+
+type statInput struct {
+	inputWrapper
+	stat        *SelfStat
+	prefix      string
+	lastSuccess time.Time
+}
+
+func (si *statInput) Gather(g *metric.Gather) error {
+	tick := time.Now()
+	err := si.Input.Gather(g)
+	measures := []metric.Measure{
+		{Name: si.prefix + "gather_latency", Value: float64(time.Since(tick).Nanoseconds()), Type: selfLatencyType},
+	}
+	if err != nil {
+		measures = append(measures, metric.Measure{Name: si.prefix + "gather_errors", Value: 1, Type: selfCounterType})
+	} else {
+		measures = append(measures, metric.Measure{Name: si.prefix + "gather_errors", Value: 0, Type: selfCounterType})
+		si.lastSuccess = tick
+	}
+	if !si.lastSuccess.IsZero() {
+		measures = append(measures, metric.Measure{Name: si.prefix + "last_success", Value: float64(si.lastSuccess.Unix()), Type: selfTimestampType})
+	}
+	si.stat.add(measures...)
+	return err
+}
+
+type statOutput struct {
+	outputWrapper
+	stat   *SelfStat
+	prefix string
+}
+
+func (so *statOutput) Process(pd metric.Product) error {
+	tick := time.Now()
+	err := so.Output.Process(pd)
+	errors := 0.0
+	if err != nil {
+		errors = 1
+	}
+	so.stat.add(
+		metric.Measure{Name: so.prefix + "process_latency", Value: float64(time.Since(tick).Nanoseconds()), Type: selfLatencyType},
+		metric.Measure{Name: so.prefix + "process_errors", Value: errors, Type: selfCounterType},
+	)
+	return err
+}
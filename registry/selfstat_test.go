@@ -0,0 +1,131 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+type FailMock struct {
+	fail bool
+}
+
+func (f *FailMock) Gather(g *metric.Gather) error {
+	if f.fail {
+		return errors.New("failed")
+	}
+	g.Add("fail:value", 1, metric.GaugeType(metric.UnitShort))
+	return nil
+}
+
+type OutputMock struct {
+	Fail bool `toml:"fail"`
+}
+
+func (o *OutputMock) Process(pd metric.Product) error {
+	if o.Fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestSelfStat(t *testing.T) {
+	Register("stat_cpu", (*CPUMock)(nil))
+	Register("stat_output", (*OutputMock)(nil))
+
+	seriesID, err := metric.NewSeriesID("TS_1H", "1 hour", time.Hour, 2)
+	require.NoError(t, err)
+	c := metric.NewCollector(metric.WithSeries(seriesID), metric.WithPrefix(t.Name()))
+	stat := NewSelfStat(c.C)
+	content := `
+		[[input.stat_cpu]]
+			measure = "percent"
+		[[input.stat_cpu]]
+			measure = "idle"
+		[[output.stat_output]]
+		[[output.stat_output]]
+			fail = true
+		`
+	_, _, err = LoadConfig(c, content, LoadOptions{Stat: stat})
+	require.NoError(t, err)
+
+	g := &metric.Gather{}
+	require.NoError(t, stat.Gather(g))
+	var names []string
+	for _, m := range g.Measures() {
+		names = append(names, m.Name)
+	}
+	require.Equal(t, []string{
+		"metrical:input:stat_cpu:gather_latency",
+		"metrical:input:stat_cpu:gather_errors",
+		"metrical:input:stat_cpu:last_success",
+		"metrical:input:stat_cpu_2:gather_latency",
+		"metrical:input:stat_cpu_2:gather_errors",
+		"metrical:input:stat_cpu_2:last_success",
+		"metrical:input_buffer:full",
+	}, names)
+
+	// errors of the input
+	fail := &FailMock{fail: true}
+	in := stat.wrapInput("fail", fail)
+	require.Error(t, in.Gather(&metric.Gather{}))
+	fail.fail = false
+	require.NoError(t, in.Gather(&metric.Gather{}))
+	g = &metric.Gather{}
+	require.NoError(t, stat.Gather(g))
+	var result []string
+	for _, m := range g.Measures() {
+		if m.Name != "metrical:input:fail:gather_latency" {
+			result = append(result, m.Name+" "+m.Type.Name())
+		}
+	}
+	require.Equal(t, []string{
+		"metrical:input:fail:gather_errors counter",
+		"metrical:input:fail:gather_errors counter",
+		"metrical:input:fail:last_success gauge",
+		"metrical:input_buffer:full counter",
+	}, result)
+	require.Equal(t, 1.0, g.Measures()[1].Value)
+
+	// errors of the outputs
+	out := stat.wrapOutput("out", &OutputMock{Fail: true})
+	require.Error(t, out.Process(metric.Product{Name: "x"}))
+	g = &metric.Gather{}
+	require.NoError(t, stat.Gather(g))
+	ms := g.Measures()
+	require.Equal(t, "metrical:output:out:process_latency", ms[0].Name)
+	require.Equal(t, "metrical:output:out:process_errors", ms[1].Name)
+	require.Equal(t, 1.0, ms[1].Value)
+
+	// waits of the full input buffer, nothing is dropped
+	ch := make(chan *metric.Gather, 1)
+	stat = NewSelfStat(ch)
+	send := func() {
+		g := &metric.Gather{}
+		g.Add("http:requests", 1, metric.CounterType(metric.UnitShort))
+		g.Add("http:latency", 1, metric.CounterType(metric.UnitShort))
+		stat.Send(g)
+	}
+	send()
+	sent := make(chan struct{})
+	go func() {
+		send()
+		close(sent)
+	}()
+	require.Eventually(t, func() bool {
+		stat.mu.Lock()
+		defer stat.mu.Unlock()
+		return stat.full == 2
+	}, time.Second, time.Millisecond)
+	<-ch
+	<-sent
+	require.Len(t, ch, 1)
+	g = &metric.Gather{}
+	require.NoError(t, stat.Gather(g))
+	ms = g.Measures()
+	require.Len(t, ms, 1)
+	require.Equal(t, 2.0, ms[0].Value)
+}
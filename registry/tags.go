@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/OutOfBedlam/metric"
+)
+
+// Tagged is implemented by the outputs that write the tags of the products.
+// LoadConfig calls SetTags with a function that returns the tags of a metric.
+type Tagged interface {
+	SetTags(tags func(name string) map[string]string)
+}
+
+// Tags is the tags of the metrics, the global tags of [data.tags]
+// merged with the "tags" of the input that gathers the metric.
+// The metrics that no input with tags has gathered have the global tags.
+type Tags struct {
+	mu     sync.RWMutex
+	global map[string]string
+	names  map[string]map[string]string
+}
+
+// NewTags returns the Tags with the global tags.
+func NewTags(global map[string]string) *Tags {
+	return &Tags{global: global, names: map[string]map[string]string{}}
+}
+
+// Lookup returns the tags of the metric, nil if it has no tags.
+// The returned map should not be modified.
+func (t *Tags) Lookup(name string) map[string]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if tags, ok := t.names[name]; ok {
+		return tags
+	}
+	return t.global
+}
+
+// merge returns the global tags overridden by the tags.
+func (t *Tags) merge(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return t.global
+	}
+	ret := maps.Clone(t.global)
+	if ret == nil {
+		ret = map[string]string{}
+	}
+	maps.Copy(ret, tags)
+	return ret
+}
+
+// Record records the tags of the measurements that no input gathers,
+// e.g. the measurements ingested from the other hosts,
+// the global tags are overridden by the tags.
+func (t *Tags) Record(tags map[string]string, measures ...metric.Measure) {
+	t.record(t.merge(tags), measures)
+}
+
+func (t *Tags) record(tags map[string]string, measures []metric.Measure) {
+	names := make([]string, len(measures))
+	for i, m := range measures {
+		names[i] = m.Name
+	}
+	t.recordNames(tags, names)
+}
+
+func (t *Tags) recordNames(tags map[string]string, names []string) {
+	t.mu.RLock()
+	missing := slices.ContainsFunc(names, func(name string) bool {
+		_, ok := t.names[name]
+		return !ok
+	})
+	t.mu.RUnlock()
+	if !missing {
+		return
+	}
+	t.mu.Lock()
+	for _, name := range names {
+		t.names[name] = tags
+	}
+	t.mu.Unlock()
+}
+
+// wrapInput returns the input that records the tags of its measurements,
+// the input itself if it has no tags.
+func (t *Tags) wrapInput(tags map[string]string, input metric.Input) metric.Input {
+	if len(tags) == 0 {
+		return input
+	}
+	return &taggedInput{inputWrapper: inputWrapper{input}, tags: t.merge(tags), index: t}
+}
+
+// wrapSend returns the send that records the tags of the pushed measurements.
+func (t *Tags) wrapSend(tags map[string]string, send func(...metric.Measure)) func(...metric.Measure) {
+	if len(tags) == 0 {
+		return send
+	}
+	tags = t.merge(tags)
+	return func(measures ...metric.Measure) {
+		t.record(tags, measures)
+		send(measures...)
+	}
+}
+
+type taggedInput struct {
+	inputWrapper
+	tags  map[string]string
+	index *Tags
+}
+
+func (ti *taggedInput) Gather(g *metric.Gather) error {
+	err := ti.Input.Gather(g)
+	ti.index.recordNames(ti.tags, gatherNames(g))
+	return err
+}
+
+// tagFilter matches the tags with the patterns of each tag,
+// e.g. {"host": ["web*"], "site": ["plant-a"]}.
+// A metric matches if every tag of the filter matches one of its patterns.
+type tagFilter map[string]metric.Filter
+
+// compileTagFilter compiles the "tags" table of a filter section,
+// the value of a tag is a pattern or an array of patterns.
+func compileTagFilter(tbl map[string]any) (tagFilter, error) {
+	ret := tagFilter{}
+	for k, v := range tbl {
+		var patterns []string
+		switch x := v.(type) {
+		case string:
+			patterns = []string{x}
+		case []any:
+			for _, p := range x {
+				s, ok := p.(string)
+				if !ok {
+					return nil, fmt.Errorf("tags.%s should be a string or an array of strings", k)
+				}
+				patterns = append(patterns, s)
+			}
+		default:
+			return nil, fmt.Errorf("tags.%s should be a string or an array of strings", k)
+		}
+		f, err := metric.Compile(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("tags.%s: %w", k, err)
+		}
+		ret[k] = f
+	}
+	return ret, nil
+}
+
+func (tf tagFilter) Match(tags map[string]string) bool {
+	for k, f := range tf {
+		v, ok := tags[k]
+		if !ok || !f.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagFilterOutput passes only the products of the metrics whose tags match the filter.
+type tagFilterOutput struct {
+	outputWrapper
+	filter tagFilter
+	tags   *Tags
+}
+
+func (to *tagFilterOutput) Process(pd metric.Product) error {
+	if !to.filter.Match(to.tags.Lookup(pd.Name)) {
+		return nil
+	}
+	return to.Output.Process(pd)
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+type TaggedOutputMock struct {
+	tags     func(name string) map[string]string
+	products []string
+}
+
+func (o *TaggedOutputMock) SetTags(tags func(name string) map[string]string) {
+	o.tags = tags
+}
+
+func (o *TaggedOutputMock) Process(pd metric.Product) error {
+	o.products = append(o.products, pd.Name)
+	return nil
+}
+
+func TestTags(t *testing.T) {
+	Register("tags_cpu", (*CPUMock)(nil))
+	Register("tags_mem", (*MEMMock)(nil))
+	Register("tags_output", (*TaggedOutputMock)(nil))
+
+	tags := NewTags(map[string]string{"host": "web1", "site": "plant-a"})
+	c := metric.NewCollector(metric.WithPrefix(t.Name()))
+	_, _, err := LoadConfig(c, `
+		[[input.tags_cpu]]
+			measure = "percent"
+			[input.tags_cpu.tags]
+				site = "plant-b"
+				rack = "r1"
+		[[input.tags_mem]]
+			measure = "used"
+		[[output.tags_output]]
+			[output.tags_output.filter.tags]
+				site = ["plant-b", "plant-c"]
+		`, LoadOptions{Tags: tags})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{"host": "web1", "site": "plant-b", "rack": "r1"}, tags.Lookup("cpu:percent"))
+	require.Equal(t, map[string]string{"host": "web1", "site": "plant-a"}, tags.Lookup("mem:used"))
+	require.Equal(t, map[string]string{"host": "web1", "site": "plant-a"}, tags.Lookup("derived:value"))
+
+	filter, err := compileTagFilter(map[string]any{"site": []any{"plant-b", "plant-c"}, "host": "web*"})
+	require.NoError(t, err)
+	mock := &TaggedOutputMock{}
+	out := &tagFilterOutput{outputWrapper: outputWrapper{mock}, filter: filter, tags: tags}
+	require.NoError(t, out.Process(metric.Product{Name: "cpu:percent"}))
+	require.NoError(t, out.Process(metric.Product{Name: "mem:used"}))
+	require.Equal(t, []string{"cpu:percent"}, mock.products)
+
+	_, err = compileTagFilter(map[string]any{"site": 1})
+	require.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OutOfBedlam/metric"
+)
+
+// ParseUnit returns the unit of the name,
+// "short", "scalar", "percent", "bytes" or "duration".
+func ParseUnit(name string) (metric.Unit, error) {
+	switch strings.ToLower(name) {
+	case "short":
+		return metric.UnitShort, nil
+	case "scalar":
+		return metric.UnitScalar, nil
+	case "percent":
+		return metric.UnitPercent, nil
+	case "bytes":
+		return metric.UnitBytes, nil
+	case "duration":
+		return metric.UnitDuration, nil
+	default:
+		return "", fmt.Errorf("unknown unit %q", name)
+	}
+}
+
+// ParseType returns the metric type of the name with the unit,
+// "gauge", "meter", "counter", "odometer", "histogram" or "timer".
+func ParseType(name string, unit metric.Unit) (metric.Type, error) {
+	switch strings.ToLower(name) {
+	case "gauge":
+		return metric.GaugeType(unit), nil
+	case "meter":
+		return metric.MeterType(unit), nil
+	case "counter":
+		return metric.CounterType(unit), nil
+	case "odometer":
+		return metric.OdometerType(unit), nil
+	case "histogram":
+		return metric.HistogramType(unit), nil
+	case "timer":
+		return metric.TimerType(), nil
+	default:
+		return metric.Type{}, fmt.Errorf("unknown type %q", name)
+	}
+}
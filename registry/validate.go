@@ -0,0 +1,190 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// CheckConfig validates the input, output and processor sections of the config
+// without instantiating them. It reports the unknown plugin types and keys,
+// the values of the wrong types, the negative durations and the invalid filters
+// with the positions of the files.
+func CheckConfig(cfg *Config) error {
+	tbl := map[string]any{}
+	meta, err := toml.Decode(cfg.Content, &tbl)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	report := func(key []string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", cfg.Position(key...), fmt.Sprintf(format, args...)))
+	}
+	checked := map[string]bool{}
+	for _, keys := range meta.Keys() {
+		if len(keys) != 2 {
+			continue
+		}
+		kind, name := keys[0], keys[1]
+		if kind != "input" && kind != "output" && kind != "processor" {
+			continue
+		}
+		if checked[kind+"."+name] {
+			continue
+		}
+		checked[kind+"."+name] = true
+		reg, ok := registry[kind+"."+name]
+		if !ok {
+			report(keys, "unknown %s type %q", kind, name)
+			continue
+		}
+		sections, ok := ((tbl[kind].(map[string]any))[name]).([]map[string]any)
+		if !ok {
+			report(keys, "%s %s should be an array of tables [[%s.%s]]", kind, name, kind, name)
+			continue
+		}
+		for i, section := range sections {
+			base := []string{kind, name, strconv.Itoa(i)}
+			if f, ok := section["filter"]; ok {
+				for _, msg := range checkFilter(kind, f) {
+					report(append(base, "filter"), "[[%s.%s]] filter %s", kind, name, msg)
+				}
+			}
+			if kind == "input" {
+				opts, rest, err := splitInputOptions(reg, section)
+				if err != nil {
+					reportDecodeError(report, base, kind, name, err)
+					continue
+				}
+				for _, key := range negativeDurations(reflect.ValueOf(opts), nil) {
+					report(append(base, key...), "[[%s.%s]] %s should not be negative", kind, name, strings.Join(key, "."))
+				}
+				section = rest
+			}
+			v, _, undecoded, err := decodeSection(reg, section)
+			if err != nil {
+				reportDecodeError(report, base, kind, name, err)
+				continue
+			}
+			for _, key := range undecoded {
+				if kind == "processor" && key.String() == "order" {
+					continue
+				}
+				report(append(base, key...), "unknown key %q in [[%s.%s]]", key.String(), kind, name)
+			}
+			for _, key := range negativeDurations(reflect.ValueOf(v), nil) {
+				report(append(base, key...), "[[%s.%s]] %s should not be negative", kind, name, strings.Join(key, "."))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reportDecodeError reports the decoding error at the position of the key of the error.
+func reportDecodeError(report func([]string, string, ...any), base []string, kind, name string, err error) {
+	if m := decodeErrorRegexp.FindStringSubmatch(err.Error()); m != nil {
+		report(append(base, splitKey(m[1])...), "[[%s.%s]] %s: %s", kind, name, m[1], m[2])
+	} else {
+		report(base, "[[%s.%s]] %v", kind, name, err)
+	}
+}
+
+// decodeErrorRegexp matches the decoding errors of the toml package,
+// e.g. `toml: line 1 (last key "percpu"): incompatible types: ...`
+var decodeErrorRegexp = regexp.MustCompile(`^toml: (?:line \d+ )?\(last key "(.*?)"\): (.*)$`)
+
+// checkFilter returns the problems of the filter table,
+// that should have only "includes" and "excludes" arrays of strings,
+// and the "tags" table if it is the filter of an output.
+func checkFilter(kind string, filter any) []string {
+	tbl, ok := filter.(map[string]any)
+	if !ok {
+		return []string{"should be a table"}
+	}
+	var ret []string
+	for _, k := range slices.Sorted(maps.Keys(tbl)) {
+		if k == "tags" && kind == "output" {
+			tags, ok := tbl[k].(map[string]any)
+			if !ok {
+				ret = append(ret, "tags should be a table")
+			} else if _, err := compileTagFilter(tags); err != nil {
+				ret = append(ret, err.Error())
+			}
+			continue
+		}
+		if k != "includes" && k != "excludes" {
+			if kind == "output" {
+				ret = append(ret, fmt.Sprintf("has unknown key %q, only includes, excludes and tags are allowed", k))
+			} else {
+				ret = append(ret, fmt.Sprintf("has unknown key %q, only includes and excludes are allowed", k))
+			}
+			continue
+		}
+		list, ok := tbl[k].([]any)
+		if !ok {
+			ret = append(ret, fmt.Sprintf("%s should be an array of strings", k))
+			continue
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				ret = append(ret, fmt.Sprintf("%s should be an array of strings, got %v", k, item))
+				break
+			}
+		}
+	}
+	return ret
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// negativeDurations returns the keys of the negative duration fields.
+func negativeDurations(v reflect.Value, key []string) [][]string {
+	var ret [][]string
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+			if name == "-" {
+				continue
+			}
+			if f.Anonymous && name == "" {
+				ret = append(ret, negativeDurations(v.Field(i), key)...)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			fv := v.Field(i)
+			if f.Type == durationType {
+				if fv.Int() < 0 {
+					ret = append(ret, append(append([]string{}, key...), name))
+				}
+				continue
+			}
+			ret = append(ret, negativeDurations(fv, append(append([]string{}, key...), name))...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			ret = append(ret, negativeDurations(v.Index(i), append(append([]string{}, key...), strconv.Itoa(i)))...)
+		}
+	}
+	return ret
+}
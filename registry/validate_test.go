@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+type DurationMock struct {
+	Interval time.Duration `toml:"interval"`
+	Percpu   bool          `toml:"percpu"`
+}
+
+func (d *DurationMock) Gather(g *metric.Gather) error {
+	return nil
+}
+
+func TestCheckConfig(t *testing.T) {
+	Register("check_mock", (*DurationMock)(nil))
+	Register("check_scale", (*ScaleMock)(nil))
+
+	content := `[[input.check_mock]]
+  interval = "10s"
+  percpu = true
+  [input.check_mock.filter]
+    includes = ["cpu:*"]
+
+[[input.check_mock]]
+  interval = "-1s"
+  per_cpu = true
+
+[[input.check_mock]]
+  percpu = "yes"
+
+[[input.check_mock]]
+  [input.check_mock.filter]
+    include = ["cpu:*"]
+    excludes = [1]
+
+[[input.check_unknown]]
+
+[[processor.check_scale]]
+  order = 1
+  factor = 2
+`
+	cfg, err := ReadConfig("test.toml", content, "")
+	require.NoError(t, err)
+	err = CheckConfig(cfg)
+	require.Error(t, err)
+	lines := strings.Split(err.Error(), "\n")
+	require.Equal(t, []string{
+		`test.toml:9: unknown key "per_cpu" in [[input.check_mock]]`,
+		`test.toml:8: [[input.check_mock]] interval should not be negative`,
+		`test.toml:12: [[input.check_mock]] percpu: incompatible types: TOML value has type string; destination has type boolean`,
+		`test.toml:15: [[input.check_mock]] filter excludes should be an array of strings, got 1`,
+		`test.toml:15: [[input.check_mock]] filter has unknown key "include", only includes and excludes are allowed`,
+		`test.toml:19: unknown input type "check_unknown"`,
+	}, lines)
+
+	cfg, err = ReadConfig("test.toml", "[[input.check_mock]]\n  interval = \"1s\"\n", "")
+	require.NoError(t, err)
+	require.NoError(t, CheckConfig(cfg))
+
+	// interval, timeout and jitter of the registry
+	cfg, err = ReadConfig("test.toml", "[[input.check_mock]]\n  timeout = \"-1s\"\n  jitter = \"1s\"\n[[input.check_mock]]\n  timeout = \"soon\"\n", "")
+	require.NoError(t, err)
+	err = CheckConfig(cfg)
+	require.Error(t, err)
+	require.Equal(t, []string{
+		`test.toml:2: [[input.check_mock]] timeout should not be negative`,
+		`test.toml:5: [[input.check_mock]] timeout: invalid duration: "soon"`,
+	}, strings.Split(err.Error(), "\n"))
+}
@@ -0,0 +1,460 @@
+// Package sshterm is the terminal runner of the SSH sessions of [[http.ssh]],
+// it connects to the target through the jump hosts, verifying the host key
+// of every hop by the known_hosts file or the pinned fingerprints, and
+// authenticates with the passwords, the key files and the SSH agent.
+package sshterm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/OutOfBedlam/webterm"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// The modes of the host key verification.
+const (
+	// HostKeyStrict rejects the hosts that are not in known_hosts or host_key.
+	HostKeyStrict = "strict"
+	// HostKeyAcceptNew adds the keys of the unknown hosts to known_hosts,
+	// and rejects the hosts whose keys changed.
+	HostKeyAcceptNew = "accept-new"
+	// HostKeyInsecure accepts any host key.
+	HostKeyInsecure = "insecure"
+)
+
+// Hop is a host of the connection, the jump hosts and the target.
+type Hop struct {
+	Host              string
+	Port              int
+	User              string
+	Password          string
+	Keyfile           string
+	KeyfilePassphrase string
+	HostKey           string // "SHA256:..." fingerprint or "<type> <base64 key>"
+}
+
+// Addr returns "host:port" of the hop, the port defaults to 22.
+func (h Hop) Addr() string {
+	return net.JoinHostPort(h.Host, strconv.Itoa(cmp.Or(h.Port, 22)))
+}
+
+// Options is the options of the connection.
+type Options struct {
+	KnownHosts   string // the known_hosts file
+	HostKeyCheck string // HostKeyStrict, HostKeyAcceptNew or HostKeyInsecure
+	Agent        bool   // authenticates with the keys of the agent of SSH_AUTH_SOCK
+	ForwardAgent bool   // forwards the agent to the target
+	TermType     string
+	Command      string // runs the command instead of the shell
+}
+
+var _ webterm.Runner = (*SSH)(nil)
+
+// SSH is the runner of the SSH sessions.
+type SSH struct {
+	opts Options
+	hops []hop
+
+	knownHostsMu sync.Mutex // serializes appending to known_hosts
+}
+
+type hop struct {
+	Hop
+	addr   string
+	signer ssh.Signer
+	fpr    string // the fingerprint of the pinned host key
+}
+
+// New returns the runner of the hops, the last is the target.
+// It reads the key files and the host keys, so that the errors
+// of the config are reported at the start instead of the connection.
+func New(hops []Hop, opts Options) (*SSH, error) {
+	if len(hops) == 0 {
+		return nil, errors.New("no host")
+	}
+	s := &SSH{opts: opts}
+	pinned := false
+	var errs []error
+	for i, h := range hops {
+		name := hopName(i, len(hops))
+		hp := hop{Hop: h, addr: h.Addr()}
+		if h.Host == "" {
+			errs = append(errs, fmt.Errorf("%s: host is required", name))
+		}
+		if h.Keyfile != "" {
+			signer, err := LoadKey(h.Keyfile, h.KeyfilePassphrase)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			hp.signer = signer
+		} else if h.KeyfilePassphrase != "" {
+			errs = append(errs, fmt.Errorf("%s: keyfile_passphrase requires keyfile", name))
+		}
+		if h.HostKey != "" {
+			fpr, err := ParseHostKey(h.HostKey)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: host_key: %w", name, err))
+			}
+			hp.fpr = fpr
+			pinned = true
+		}
+		if h.Password == "" && h.Keyfile == "" && !opts.Agent {
+			errs = append(errs, fmt.Errorf("%s: no authentication, set password, keyfile or agent", name))
+		}
+		s.hops = append(s.hops, hp)
+	}
+	switch s.opts.HostKeyCheck {
+	case "":
+		if s.opts.KnownHosts != "" || pinned {
+			s.opts.HostKeyCheck = HostKeyStrict
+		} else {
+			s.opts.HostKeyCheck = HostKeyInsecure
+		}
+	case HostKeyStrict, HostKeyAcceptNew, HostKeyInsecure:
+	default:
+		errs = append(errs, fmt.Errorf("invalid host_key_check %q, %s, %s or %s",
+			s.opts.HostKeyCheck, HostKeyStrict, HostKeyAcceptNew, HostKeyInsecure))
+	}
+	if s.opts.HostKeyCheck == HostKeyStrict && s.opts.KnownHosts == "" {
+		for i, h := range s.hops {
+			if h.fpr == "" && h.Host != "" {
+				errs = append(errs, fmt.Errorf("%s: host_key or known_hosts is required to verify the host key", hopName(i, len(hops))))
+			}
+		}
+	}
+	if s.opts.KnownHosts != "" {
+		if _, err := os.Stat(s.opts.KnownHosts); err != nil && (s.opts.HostKeyCheck != HostKeyAcceptNew || !errors.Is(err, os.ErrNotExist)) {
+			errs = append(errs, fmt.Errorf("known_hosts: %w", err))
+		}
+	} else if s.opts.HostKeyCheck == HostKeyAcceptNew {
+		errs = append(errs, errors.New("host_key_check accept-new requires known_hosts"))
+	}
+	if s.opts.Agent || s.opts.ForwardAgent {
+		conn, err := dialAgent()
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			conn.Close()
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hopName returns the name of the hop in the errors, "host" of the target or "via[i]".
+func hopName(i, n int) string {
+	if i < n-1 {
+		return fmt.Sprintf("via[%d]", i)
+	}
+	return "host"
+}
+
+// Insecure reports whether the host keys are not verified.
+func (s *SSH) Insecure() bool {
+	return s.opts.HostKeyCheck == HostKeyInsecure
+}
+
+// LoadKey returns the signer of the private key file,
+// the passphrase is required if the key is encrypted.
+func LoadKey(keyfile, passphrase string) (ssh.Signer, error) {
+	b, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, fmt.Errorf("keyfile: %w", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(b)
+	}
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("keyfile %s: encrypted, keyfile_passphrase is required", keyfile)
+	} else if err != nil {
+		return nil, fmt.Errorf("keyfile %s: %w", keyfile, err)
+	}
+	return signer, nil
+}
+
+// ParseHostKey returns the SHA256 fingerprint of the pinned host key,
+// that is the fingerprint as "ssh-keygen -lf" prints,
+// e.g. "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s",
+// or the public key as known_hosts has, e.g. "ssh-ed25519 AAAAC3Nza...".
+func ParseHostKey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "SHA256:") {
+		if len(s) != len("SHA256:")+43 {
+			return "", fmt.Errorf("invalid fingerprint %q", s)
+		}
+		return s, nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+	if err != nil {
+		return "", fmt.Errorf("neither SHA256 fingerprint nor public key: %w", err)
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
+
+func dialAgent() (net.Conn, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("agent: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+	return conn, nil
+}
+
+// hostKeyCallback verifies the host key of the hop,
+// by the pinned key first and then by known_hosts.
+func (s *SSH) hostKeyCallback(h hop) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if h.fpr != "" {
+			if fpr := ssh.FingerprintSHA256(key); fpr != h.fpr {
+				return fmt.Errorf("host key of %s mismatch, %s %s is not the pinned %s", hostname, key.Type(), fpr, h.fpr)
+			}
+			return nil
+		}
+		switch s.opts.HostKeyCheck {
+		case HostKeyInsecure:
+			return nil
+		case HostKeyStrict:
+			if s.opts.KnownHosts == "" {
+				return fmt.Errorf("host key of %s is not pinned", hostname)
+			}
+		}
+		s.knownHostsMu.Lock()
+		defer s.knownHostsMu.Unlock()
+		check, err := knownhosts.New(s.opts.KnownHosts)
+		if errors.Is(err, os.ErrNotExist) && s.opts.HostKeyCheck == HostKeyAcceptNew {
+			check = func(string, net.Addr, ssh.PublicKey) error { return &knownhosts.KeyError{} }
+		} else if err != nil {
+			return fmt.Errorf("known_hosts: %w", err)
+		}
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key of %s changed, %s %s is not of %s: %w",
+				hostname, key.Type(), ssh.FingerprintSHA256(key), s.opts.KnownHosts, err)
+		}
+		if s.opts.HostKeyCheck != HostKeyAcceptNew {
+			return fmt.Errorf("host key of %s is unknown, %s %s is not in %s",
+				hostname, key.Type(), ssh.FingerprintSHA256(key), s.opts.KnownHosts)
+		}
+		if err := appendKnownHost(s.opts.KnownHosts, hostname, key); err != nil {
+			return fmt.Errorf("known_hosts: %w", err)
+		}
+		slog.Warn("Added the host key to known_hosts", "host", hostname, "key", key.Type()+" "+ssh.FingerprintSHA256(key), "known_hosts", s.opts.KnownHosts)
+		return nil
+	}
+}
+
+func appendKnownHost(filename, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Connect connects to the target through the jump hosts.
+// The agent is of the authentication and the forwarding, it is nil if not configured.
+// The agent connection should be closed after the client.
+func (s *SSH) Connect() (*ssh.Client, agent.ExtendedAgent, net.Conn, error) {
+	var agentClient agent.ExtendedAgent
+	var agentConn net.Conn
+	if s.opts.Agent || s.opts.ForwardAgent {
+		conn, err := dialAgent()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		agentClient, agentConn = agent.NewClient(conn), conn
+	}
+	var client *ssh.Client
+	for _, h := range s.hops {
+		auth := []ssh.AuthMethod{}
+		if h.signer != nil {
+			auth = append(auth, ssh.PublicKeys(h.signer))
+		}
+		if s.opts.Agent {
+			auth = append(auth, ssh.PublicKeysCallback(agentClient.Signers))
+		}
+		if h.Password != "" {
+			auth = append(auth, ssh.Password(h.Password))
+		}
+		user := h.User
+		if user == "" {
+			user = os.Getenv("USER")
+		}
+		conf := &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: s.hostKeyCallback(h),
+		}
+		var next *ssh.Client
+		var err error
+		if client == nil {
+			next, err = ssh.Dial("tcp", h.addr, conf)
+		} else {
+			var conn net.Conn
+			conn, err = client.Dial("tcp", h.addr)
+			if err == nil {
+				var ncc ssh.Conn
+				var chans <-chan ssh.NewChannel
+				var reqs <-chan *ssh.Request
+				ncc, chans, reqs, err = ssh.NewClientConn(conn, h.addr, conf)
+				if err != nil {
+					conn.Close()
+				} else {
+					next = ssh.NewClient(ncc, chans, reqs)
+				}
+			}
+		}
+		if err != nil {
+			if client != nil {
+				client.Close()
+			}
+			if agentConn != nil {
+				agentConn.Close()
+			}
+			return nil, nil, nil, fmt.Errorf("%s: %w", h.addr, err)
+		}
+		client = next
+	}
+	return client, agentClient, agentConn, nil
+}
+
+func (s *SSH) Session() (webterm.Session, error) {
+	return &Session{ssh: s}, nil
+}
+
+func (s *SSH) Template() (*template.Template, any) {
+	return nil, nil
+}
+
+var _ webterm.Session = (*Session)(nil)
+
+// Session is a SSH session of the terminal.
+type Session struct {
+	ssh       *SSH
+	conn      *ssh.Client
+	agentConn net.Conn
+	session   *ssh.Session
+	reader    io.Reader
+	writer    io.Writer
+}
+
+func (ss *Session) Open() error {
+	conn, agentClient, agentConn, err := ss.ssh.Connect()
+	if err != nil {
+		return err
+	}
+	ss.conn, ss.agentConn = conn, agentConn
+	if ss.session, err = ss.conn.NewSession(); err != nil {
+		ss.Close()
+		return err
+	}
+	if ss.ssh.opts.ForwardAgent {
+		if err := agent.ForwardToAgent(ss.conn, agentClient); err != nil {
+			ss.Close()
+			return err
+		}
+		if err := agent.RequestAgentForwarding(ss.session); err != nil {
+			ss.Close()
+			return fmt.Errorf("agent forwarding: %w", err)
+		}
+	}
+	stdout, err := ss.session.StdoutPipe()
+	if err != nil {
+		ss.Close()
+		return err
+	}
+	stderr, err := ss.session.StderrPipe()
+	if err != nil {
+		ss.Close()
+		return err
+	}
+	stdin, err := ss.session.StdinPipe()
+	if err != nil {
+		ss.Close()
+		return err
+	}
+	ss.reader = io.MultiReader(stdout, stderr)
+	ss.writer = stdin
+
+	termType := cmp.Or(ss.ssh.opts.TermType, "xterm")
+	if err := ss.session.RequestPty(termType, 40, 80, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+		ss.Close()
+		return err
+	}
+	if ss.ssh.opts.Command != "" {
+		err = ss.session.Start(ss.ssh.opts.Command)
+	} else {
+		err = ss.session.Shell()
+	}
+	if err != nil {
+		ss.Close()
+		return err
+	}
+	return nil
+}
+
+func (ss *Session) Close() error {
+	if ss.session != nil {
+		ss.session.Signal(ssh.SIGKILL)
+		ss.session.Close()
+		ss.session = nil
+	}
+	if ss.conn != nil {
+		ss.conn.Close()
+		ss.conn = nil
+	}
+	if ss.agentConn != nil {
+		ss.agentConn.Close()
+		ss.agentConn = nil
+	}
+	return nil
+}
+
+func (ss *Session) Read(p []byte) (int, error) {
+	return ss.reader.Read(p)
+}
+
+func (ss *Session) Write(p []byte) (int, error) {
+	return ss.writer.Write(p)
+}
+
+func (ss *Session) SetWinSize(cols, rows int) error {
+	return ss.session.WindowChange(rows, cols)
+}
+
+func (ss *Session) Control(data []byte) error {
+	return nil
+}
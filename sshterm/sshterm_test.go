@@ -0,0 +1,282 @@
+package sshterm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testServer is a SSH server that echoes the input of the shell,
+// it accepts the password "secret" and the public key of authKey.
+type testServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+}
+
+func newTestServer(t *testing.T, authKey ssh.PublicKey) *testServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	conf := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authKey != nil && string(key.Marshal()) == string(authKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	conf.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, conf)
+		}
+	}()
+	return &testServer{addr: ln.Addr().String(), hostKey: signer.PublicKey()}
+}
+
+func serveConn(conn net.Conn, conf *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, conf)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range chReqs {
+				req.Reply(req.Type == "pty-req" || req.Type == "shell" || req.Type == "window-change", nil)
+			}
+		}()
+		go func() {
+			defer ch.Close()
+			io.Copy(ch, ch)
+		}()
+	}
+}
+
+func (ts *testServer) hop() Hop {
+	host, port, _ := net.SplitHostPort(ts.addr)
+	p, _ := net.LookupPort("tcp", port)
+	return Hop{Host: host, Port: p, User: "tester", Password: "secret"}
+}
+
+func echo(t *testing.T, s *SSH) error {
+	t.Helper()
+	sess, err := s.Session()
+	require.NoError(t, err)
+	if err := sess.Open(); err != nil {
+		return err
+	}
+	defer sess.Close()
+	require.NoError(t, sess.SetWinSize(100, 30))
+	_, err = sess.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(sess, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+	return nil
+}
+
+func TestPinnedHostKey(t *testing.T) {
+	ts := newTestServer(t, nil)
+	hop := ts.hop()
+	hop.HostKey = ssh.FingerprintSHA256(ts.hostKey)
+	s, err := New([]Hop{hop}, Options{})
+	require.NoError(t, err)
+	require.False(t, s.Insecure())
+	require.NoError(t, echo(t, s))
+
+	// the public key as known_hosts has
+	hop.HostKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ts.hostKey)))
+	s, err = New([]Hop{hop}, Options{})
+	require.NoError(t, err)
+	require.NoError(t, echo(t, s))
+
+	other := newTestServer(t, nil)
+	hop.HostKey = ssh.FingerprintSHA256(other.hostKey)
+	s, err = New([]Hop{hop}, Options{})
+	require.NoError(t, err)
+	err = echo(t, s)
+	require.ErrorContains(t, err, "mismatch")
+}
+
+func TestJumpHost(t *testing.T) {
+	jump := newTestServer(t, nil)
+	target := newTestServer(t, nil)
+	jumpHop, targetHop := jump.hop(), target.hop()
+	jumpHop.HostKey = ssh.FingerprintSHA256(jump.hostKey)
+	targetHop.HostKey = ssh.FingerprintSHA256(target.hostKey)
+	s, err := New([]Hop{jumpHop, targetHop}, Options{})
+	require.NoError(t, err)
+	// the test server does not forward, it fails after the jump host is verified
+	err = echo(t, s)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "host key")
+
+	// strict requires the host key of every hop
+	jumpHop.HostKey = ""
+	_, err = New([]Hop{jumpHop, targetHop}, Options{})
+	require.ErrorContains(t, err, "via[0]: host_key or known_hosts is required")
+}
+
+func TestKnownHosts(t *testing.T) {
+	ts := newTestServer(t, nil)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	// strict requires the file
+	_, err := New([]Hop{ts.hop()}, Options{KnownHosts: knownHosts})
+	require.Error(t, err)
+
+	// accept-new adds the unknown host
+	s, err := New([]Hop{ts.hop()}, Options{KnownHosts: knownHosts, HostKeyCheck: HostKeyAcceptNew})
+	require.NoError(t, err)
+	require.NoError(t, echo(t, s))
+	b, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(b), "\n"))
+	require.NoError(t, echo(t, s))
+	b, err = os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(b), "\n"), "the known host is not added again")
+
+	// strict accepts the known host
+	s, err = New([]Hop{ts.hop()}, Options{KnownHosts: knownHosts})
+	require.NoError(t, err)
+	require.NoError(t, echo(t, s))
+
+	// the changed host key is rejected even by accept-new
+	other := newTestServer(t, nil)
+	b = []byte(strings.Replace(string(b), ts.addr[strings.LastIndex(ts.addr, ":")+1:], other.addr[strings.LastIndex(other.addr, ":")+1:], 1))
+	require.NoError(t, os.WriteFile(knownHosts, b, 0600))
+	s, err = New([]Hop{other.hop()}, Options{KnownHosts: knownHosts, HostKeyCheck: HostKeyAcceptNew})
+	require.NoError(t, err)
+	require.ErrorContains(t, echo(t, s), "changed")
+
+	// strict rejects the unknown host
+	s, err = New([]Hop{ts.hop()}, Options{KnownHosts: knownHosts})
+	require.NoError(t, err)
+	require.ErrorContains(t, echo(t, s), "unknown")
+}
+
+func TestKeyfilePassphrase(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	ts := newTestServer(t, sshPub)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("pass phrase"))
+	require.NoError(t, err)
+	keyfile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyfile, pem.EncodeToMemory(block), 0600))
+
+	hop := ts.hop()
+	hop.Password = ""
+	hop.Keyfile = keyfile
+	hop.HostKey = ssh.FingerprintSHA256(ts.hostKey)
+	_, err = New([]Hop{hop}, Options{})
+	require.ErrorContains(t, err, "keyfile_passphrase is required")
+
+	hop.KeyfilePassphrase = "wrong"
+	_, err = New([]Hop{hop}, Options{})
+	require.Error(t, err)
+
+	hop.KeyfilePassphrase = "pass phrase"
+	s, err := New([]Hop{hop}, Options{})
+	require.NoError(t, err)
+	require.NoError(t, echo(t, s))
+
+	hop.Keyfile = filepath.Join(t.TempDir(), "none")
+	_, err = New([]Hop{hop}, Options{})
+	require.ErrorContains(t, err, "keyfile")
+}
+
+func TestAgent(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	ts := newTestServer(t, sshPub)
+	hop := ts.hop()
+	hop.Password = ""
+	hop.HostKey = ssh.FingerprintSHA256(ts.hostKey)
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	_, err = New([]Hop{hop}, Options{Agent: true})
+	require.ErrorContains(t, err, "SSH_AUTH_SOCK")
+	_, err = New([]Hop{hop}, Options{})
+	require.ErrorContains(t, err, "no authentication")
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: priv}))
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+	s, err := New([]Hop{hop}, Options{Agent: true})
+	require.NoError(t, err)
+	require.NoError(t, echo(t, s))
+}
+
+func TestOptions(t *testing.T) {
+	hop := Hop{Host: "example.com", Password: "secret"}
+	require.Equal(t, "example.com:22", hop.Addr())
+	s, err := New([]Hop{hop}, Options{})
+	require.NoError(t, err)
+	require.True(t, s.Insecure())
+
+	_, err = New([]Hop{hop}, Options{HostKeyCheck: "never"})
+	require.ErrorContains(t, err, "invalid host_key_check")
+	_, err = New([]Hop{hop}, Options{HostKeyCheck: HostKeyAcceptNew})
+	require.ErrorContains(t, err, "requires known_hosts")
+	_, err = New([]Hop{hop}, Options{HostKeyCheck: HostKeyStrict})
+	require.ErrorContains(t, err, "host_key or known_hosts is required")
+
+	_, err = ParseHostKey("SHA256:short")
+	require.Error(t, err)
+	_, err = ParseHostKey("not a key")
+	require.Error(t, err)
+}
@@ -0,0 +1,41 @@
+// hosts.js adds the selector of the ingested hosts next to the page title
+// of the dashboard, the dashboard of a host is at "<dashboard>/host/<host>/".
+document.addEventListener("DOMContentLoaded", function () {
+    const title = document.querySelector(".page-title");
+    if (!title) {
+        return;
+    }
+    const m = location.pathname.match(/^(.*\/)host\/([^\/]+)\/?$/);
+    const base = m ? m[1] : location.pathname.replace(/\/?$/, "/");
+    const current = m ? decodeURIComponent(m[2]) : "";
+    fetch("/api/v1/hosts")
+        .then(rsp => rsp.json())
+        .then(hosts => {
+            if (!hosts || hosts.length == 0) {
+                return;
+            }
+            const sel = document.createElement("select");
+            sel.className = "host-selector";
+            sel.style.marginLeft = "12px";
+            const local = document.createElement("option");
+            local.value = "";
+            local.textContent = "(this metrical)";
+            sel.appendChild(local);
+            hosts.forEach(h => {
+                const opt = document.createElement("option");
+                opt.value = h.name;
+                opt.textContent = h.name;
+                opt.selected = h.name == current;
+                sel.appendChild(opt);
+            });
+            sel.addEventListener("change", () => {
+                let path = base;
+                if (sel.value) {
+                    path += "host/" + encodeURIComponent(sel.value) + "/";
+                }
+                location.href = path + location.search;
+            });
+            title.appendChild(sel);
+        })
+        .catch(() => {});
+});
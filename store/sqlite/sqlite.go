@@ -31,6 +31,13 @@ type Storage struct {
 	wChan  chan *Record
 	db     *sql.DB
 	tables map[string]TableInfo
+	tags   func(name string) map[string]string
+}
+
+// SetTags sets the function that returns the tags of the metric,
+// the tags are stored in the "tags" column as a json object.
+func (s *Storage) SetTags(tags func(name string) map[string]string) {
+	s.tags = tags
 }
 
 func (s *Storage) Open() error {
@@ -235,6 +242,27 @@ func (s *Storage) Load(id metric.SeriesID, metricName string) ([]metric.Product,
 	return nil, nil
 }
 
+// MetricNames returns the names of the metrics stored for the series.
+func (s *Storage) MetricNames(id metric.SeriesID) ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT name FROM " + TableName(id) + " ORDER BY name")
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
 func (s *Storage) write(rec *Record) {
 	var tableName string
 	tableInfo, exists := s.tables[rec.id.ID()]
@@ -257,6 +285,7 @@ func (s *Storage) write(rec *Record) {
 			"min REAL,",
 			"max REAL,",
 			"other TEXT,",
+			"tags TEXT,",
 			"PRIMARY KEY (name, timestamp)",
 			")",
 		}, " ")
@@ -265,6 +294,10 @@ func (s *Storage) write(rec *Record) {
 			slog.Error("Failed to create table", "table", tableName, "error", err)
 			return
 		}
+		if err := s.addTagsColumn(tableName); err != nil {
+			slog.Error("Failed to add tags column", "table", tableName, "error", err)
+			return
+		}
 		s.tables[rec.id.ID()] = TableInfo{
 			name:            tableName,
 			retentionPeriod: rec.id.Period() * time.Duration(rec.id.MaxCount()+1),
@@ -276,6 +309,13 @@ func (s *Storage) write(rec *Record) {
 		"type",
 	}
 	values := []any{rec.pd.Name, rec.pd.Time, rec.pd.Type}
+	if s.tags != nil {
+		if tags := s.tags(rec.pd.Name); len(tags) > 0 {
+			b, _ := json.Marshal(tags)
+			columns = append(columns, "tags")
+			values = append(values, string(b))
+		}
+	}
 	switch p := rec.pd.Value.(type) {
 	case *metric.CounterValue:
 		columns = append(columns, "samples", "value")
@@ -341,6 +381,49 @@ func (s *Storage) write(rec *Record) {
 	}
 }
 
+// addTagsColumn adds the tags column to the table created by the previous versions.
+func (s *Storage) addTagsColumn(tableName string) error {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info(?)", tableName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == "tags" {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = s.db.Exec("ALTER TABLE " + tableName + " ADD COLUMN tags TEXT")
+	return err
+}
+
+// Tags returns the tags stored with the latest product of the metric.
+func (s *Storage) Tags(id metric.SeriesID, metricName string) (map[string]string, error) {
+	var tags sql.NullString
+	err := s.db.QueryRow("SELECT tags FROM "+TableName(id)+" WHERE name = ? ORDER BY timestamp DESC LIMIT 1", metricName).Scan(&tags)
+	if err != nil {
+		if err == sql.ErrNoRows || strings.Contains(err.Error(), "no such") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !tags.Valid || tags.String == "" {
+		return nil, nil
+	}
+	var ret map[string]string
+	if err := json.Unmarshal([]byte(tags.String), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 func (s *Storage) shrink(tableInfo TableInfo) {
 	sqlText := fmt.Sprintf("delete from %s where timestamp < ?", tableInfo.name)
 	cutoff := time.Now().Add(-tableInfo.retentionPeriod)
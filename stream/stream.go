@@ -0,0 +1,264 @@
+// Package stream pushes the products to the HTTP clients as Server-Sent Events,
+// the same products that the outputs receive.
+//
+// Each product is an event "product" whose data is the product as json
+// with its "tags", and whose id is the sequence number of the product.
+// A client that reconnects with the Last-Event-ID header receives
+// the products it missed if they are still in the ring buffer.
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+)
+
+// DefaultHeartbeat is the interval of the heartbeats
+// that keep the idle connections open through the proxies.
+const DefaultHeartbeat = 15 * time.Second
+
+// DefaultBufferSize is the number of the recent products
+// that the reconnecting clients can resume from.
+const DefaultBufferSize = 1024
+
+// subscriberBuffer is the number of the events queued for a client,
+// the client that falls behind is disconnected to resume with Last-Event-ID.
+const subscriberBuffer = 256
+
+var _ metric.Output = (*Broker)(nil)
+
+// Broker is the output that streams the products to the subscribers.
+type Broker struct {
+	Heartbeat time.Duration
+
+	tags func(name string) map[string]string
+
+	mu     sync.Mutex
+	lastID uint64
+	ring   []event
+	next   int
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+type event struct {
+	id   uint64
+	name string
+	data []byte
+}
+
+type subscriber struct {
+	filter metric.Filter
+	ch     chan event
+	done   chan struct{}
+}
+
+// streamProduct is the data of the event, the product with its tags.
+type streamProduct struct {
+	metric.Product
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// NewBroker returns the broker that keeps the last size products to resume from.
+func NewBroker(size int) *Broker {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Broker{
+		Heartbeat: DefaultHeartbeat,
+		ring:      make([]event, size),
+		subs:      map[*subscriber]struct{}{},
+	}
+}
+
+// SetTags sets the function that returns the tags of the products.
+func (b *Broker) SetTags(tags func(name string) map[string]string) {
+	b.tags = tags
+}
+
+// Process sends the product to the subscribers of its name.
+func (b *Broker) Process(pd metric.Product) error {
+	var tags map[string]string
+	if b.tags != nil {
+		tags = b.tags(pd.Name)
+	}
+	data, err := json.Marshal(streamProduct{Product: pd, Tags: tags})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.lastID++
+	ev := event{id: b.lastID, name: pd.Name, data: data}
+	b.ring[b.next] = ev
+	b.next = (b.next + 1) % len(b.ring)
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter.Match(ev.name) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			b.unsubscribe(sub)
+		}
+	}
+	return nil
+}
+
+// DeInit disconnects the subscribers.
+func (b *Broker) DeInit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.unsubscribe(sub)
+	}
+}
+
+// subscribe registers the subscriber and returns the buffered events after lastID,
+// all the buffered events if lastID is of the previous run of the broker.
+func (b *Broker) subscribe(filter metric.Filter, lastID uint64, resume bool) (*subscriber, []event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := &subscriber{filter: filter, ch: make(chan event, subscriberBuffer), done: make(chan struct{})}
+	if b.closed {
+		close(sub.done)
+		return sub, nil
+	}
+	b.subs[sub] = struct{}{}
+	if !resume {
+		return sub, nil
+	}
+	if lastID > b.lastID {
+		lastID = 0
+	}
+	var missed []event
+	for i := range len(b.ring) {
+		ev := b.ring[(b.next+i)%len(b.ring)]
+		if ev.id == 0 || ev.id <= lastID {
+			continue
+		}
+		if filter == nil || filter.Match(ev.name) {
+			missed = append(missed, ev)
+		}
+	}
+	return sub, missed
+}
+
+func (b *Broker) unsubscribe(sub *subscriber) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.done)
+	}
+}
+
+// ServeHTTP streams the products of the names that match the "filter",
+// the comma separated patterns, e.g. "?filter=cpu:*,mem:*".
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var patterns []string
+	for _, f := range r.URL.Query()["filter"] {
+		for p := range strings.SplitSeq(f, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	var filter metric.Filter
+	if len(patterns) > 0 {
+		f, err := metric.Compile(patterns, ':')
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid filter: %v", err), http.StatusBadRequest)
+			return
+		}
+		filter = f
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		// EventSource can not set the header on the first connection
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub, missed := b.subscribe(filter, lastID, lastEventID != "")
+	defer func() {
+		b.mu.Lock()
+		b.unsubscribe(sub)
+		b.mu.Unlock()
+	}()
+
+	heartbeat := b.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds()); err != nil {
+		return
+	}
+	for _, ev := range missed {
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.done:
+			return
+		case ev := <-sub.ch:
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			// write the queued events before flushing
+			for n := len(sub.ch); n > 0; n-- {
+				if err := writeEvent(w, <-sub.ch); err != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: product\ndata: %s\n\n", ev.id, ev.data)
+	return err
+}
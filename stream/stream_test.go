@@ -0,0 +1,151 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/metric"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvents reads the events until n events are read, the comments are skipped.
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []sseEvent {
+	t.Helper()
+	var ret []sseEvent
+	var ev sseEvent
+	for len(ret) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if ev.event != "" {
+				ret = append(ret, ev)
+			}
+			ev = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			ev.event = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			ev.data = line[6:]
+		}
+	}
+	require.Len(t, ret, n)
+	return ret
+}
+
+func product(name string) metric.Product {
+	return metric.Product{
+		Name:  name,
+		Time:  time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC),
+		Type:  "gauge",
+		Value: &metric.GaugeValue{Samples: 1, Sum: 1, Value: 1},
+	}
+}
+
+func subscribed(b *Broker, n int) func() bool {
+	return func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.subs) == n
+	}
+}
+
+func TestStream(t *testing.T) {
+	b := NewBroker(4)
+	b.SetTags(func(name string) map[string]string { return map[string]string{"host": "web1"} })
+	svr := httptest.NewServer(b)
+	defer svr.Close()
+
+	rsp, err := http.Get(svr.URL + "?filter=cpu:*")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, "text/event-stream", rsp.Header.Get("Content-Type"))
+	require.Eventually(t, subscribed(b, 1), 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.Process(product("mem:percent")))
+	require.NoError(t, b.Process(product("cpu:cpu_all")))
+	scanner := bufio.NewScanner(rsp.Body)
+	events := readEvents(t, scanner, 1)
+	require.Equal(t, "2", events[0].id)
+	require.Equal(t, "product", events[0].event)
+	var data map[string]any
+	require.NoError(t, json.Unmarshal([]byte(events[0].data), &data))
+	require.Equal(t, "cpu:cpu_all", data["name"])
+	require.Equal(t, map[string]any{"host": "web1"}, data["tags"])
+
+	b.DeInit()
+	require.False(t, scanner.Scan(), "closed by DeInit")
+}
+
+func TestStreamResume(t *testing.T) {
+	b := NewBroker(3)
+	svr := httptest.NewServer(b)
+	defer svr.Close()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, b.Process(product(name)))
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, svr.URL, nil)
+	req.Header.Set("Last-Event-ID", "3")
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	events := readEvents(t, bufio.NewScanner(rsp.Body), 2)
+	require.Equal(t, "4", events[0].id)
+	require.Equal(t, "5", events[1].id)
+
+	// the ids of the previous run are resumed from the oldest in the buffer
+	rsp2, err := http.Get(svr.URL + "?lastEventId=100")
+	require.NoError(t, err)
+	defer rsp2.Body.Close()
+	events = readEvents(t, bufio.NewScanner(rsp2.Body), 3)
+	require.Equal(t, "3", events[0].id)
+
+	rsp3, err := http.Get(svr.URL + "?lastEventId=x")
+	require.NoError(t, err)
+	rsp3.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp3.StatusCode)
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	b := NewBroker(0)
+	b.Heartbeat = 10 * time.Millisecond
+	svr := httptest.NewServer(b)
+	defer svr.Close()
+
+	rsp, err := http.Get(svr.URL)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		if scanner.Text() == ": heartbeat" {
+			return
+		}
+	}
+	t.Fatal("no heartbeat")
+}
+
+func TestStreamSlowSubscriber(t *testing.T) {
+	b := NewBroker(0)
+	sub, _ := b.subscribe(nil, 0, false)
+	for range subscriberBuffer + 1 {
+		require.NoError(t, b.Process(product("a")))
+	}
+	select {
+	case <-sub.done:
+	default:
+		t.Fatal("the subscriber that falls behind should be disconnected")
+	}
+	require.True(t, subscribed(b, 0)())
+}
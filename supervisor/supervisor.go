@@ -0,0 +1,259 @@
+// Package supervisor runs a long-running child process, restarts it
+// with a backoff when it exits and forwards its stderr to slog.
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNotRunning is returned by Write while the child is not running.
+var ErrNotRunning = errors.New("process is not running")
+
+// Process supervises a child process.
+type Process struct {
+	Command     []string
+	Environment []string
+	// RestartDelay is the delay before the first restart,
+	// it doubles on every consecutive restart up to MaxRestartDelay.
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+	// StopTimeout is the time to wait for the child to exit
+	// after SIGTERM before it is killed.
+	StopTimeout time.Duration
+	// DrainStdin makes Stop close the stdin first and wait up to StopTimeout
+	// for the child to exit by itself, before it is terminated.
+	DrainStdin bool
+	// OnStdout is called with each line of the stdout of the child.
+	// If it is nil, the stdout is discarded.
+	OnStdout func(line []byte)
+
+	mu       sync.Mutex
+	stdin    io.WriteCloser
+	cancel   context.CancelFunc
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+// Start starts the child and the goroutine that restarts it,
+// it returns the error if the first start fails.
+func (p *Process) Start() error {
+	if len(p.Command) == 0 {
+		return errors.New("command is required")
+	}
+	if p.RestartDelay <= 0 {
+		p.RestartDelay = time.Second
+	}
+	if p.MaxRestartDelay < p.RestartDelay {
+		p.MaxRestartDelay = max(time.Minute, p.RestartDelay)
+	}
+	if p.StopTimeout <= 0 {
+		p.StopTimeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := p.start(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	p.cancel = cancel
+	p.stopping = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.supervise(ctx, c)
+	return nil
+}
+
+// Stop terminates the child and waits for it to exit.
+func (p *Process) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	close(p.stopping)
+	if p.DrainStdin {
+		p.mu.Lock()
+		if p.stdin != nil {
+			p.stdin.Close()
+			p.stdin = nil
+		}
+		p.mu.Unlock()
+		select {
+		case <-p.done:
+		case <-time.After(p.StopTimeout):
+		}
+	}
+	p.cancel()
+	<-p.done
+	p.cancel = nil
+}
+
+// Write writes the line to the stdin of the child.
+func (p *Process) Write(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stdin == nil {
+		return ErrNotRunning
+	}
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	_, err := p.stdin.Write(line)
+	return err
+}
+
+// child is a started command with the goroutines reading its output.
+type child struct {
+	cmd     *exec.Cmd
+	readers sync.WaitGroup
+}
+
+// wait waits for the output to be read and the command to exit,
+// it does not wait for the output if the process is being stopped.
+func (c *child) wait(ctx context.Context) error {
+	read := make(chan struct{})
+	go func() {
+		c.readers.Wait()
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-ctx.Done():
+	}
+	return c.cmd.Wait()
+}
+
+func (p *Process) start(ctx context.Context) (*child, error) {
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Env = append(os.Environ(), p.Environment...)
+	// the child and its children are terminated together
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM) }
+	cmd.WaitDelay = p.StopTimeout
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", p.Command[0], err)
+	}
+	slog.Info("process started", "command", p.Command[0], "pid", cmd.Process.Pid)
+	c := &child{cmd: cmd}
+	c.readers.Add(2)
+	go func() {
+		defer c.readers.Done()
+		p.readStdout(stdout)
+	}()
+	go func() {
+		defer c.readers.Done()
+		p.readStderr(stderr)
+	}()
+	p.mu.Lock()
+	p.stdin = stdin
+	p.mu.Unlock()
+	return c, nil
+}
+
+func (p *Process) supervise(ctx context.Context, c *child) {
+	defer close(p.done)
+	delay := p.RestartDelay
+	for {
+		started := time.Now()
+		err := c.wait(ctx)
+		p.mu.Lock()
+		p.stdin = nil
+		p.mu.Unlock()
+		select {
+		case <-p.stopping:
+			slog.Info("process stopped", "command", p.Command[0])
+			return
+		default:
+		}
+		// the child ran long enough, it is not crashing in a loop
+		if time.Since(started) > p.MaxRestartDelay {
+			delay = p.RestartDelay
+		}
+		for {
+			slog.Warn("process exited, restarting", "command", p.Command[0], "error", err, "delay", delay)
+			select {
+			case <-p.stopping:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, p.MaxRestartDelay)
+			c, err = p.start(ctx)
+			if err == nil {
+				break
+			}
+		}
+	}
+}
+
+func (p *Process) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if p.OnStdout != nil && len(scanner.Bytes()) > 0 {
+			p.OnStdout(scanner.Bytes())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("process stdout", "command", p.Command[0], "error", err)
+		io.Copy(io.Discard, r)
+	}
+}
+
+// readStderr logs the lines of the stderr of the child,
+// the level is taken from the prefix of the line, e.g. "ERROR: message",
+// or WARN if the line has no level prefix.
+func (p *Process) readStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		level, msg := stderrLevel(scanner.Text())
+		if msg == "" {
+			continue
+		}
+		slog.Log(context.Background(), level, msg, "command", p.Command[0])
+	}
+	if scanner.Err() != nil {
+		io.Copy(io.Discard, r)
+	}
+}
+
+func stderrLevel(line string) (slog.Level, string) {
+	line = strings.TrimSpace(line)
+	for _, l := range []struct {
+		prefix string
+		level  slog.Level
+	}{
+		{"DEBUG", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"WARN", slog.LevelWarn},
+		{"WARNING", slog.LevelWarn},
+		{"ERROR", slog.LevelError},
+	} {
+		if len(line) <= len(l.prefix) || !strings.EqualFold(line[:len(l.prefix)], l.prefix) {
+			continue
+		}
+		if rest := line[len(l.prefix):]; rest[0] == ':' || rest[0] == ' ' {
+			return l.level, strings.TrimSpace(rest[1:])
+		}
+	}
+	return slog.LevelWarn, line
+}
@@ -0,0 +1,37 @@
+package supervisor
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStderrLevel(t *testing.T) {
+	tests := []struct {
+		line  string
+		level slog.Level
+		msg   string
+	}{
+		{"ERROR: connection refused", slog.LevelError, "connection refused"},
+		{"warning: retrying", slog.LevelWarn, "retrying"},
+		{"DEBUG polling", slog.LevelDebug, "polling"},
+		{"INFOrmation", slog.LevelWarn, "INFOrmation"},
+		{"  panic: boom  ", slog.LevelWarn, "panic: boom"},
+		{"ERROR", slog.LevelWarn, "ERROR"},
+	}
+	for _, tt := range tests {
+		level, msg := stderrLevel(tt.line)
+		require.Equal(t, tt.level, level, tt.line)
+		require.Equal(t, tt.msg, msg, tt.line)
+	}
+}
+
+func TestStart(t *testing.T) {
+	p := &Process{}
+	require.Error(t, p.Start())
+	p = &Process{Command: []string{"/nonexistent/command"}}
+	require.Error(t, p.Start())
+	require.ErrorIs(t, p.Write([]byte("x")), ErrNotRunning)
+	p.Stop()
+}
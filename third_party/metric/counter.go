@@ -0,0 +1,107 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+func NewCounterWithValue(v *CounterValue) *Counter {
+	return &Counter{
+		samples: v.Samples,
+		value:   v.Value,
+	}
+}
+
+var _ Producer = (*Counter)(nil)
+
+type Counter struct {
+	sync.Mutex
+	samples  int64
+	value    float64
+	derivers []Deriver
+}
+
+func (fs *Counter) MarshalJSON() ([]byte, error) {
+	p := fs.Produce(false)
+	return json.Marshal(p)
+}
+
+func (fs *Counter) UnmarshalJSON(data []byte) error {
+	p := &CounterValue{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return err
+	}
+	fs.samples = p.Samples
+	fs.value = p.Value
+	return nil
+}
+
+func (fs *Counter) WithDerivers(derivers ...Deriver) *Counter {
+	fs.derivers = append(fs.derivers, derivers...)
+	return fs
+}
+
+func (fs *Counter) Derivers() []Deriver {
+	return fs.derivers
+}
+
+func (fs *Counter) Add(v float64) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.value += v
+	fs.samples++
+}
+
+func (fs *Counter) Merge(v Value) error {
+	cv, ok := v.(*CounterValue)
+	if !ok {
+		return fmt.Errorf("counter can not merge %T", v)
+	}
+	fs.Lock()
+	defer fs.Unlock()
+	fs.value += cv.Value
+	fs.samples += cv.Samples
+	return nil
+}
+
+func (fs *Counter) Produce(reset bool) Value {
+	fs.Lock()
+	defer fs.Unlock()
+	ret := &CounterValue{
+		Samples: int64(fs.samples),
+		Value:   float64(fs.value),
+	}
+	if reset {
+		fs.samples = 0
+		fs.value = 0
+	}
+	return ret
+}
+
+func (fs *Counter) String() string {
+	return fs.Produce(false).String()
+}
+
+type CounterValue struct {
+	Samples int64   `json:"samples"`
+	Value   float64 `json:"value"`
+	// Optional derived values, such as moving averages
+	DerivedValues map[string]Value `json:"derived,omitempty"`
+}
+
+func (cp *CounterValue) String() string {
+	b, _ := json.Marshal(cp)
+	return string(b)
+}
+
+func (cp *CounterValue) SetDerivedValue(name string, value Value) {
+	if cp.DerivedValues == nil {
+		cp.DerivedValues = make(map[string]Value)
+	}
+	cp.DerivedValues[name] = value
+}
@@ -0,0 +1,87 @@
+package metric
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	timeZone = time.UTC
+	m.Run()
+}
+
+func TestMetric(t *testing.T) {
+	var wg sync.WaitGroup
+	var out string
+	var cnt int
+	var now time.Time
+	wg.Add(3)
+	seriesID, err := NewSeriesID("METRIC_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(
+		WithSamplingInterval(time.Second),
+		WithSeries(seriesID),
+	)
+	c.AddOutputFunc(func(pd Product) error {
+		defer wg.Done()
+		out = fmt.Sprintf("%s %s %v %s %s",
+			pd.Name, pd.SeriesTitle, pd.Time.Format(time.TimeOnly), pd.Value.String(), pd.Type)
+		if cnt == 0 {
+			now = pd.Time
+		} else {
+			now = now.Add(time.Second)
+		}
+		cnt++
+		expect := fmt.Sprintf(`m1:f1 1m/1s %s {"samples":1,"value":1} counter`, now.Format(time.TimeOnly))
+		require.Equal(t, expect, out)
+		return nil
+	})
+	c.AddInputFunc(func(g *Gather) error {
+		g.Add("m1:f1", 1.0, CounterType(UnitShort))
+		return nil
+	})
+	c.Start()
+	wg.Wait()
+
+	sn, err := c.Inflight("m1:f1")
+	require.NoError(t, err)
+	// TODO: how to preserve the lowercase of series ID?
+	pd := sn["METRIC_1M"]
+	require.NotNil(t, pd)
+	require.Equal(t, "m1:f1", pd.Name)
+	require.Equal(t, int64(1), int64(pd.Value.(*CounterValue).Value))
+	require.Equal(t, int64(1), int64(pd.Value.(*CounterValue).Samples))
+	require.Equal(t, "counter", pd.Type)
+	c.Stop()
+}
+
+func TestGatherMeasures(t *testing.T) {
+	g := &Gather{}
+	require.Empty(t, g.Measures())
+	g.Add("a", 1, GaugeType(UnitShort))
+	g.Add("b", 2, CounterType(UnitShort))
+	ms := g.Measures()
+	require.Len(t, ms, 2)
+	require.Equal(t, "b", ms[1].Name)
+	require.Equal(t, 2.0, ms[1].Value)
+	require.Equal(t, "counter", ms[1].Type.Name())
+	g.Filter(nil)
+	require.Len(t, g.Measures(), 2)
+}
+
+func TestCollectorMerge(t *testing.T) {
+	seriesID, err := NewSeriesID("MERGE_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(WithSeries(seriesID), WithPrefix(t.Name()))
+	typ := TimerType()
+	require.NoError(t, c.Merge("t1", typ, &TimerValue{Samples: 2, Sum: 3 * time.Second, Min: time.Second, Max: 2 * time.Second}))
+	require.NoError(t, c.Merge("t1", typ, &TimerValue{Samples: 1, Sum: 4 * time.Second, Min: 4 * time.Second, Max: 4 * time.Second}))
+	require.Error(t, c.Merge("t1", typ, &CounterValue{Samples: 1}))
+
+	_, v := c.Timeseries("t1")[0].Last()
+	require.Equal(t, &TimerValue{Samples: 3, Sum: 7 * time.Second, Min: time.Second, Max: 4 * time.Second}, v)
+}
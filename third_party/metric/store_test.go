@@ -0,0 +1,48 @@
+package metric
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorageReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	id, err := NewSeriesID("TEST", "test", time.Second, 10)
+	require.NoError(t, err)
+
+	w := NewFileStorage(dir, 10)
+	require.NoError(t, w.Open())
+	defer w.Close()
+	now := time.Now()
+	require.NoError(t, w.Store(id, Product{Name: "cpu:percent", Time: now, Type: "gauge", Value: &GaugeValue{Value: 1, Sum: 1, Samples: 1}}, false))
+	require.NoError(t, w.Store(id, Product{Name: "mem:used", Time: now, Type: "gauge", Value: &GaugeValue{Value: 2, Sum: 2, Samples: 1}}, false))
+	require.Eventually(t, func() bool {
+		b, _ := os.ReadFile(filepath.Join(dir, "TEST.ts"))
+		return strings.Count(string(b), "\n") == 2
+	}, time.Second, 10*time.Millisecond)
+
+	r := NewFileStorageReadOnly(dir)
+	require.NoError(t, r.Open())
+	names, err := r.MetricNames(id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu:percent", "mem:used"}, names)
+	products, err := r.Load(id, "mem:used")
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	require.Equal(t, 2.0, products[0].Value.(*GaugeValue).Value)
+	require.ErrorIs(t, r.Store(id, products[0], false), ErrReadOnly)
+	require.NoError(t, r.Close())
+
+	other, err := NewSeriesID("OTHER", "other", time.Second, 10)
+	require.NoError(t, err)
+	products, err = r.Load(other, "mem:used")
+	require.NoError(t, err)
+	require.Empty(t, products)
+	_, err = os.Stat(filepath.Join(dir, "TEST.ts.bak"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,215 @@
+// Package tlsconf builds the TLS config of the HTTP server
+// from the certificate files, which are reloaded when they change.
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Options is the TLS options of the HTTP server.
+type Options struct {
+	CertFile   string
+	KeyFile    string
+	ClientCA   string   // PEM file of the CAs of the client certificates, enables mTLS
+	MinVersion string   // "1.2" or "1.3", default "1.2"
+	SelfSigned bool     // generates the certificate if the files do not exist
+	Hosts      []string // the DNS names and the IPs of the self-signed certificate
+}
+
+// Enabled reports whether the TLS is configured.
+func (o Options) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+// ParseVersion returns the TLS version of the name, "1.2" or "1.3".
+func ParseVersion(name string) (uint16, error) {
+	switch name {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q, 1.2 or 1.3", name)
+	}
+}
+
+// New returns the TLS config of the options, it generates
+// the self-signed certificate if it is requested and the files do not exist.
+func New(opts Options) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("both tls_cert and tls_key are required")
+	}
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SelfSigned {
+		if _, err := os.Stat(opts.CertFile); errors.Is(err, os.ErrNotExist) {
+			if err := GenerateSelfSigned(opts.CertFile, opts.KeyFile, opts.Hosts); err != nil {
+				return nil, fmt.Errorf("generating self-signed certificate: %w", err)
+			}
+			slog.Warn("Generated a self-signed certificate, for the lab use only", "cert", opts.CertFile, "key", opts.KeyFile)
+		}
+	}
+	cert, err := LoadCertificate(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: cert.GetCertificate,
+	}
+	if opts.ClientCA != "" {
+		b, err := os.ReadFile(opts.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("client_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("client_ca %s: no certificate", opts.ClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// reloadCheckInterval is the interval to check the modification of the files.
+var reloadCheckInterval = 5 * time.Second
+
+// Certificate is the certificate of the files,
+// it is reloaded when the files are modified.
+type Certificate struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// LoadCertificate loads the certificate and the key of the PEM files.
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	modTime, err := c.modified()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.load(modTime); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// modified returns the latest modification time of the files.
+func (c *Certificate) modified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *Certificate) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the certificate for the handshake,
+// it reloads the files if they are modified. The previous certificate
+// is kept if the files are invalid, e.g. while they are being written.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := time.Now(); now.Sub(c.checkedAt) >= reloadCheckInterval {
+		c.checkedAt = now
+		if modTime, err := c.modified(); err != nil {
+			slog.Error("Failed to check the certificate", "cert", c.certFile, "error", err)
+		} else if !modTime.Equal(c.modTime) {
+			if err := c.load(modTime); err != nil {
+				slog.Error("Failed to reload the certificate", "cert", c.certFile, "error", err)
+			} else {
+				slog.Info("Reloaded the certificate", "cert", c.certFile)
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// GenerateSelfSigned writes a self-signed certificate valid for a year
+// for the hosts, localhost and the hostname.
+func GenerateSelfSigned(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"metrical"}, CommonName: hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range append([]string{"localhost", "127.0.0.1", "::1", hostname}, hosts...) {
+		if h == "" {
+			continue
+		}
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
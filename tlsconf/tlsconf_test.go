@@ -0,0 +1,145 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serve serves HTTPS of the config and returns the address.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	svr := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})}
+	go svr.Serve(ln)
+	t.Cleanup(func() { svr.Close() })
+	return ln.Addr().String()
+}
+
+func client(t *testing.T, caFile string, certs ...tls.Certificate) *http.Client {
+	t.Helper()
+	b, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(b))
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: certs},
+		DisableKeepAlives: true,
+	}}
+}
+
+func serial(t *testing.T, c *http.Client, addr string) string {
+	t.Helper()
+	rsp, err := c.Get("https://" + addr)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	return rsp.TLS.PeerCertificates[0].SerialNumber.String()
+}
+
+func TestSelfSignedAndReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls", "cert.pem"), filepath.Join(dir, "tls", "key.pem")
+	cfg, err := New(Options{CertFile: certFile, KeyFile: keyFile, SelfSigned: true, MinVersion: "1.3", Hosts: []string{"metrical.local"}})
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	fi, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	addr := serve(t, cfg)
+	first := serial(t, client(t, certFile), addr)
+
+	// the existing certificate is not generated again
+	_, err = New(Options{CertFile: certFile, KeyFile: keyFile, SelfSigned: true})
+	require.NoError(t, err)
+	require.Equal(t, first, serial(t, client(t, certFile), addr))
+
+	// the modified files are reloaded
+	reloadCheckInterval = 0
+	defer func() { reloadCheckInterval = 5 * time.Second }()
+	require.NoError(t, GenerateSelfSigned(certFile, keyFile, nil))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	second := serial(t, client(t, certFile), addr)
+	require.NotEqual(t, first, second)
+
+	// the invalid files keep the previous certificate
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0644))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	rsp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}).Get("https://" + addr)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, second, rsp.TLS.PeerCertificates[0].SerialNumber.String())
+}
+
+func TestClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, GenerateSelfSigned(certFile, keyFile, nil))
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "metrical CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644))
+
+	cfg, err := New(Options{CertFile: certFile, KeyFile: keyFile, ClientCA: caFile})
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+	addr := serve(t, cfg)
+
+	_, err = client(t, certFile).Get("https://" + addr)
+	require.Error(t, err, "no client certificate")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "edge1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	clientCert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	require.NotEmpty(t, serial(t, client(t, certFile, clientCert), addr))
+}
+
+func TestOptions(t *testing.T) {
+	_, err := New(Options{CertFile: "cert.pem"})
+	require.Error(t, err)
+	_, err = New(Options{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.0"})
+	require.Error(t, err)
+	_, err = New(Options{CertFile: filepath.Join(t.TempDir(), "none.pem"), KeyFile: "key.pem"})
+	require.Error(t, err)
+	require.False(t, Options{}.Enabled())
+}